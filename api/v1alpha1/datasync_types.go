@@ -0,0 +1,502 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// LabelDataSync is set on every object created for a DataSync and holds its name.
+	LabelDataSync = "pelotech.ot/datasync"
+	// LabelWorkspaceID holds the workspace a DataSync or one of its objects belongs to.
+	LabelWorkspaceID = "pelotech.ot/workspace-id"
+	// LabelWorkspaceVersion holds the workspace version a DataSync or one of its objects belongs to.
+	LabelWorkspaceVersion = "pelotech.ot/workspace-version"
+	// LabelVM holds the name of the VM entry a DataVolume was created for.
+	LabelVM = "pelotech.ot/vm"
+	// LabelHeld is set to "true" on VirtualMachines held until their data is synced.
+	LabelHeld = "pelotech.ot/held"
+	// LabelContentKey identifies the content of the disk in a DataVolume by
+	// the checksum it is verified against, so DataSyncs syncing the same disk
+	// can share it.
+	LabelContentKey = "pelotech.ot/content-key"
+)
+
+const (
+	// AnnotationOnDemand is set to "true" on DataSyncs a launched workspace is
+	// waiting on. They are admitted ahead of DataSyncs that are only preloading.
+	AnnotationOnDemand = "pelotech.ot/on-demand"
+	// AnnotationSyncVMs holds the JSON encoded VM entries of a workspace on its
+	// VirtualMachines, so launching the workspace can create a missing DataSync.
+	AnnotationSyncVMs = "pelotech.ot/sync-vms"
+	// AnnotationHeldFor holds the name of the DataSync a held VirtualMachine waits for.
+	AnnotationHeldFor = "pelotech.ot/held-for"
+	// AnnotationHeldRunStrategy holds the run strategy a held VirtualMachine is released with.
+	AnnotationHeldRunStrategy = "pelotech.ot/held-run-strategy"
+	// AnnotationChecksumVerified holds the checksum a DataVolume was verified
+	// against. A DataVolume imported again is verified again.
+	AnnotationChecksumVerified = "pelotech.ot/checksum-verified"
+	// AnnotationClonedFrom holds the namespace/name of the DataVolume a
+	// DataVolume cloned instead of downloading the same disk again.
+	AnnotationClonedFrom = "pelotech.ot/cloned-from"
+	// AnnotationDeltaBase holds the namespace/name of the DataVolume of an
+	// earlier workspace version a DataVolume cloned to apply a delta to.
+	AnnotationDeltaBase = "pelotech.ot/delta-base"
+	// AnnotationDeltaApplied holds the URL of the delta applied to a DataVolume.
+	AnnotationDeltaApplied = "pelotech.ot/delta-applied"
+	// AnnotationManifestDigest holds the SHA-256 digest of the workspace
+	// manifest a DataSync was last submitted with through the pipeline API,
+	// so submitting the same manifest again leaves it alone.
+	AnnotationManifestDigest = "pelotech.ot/manifest-digest"
+	// AnnotationCancel is set to "true" to cancel a DataSync that has not
+	// finished. Its volumes are deleted and it is not synced again.
+	AnnotationCancel = "pelotech.ot/cancel"
+)
+
+// SourceType identifies where the data for a VM disk is imported from.
+// +kubebuilder:validation:Enum=http;registry;s3;pvc;snapshot
+type SourceType string
+
+const (
+	// SourceTypeHTTP imports a disk image served over http or https.
+	SourceTypeHTTP SourceType = "http"
+	// SourceTypeRegistry imports a container disk from an image registry.
+	SourceTypeRegistry SourceType = "registry"
+	// SourceTypeS3 imports a disk image from S3-compatible object storage.
+	SourceTypeS3 SourceType = "s3"
+	// SourceTypePVC clones an existing PersistentVolumeClaim.
+	SourceTypePVC SourceType = "pvc"
+	// SourceTypeSnapshot restores a VolumeSnapshot.
+	SourceTypeSnapshot SourceType = "snapshot"
+)
+
+// Remote reports whether disks of the source type are downloaded from outside
+// the cluster through a URL. Clones and restores are copied within the
+// cluster and do not count as egress.
+func (t SourceType) Remote() bool {
+	return t == SourceTypeHTTP || t == SourceTypeRegistry || t == SourceTypeS3
+}
+
+// RegistryPullMethod decides how a container disk is pulled from its registry.
+// +kubebuilder:validation:Enum=pod;node
+type RegistryPullMethod string
+
+const (
+	// RegistryPullMethodPod pulls the image with an importer pod.
+	RegistryPullMethodPod RegistryPullMethod = "pod"
+	// RegistryPullMethodNode pulls the image through the container runtime of
+	// the node, sharing its image cache.
+	RegistryPullMethodNode RegistryPullMethod = "node"
+)
+
+// DeletionPolicy decides what happens to the storage of a DataSync when it is deleted.
+// Imports still in progress are always cancelled and their storage deleted.
+// +kubebuilder:validation:Enum=Delete;Retain;Orphan
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the DataVolumes and their PVCs.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain keeps the DataVolumes and PVCs of completed imports.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyOrphan deletes the DataVolumes but keeps the PVCs of completed imports.
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// DataSyncPhase is a label for the condition of a DataSync at the current time.
+type DataSyncPhase string
+
+const (
+	// DataSyncPhaseQueued means the DataSync is waiting for an available worker.
+	DataSyncPhaseQueued DataSyncPhase = "Queued"
+	// DataSyncPhaseSyncing means the storage objects for the DataSync are being created.
+	DataSyncPhaseSyncing DataSyncPhase = "Syncing"
+	// DataSyncPhaseSucceeded means every storage object for the DataSync is ready to use.
+	DataSyncPhaseSucceeded DataSyncPhase = "Succeeded"
+	// DataSyncPhaseFailed means the DataSync could not be synced.
+	DataSyncPhaseFailed DataSyncPhase = "Failed"
+	// DataSyncPhaseSuspended means the DataSync or the sync policy is
+	// suspended. The DataSync is queued again once both are resumed.
+	DataSyncPhaseSuspended DataSyncPhase = "Suspended"
+	// DataSyncPhaseCancelled means the DataSync was cancelled before it finished.
+	DataSyncPhaseCancelled DataSyncPhase = "Cancelled"
+)
+
+const (
+	// ConditionReady indicates whether all storage objects for the DataSync are ready.
+	ConditionReady = "Ready"
+)
+
+// DataSyncHTTPHeader is an extra header sent with the requests of an http source.
+type DataSyncHTTPHeader struct {
+	// Name is the name of the header, e.g. "Authorization".
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Value is the value of the header.
+	Value string `json:"value"`
+}
+
+// DataSyncHTTPSource holds the settings of an http source.
+type DataSyncHTTPSource struct {
+	// Headers are sent with every request for the disk image. They are
+	// stored in plain text, so headers carrying credentials are denied;
+	// send those with HeadersSecretRef.
+	// +optional
+	Headers []DataSyncHTTPHeader `json:"headers,omitempty"`
+
+	// HeadersSecretRef names a Secret in the namespace of the DataSync whose
+	// values are sent as extra headers with every request for the disk
+	// image, each in the form "Name: value", e.g. "Authorization: Bearer
+	// ...". The keys of the Secret are not used. Like SecretRef, rotating
+	// the Secret re-arms a DataSync whose source rejected the previous
+	// credentials.
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	HeadersSecretRef string `json:"headersSecretRef,omitempty"`
+}
+
+// DataSyncRegistrySource holds the settings of a registry source.
+type DataSyncRegistrySource struct {
+	// PullMethod decides how the image is pulled. Defaults to pod.
+	// +optional
+	PullMethod RegistryPullMethod `json:"pullMethod,omitempty"`
+}
+
+// DataSyncDeltaSource describes a delta that turns the disk of an earlier
+// version of the workspace into the disk of this version.
+type DataSyncDeltaSource struct {
+	// URL is the http or https location of a qcow2 overlay holding the
+	// clusters that changed since the base version, with the virtual size of
+	// the base disk. It is downloaded with the credentials and CA bundle of
+	// the VM entry.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// BaseVersion is the workspace version the overlay was built against.
+	// Only the disk of this VM entry synced for that version is cloned: the
+	// overlay is committed without checking its base, so applying it to any
+	// other disk would corrupt it silently.
+	// +kubebuilder:validation:MinLength=1
+	BaseVersion string `json:"baseVersion"`
+}
+
+// DataSyncVolumeSource names the PersistentVolumeClaim or VolumeSnapshot a
+// disk is copied from.
+type DataSyncVolumeSource struct {
+	// Name is the name of the PersistentVolumeClaim or VolumeSnapshot.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the PersistentVolumeClaim or
+	// VolumeSnapshot. It must be the namespace of the DataSync, which is
+	// also the default.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// DataSyncVM describes a single VM disk that must be synced for a workspace.
+type DataSyncVM struct {
+	// Name identifies the VM disk within the DataSync.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// SourceType is the kind of source the disk is synced from.
+	SourceType SourceType `json:"sourceType"`
+
+	// URL is the location the disk image is imported from. Required for the
+	// http, registry and s3 source types, and not allowed for the others.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// SecretRef names a Secret in the namespace of the DataSync holding the
+	// credentials of an http, registry or s3 source, in the format CDI
+	// expects: accessKeyId and secretKey. Rotating the Secret re-arms a
+	// DataSync whose source rejected the previous credentials.
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	SecretRef string `json:"secretRef,omitempty"`
+
+	// CertConfigMapRef names a ConfigMap in the namespace of the DataSync
+	// holding the CA bundle an http, registry or s3 source is verified with.
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	CertConfigMapRef string `json:"certConfigMapRef,omitempty"`
+
+	// HTTP holds the settings of an http source.
+	// +optional
+	HTTP *DataSyncHTTPSource `json:"http,omitempty"`
+
+	// Registry holds the settings of a registry source.
+	// +optional
+	Registry *DataSyncRegistrySource `json:"registry,omitempty"`
+
+	// PVC names the PersistentVolumeClaim a pvc source clones. Required for
+	// the pvc source type.
+	// +optional
+	PVC *DataSyncVolumeSource `json:"pvc,omitempty"`
+
+	// Snapshot names the VolumeSnapshot a snapshot source restores. Required
+	// for the snapshot source type.
+	// +optional
+	Snapshot *DataSyncVolumeSource `json:"snapshot,omitempty"`
+
+	// Delta syncs the disk by cloning the volume of the same VM entry of an
+	// earlier version of the workspace and applying an overlay to it, rather
+	// than downloading the whole disk. The disk is downloaded from URL as
+	// usual when no earlier version was synced. Only for the http, registry
+	// and s3 source types.
+	// +optional
+	Delta *DataSyncDeltaSource `json:"delta,omitempty"`
+
+	// Checksum is the SHA-256 of the disk as raw image, as "sha256:"
+	// followed by 64 lowercase hex digits. Once imported, the volume is
+	// hashed by a Job and a mismatch fails the import. CDI grows the disk to
+	// fill the volume, so only the virtual size of the disk is hashed, which
+	// has to be looked up from the source: checksums are only allowed for
+	// http sources, and not for images whose size cannot be looked up such
+	// as compressed ones.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^sha256:[0-9a-f]{64}$`
+	Checksum string `json:"checksum,omitempty"`
+
+	// Size is the capacity requested for the volume holding the disk.
+	// Defaults to the size reported by the source, or the policy default.
+	// Clones and restores default to the size of what they copy.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// StorageClassName is the storage class of the volume holding the disk.
+	// Defaults to the storage class of the sync policy.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// AccessMode is the access mode of the volume holding the disk.
+	// Defaults to the access mode of the sync policy.
+	// +optional
+	// +kubebuilder:validation:Enum=ReadWriteOnce;ReadOnlyMany;ReadWriteMany;ReadWriteOncePod
+	AccessMode corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+}
+
+// DataSyncSpec defines the desired state of DataSync.
+type DataSyncSpec struct {
+	// WorkspaceID is the unique identifier for the workspace to be synced.
+	// +kubebuilder:validation:MinLength=1
+	WorkspaceID string `json:"workspaceId"`
+
+	// Version identifies the version of the workspace the VM disks belong to.
+	// A workspace may have several versions in use at once.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// VMs lists the VM disks required to boot the workspace.
+	// +kubebuilder:validation:MinItems=1
+	// +listType=map
+	// +listMapKey=name
+	VMs []DataSyncVM `json:"vms"`
+
+	// PriorityClassName names a priority class of the sync policy. DataSyncs
+	// with a higher priority are admitted first, and may preempt lower
+	// priority syncs if the policy allows it. Without a class, or with a class
+	// the policy does not define, the priority is zero.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// DeletionPolicy decides what happens to the DataVolumes and PVCs when
+	// the DataSync is deleted.
+	// +optional
+	// +kubebuilder:default=Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// Suspend stops the imports of the DataSync that have not finished and
+	// keeps it from being admitted until it is set back to false. Volumes
+	// that finished are kept, and the stopped attempt does not count against
+	// the retry limit.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// DataSyncPreemption records that a sync was preempted by a more urgent one.
+type DataSyncPreemption struct {
+	// Time is when the sync was preempted.
+	Time metav1.Time `json:"time"`
+
+	// By is the namespace/name of the DataSync the sync made way for.
+	By string `json:"by"`
+
+	// Mode is how the sync was preempted, either pause or cancel.
+	Mode string `json:"mode"`
+}
+
+// DataSyncTransfer tracks the download of a VM disk.
+type DataSyncTransfer struct {
+	// Name is the name of the VM entry.
+	Name string `json:"name"`
+
+	// Host is the host the disk is downloaded from.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// TotalBytes is the expected size of the download.
+	// +optional
+	TotalBytes int64 `json:"totalBytes,omitempty"`
+
+	// Bytes is the number of bytes the current import downloaded so far.
+	// +optional
+	Bytes int64 `json:"bytes,omitempty"`
+
+	// DataVolumeUID identifies the import Bytes was reported by. A new
+	// DataVolume starts the count over.
+	// +optional
+	DataVolumeUID types.UID `json:"dataVolumeUID,omitempty"`
+}
+
+// DataSyncRejectedSecret records a Secret whose credentials a source rejected.
+type DataSyncRejectedSecret struct {
+	// Name is the name of the Secret.
+	Name string `json:"name"`
+
+	// ResourceVersion is the version of the Secret that was rejected; any
+	// other version counts as rotated.
+	// +optional
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// DataSyncStatus defines the observed state of DataSync.
+type DataSyncStatus struct {
+	// Phase is a high level summary of where the DataSync is in its lifecycle.
+	// +optional
+	Phase DataSyncPhase `json:"phase,omitempty"`
+
+	// Message is a human readable explanation of the current phase.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Conditions represent the latest available observations of the DataSync's state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the most recent generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Attempts is the number of times the operator started syncing the DataSync.
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+
+	// Preemptions is the number of times the sync was preempted. Preempted
+	// attempts do not count against the retry limit.
+	// +optional
+	Preemptions int32 `json:"preemptions,omitempty"`
+
+	// LastPreemption records the most recent preemption of the sync.
+	// +optional
+	LastPreemption *DataSyncPreemption `json:"lastPreemption,omitempty"`
+
+	// Outages is the number of attempts that failed because their source
+	// host was down. Like preempted attempts, they do not count as retries.
+	// +optional
+	Outages int32 `json:"outages,omitempty"`
+
+	// Interruptions is the number of attempts stopped because the sync
+	// windows closed. They do not count as retries either.
+	// +optional
+	Interruptions int32 `json:"interruptions,omitempty"`
+
+	// Suspensions is the number of attempts stopped because the DataSync or
+	// the sync policy was suspended. They do not count as retries either.
+	// +optional
+	Suspensions int32 `json:"suspensions,omitempty"`
+
+	// RearmedAttempts is the number of attempts forgiven when rotated
+	// credentials re-armed the DataSync. They do not count as retries either.
+	// +optional
+	RearmedAttempts int32 `json:"rearmedAttempts,omitempty"`
+
+	// RejectedSecrets lists the Secrets whose credentials the sources
+	// rejected in the last failed attempt. Rotating one of them re-arms the
+	// DataSync.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	RejectedSecrets []DataSyncRejectedSecret `json:"rejectedSecrets,omitempty"`
+
+	// EstimatedBytes is the number of bytes the next or current attempt is
+	// expected to download. VM disks that already synced are not counted.
+	// +optional
+	EstimatedBytes int64 `json:"estimatedBytes,omitempty"`
+
+	// BytesTransferred is the number of bytes downloaded for the DataSync
+	// over all of its attempts, including attempts that failed or were
+	// preempted.
+	// +optional
+	BytesTransferred int64 `json:"bytesTransferred,omitempty"`
+
+	// Transfers tracks the download of each VM disk.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Transfers []DataSyncTransfer `json:"transfers,omitempty"`
+
+	// NextRetryTime is when a failed DataSync becomes eligible to sync again.
+	// +optional
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+
+	// LastUsedTime is the last time the pruner saw a volume of the DataSync
+	// referenced by a VM, VM instance or pod.
+	// +optional
+	LastUsedTime *metav1.Time `json:"lastUsedTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Workspace",type=string,JSONPath=`.spec.workspaceId`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.spec.version`
+// +kubebuilder:printcolumn:name="Priority",type=string,JSONPath=`.spec.priorityClassName`,priority=1
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Attempts",type=integer,JSONPath=`.status.attempts`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DataSync is the Schema for the datasyncs API.
+type DataSync struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DataSyncSpec   `json:"spec,omitempty"`
+	Status DataSyncStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DataSyncList contains a list of DataSync.
+type DataSyncList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DataSync `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DataSync{}, &DataSyncList{})
+}
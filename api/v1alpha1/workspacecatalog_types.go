@@ -0,0 +1,160 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LabelCatalog is set on the DataSyncs a WorkspaceCatalog generated and holds
+// its name.
+const LabelCatalog = "pelotech.ot/catalog"
+
+// CatalogSourceType identifies where a WorkspaceCatalog reads its index from.
+// +kubebuilder:validation:Enum=http;oci
+type CatalogSourceType string
+
+const (
+	// CatalogSourceTypeHTTP reads the index from a JSON or YAML file served
+	// over http or https.
+	CatalogSourceTypeHTTP CatalogSourceType = "http"
+	// CatalogSourceTypeOCI reads the index from the first layer of an OCI
+	// artifact in a registry.
+	CatalogSourceTypeOCI CatalogSourceType = "oci"
+)
+
+// WorkspaceCatalogSource points at the index of a WorkspaceCatalog.
+type WorkspaceCatalogSource struct {
+	// Type is the kind of source the index is read from.
+	Type CatalogSourceType `json:"type"`
+
+	// URL locates the index: an http or https URL for http, or a reference
+	// such as oci://ghcr.io/pelotech/workspaces:stable for oci.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// SecretRef names a Secret in the namespace of the WorkspaceCatalog with
+	// the credentials of the source: username and password for basic auth,
+	// or token for a bearer token.
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	SecretRef string `json:"secretRef,omitempty"`
+}
+
+// WorkspaceCatalogSpec defines the desired state of WorkspaceCatalog.
+type WorkspaceCatalogSpec struct {
+	// Source is where the index listing the workspace versions is read from.
+	// The index is a document with a workspaces list, each entry of which is
+	// the spec of the DataSync syncing one workspace version.
+	Source WorkspaceCatalogSource `json:"source"`
+
+	// PollInterval is how often the index is checked for changes.
+	// +optional
+	// +kubebuilder:default="5m"
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+
+	// Workspaces limits the catalog to these workspace IDs. Every workspace
+	// of the index is synced if empty.
+	// +optional
+	Workspaces []string `json:"workspaces,omitempty"`
+}
+
+// WorkspaceCatalogEntry records a workspace version of the index and the
+// DataSync generated for it.
+type WorkspaceCatalogEntry struct {
+	// WorkspaceID is the workspace of the entry.
+	WorkspaceID string `json:"workspaceId"`
+
+	// Version is the workspace version of the entry.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// DataSync is the name of the DataSync generated for the entry.
+	DataSync string `json:"dataSync"`
+
+	// Digest is the digest of the entry the DataSync was last generated
+	// from. An entry that has not changed since is not applied again, so a
+	// DataSync the pruner deleted stays deleted.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+
+	// Error explains why the DataSync could not be generated.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// WorkspaceCatalogStatus defines the observed state of WorkspaceCatalog.
+type WorkspaceCatalogStatus struct {
+	// Conditions represent the latest available observations of the
+	// WorkspaceCatalog's state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the most recent generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// ETag is the entity tag the source returned with the index, sent back
+	// on the next poll so an unchanged index is not downloaded again.
+	// +optional
+	ETag string `json:"etag,omitempty"`
+
+	// IndexDigest is the SHA-256 digest of the index last applied. An index
+	// with the same digest is not applied again.
+	// +optional
+	IndexDigest string `json:"indexDigest,omitempty"`
+
+	// LastPollTime is when the index was last checked.
+	// +optional
+	LastPollTime *metav1.Time `json:"lastPollTime,omitempty"`
+
+	// Workspaces lists the workspace versions of the index.
+	// +optional
+	Workspaces []WorkspaceCatalogEntry `json:"workspaces,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.spec.source.url`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Last Poll",type=date,JSONPath=`.status.lastPollTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// WorkspaceCatalog is the Schema for the workspacecatalogs API. It polls an
+// index of workspace versions and keeps a DataSync for each of them.
+type WorkspaceCatalog struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WorkspaceCatalogSpec   `json:"spec,omitempty"`
+	Status WorkspaceCatalogStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// WorkspaceCatalogList contains a list of WorkspaceCatalog.
+type WorkspaceCatalogList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WorkspaceCatalog `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WorkspaceCatalog{}, &WorkspaceCatalogList{})
+}
@@ -0,0 +1,474 @@
+//go:build !ignore_autogenerated
+
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSync) DeepCopyInto(out *DataSync) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSync.
+func (in *DataSync) DeepCopy() *DataSync {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSync)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DataSync) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncDeltaSource) DeepCopyInto(out *DataSyncDeltaSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncDeltaSource.
+func (in *DataSyncDeltaSource) DeepCopy() *DataSyncDeltaSource {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncDeltaSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncHTTPHeader) DeepCopyInto(out *DataSyncHTTPHeader) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncHTTPHeader.
+func (in *DataSyncHTTPHeader) DeepCopy() *DataSyncHTTPHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncHTTPHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncHTTPSource) DeepCopyInto(out *DataSyncHTTPSource) {
+	*out = *in
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make([]DataSyncHTTPHeader, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncHTTPSource.
+func (in *DataSyncHTTPSource) DeepCopy() *DataSyncHTTPSource {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncHTTPSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncList) DeepCopyInto(out *DataSyncList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DataSync, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncList.
+func (in *DataSyncList) DeepCopy() *DataSyncList {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DataSyncList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncPreemption) DeepCopyInto(out *DataSyncPreemption) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncPreemption.
+func (in *DataSyncPreemption) DeepCopy() *DataSyncPreemption {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncPreemption)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncRegistrySource) DeepCopyInto(out *DataSyncRegistrySource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncRegistrySource.
+func (in *DataSyncRegistrySource) DeepCopy() *DataSyncRegistrySource {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncRegistrySource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncRejectedSecret) DeepCopyInto(out *DataSyncRejectedSecret) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncRejectedSecret.
+func (in *DataSyncRejectedSecret) DeepCopy() *DataSyncRejectedSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncRejectedSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncSpec) DeepCopyInto(out *DataSyncSpec) {
+	*out = *in
+	if in.VMs != nil {
+		in, out := &in.VMs, &out.VMs
+		*out = make([]DataSyncVM, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncSpec.
+func (in *DataSyncSpec) DeepCopy() *DataSyncSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncStatus) DeepCopyInto(out *DataSyncStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastPreemption != nil {
+		in, out := &in.LastPreemption, &out.LastPreemption
+		*out = new(DataSyncPreemption)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RejectedSecrets != nil {
+		in, out := &in.RejectedSecrets, &out.RejectedSecrets
+		*out = make([]DataSyncRejectedSecret, len(*in))
+		copy(*out, *in)
+	}
+	if in.Transfers != nil {
+		in, out := &in.Transfers, &out.Transfers
+		*out = make([]DataSyncTransfer, len(*in))
+		copy(*out, *in)
+	}
+	if in.NextRetryTime != nil {
+		in, out := &in.NextRetryTime, &out.NextRetryTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastUsedTime != nil {
+		in, out := &in.LastUsedTime, &out.LastUsedTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncStatus.
+func (in *DataSyncStatus) DeepCopy() *DataSyncStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncTransfer) DeepCopyInto(out *DataSyncTransfer) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncTransfer.
+func (in *DataSyncTransfer) DeepCopy() *DataSyncTransfer {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncTransfer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncVM) DeepCopyInto(out *DataSyncVM) {
+	*out = *in
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(DataSyncHTTPSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Registry != nil {
+		in, out := &in.Registry, &out.Registry
+		*out = new(DataSyncRegistrySource)
+		**out = **in
+	}
+	if in.PVC != nil {
+		in, out := &in.PVC, &out.PVC
+		*out = new(DataSyncVolumeSource)
+		**out = **in
+	}
+	if in.Snapshot != nil {
+		in, out := &in.Snapshot, &out.Snapshot
+		*out = new(DataSyncVolumeSource)
+		**out = **in
+	}
+	if in.Delta != nil {
+		in, out := &in.Delta, &out.Delta
+		*out = new(DataSyncDeltaSource)
+		**out = **in
+	}
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncVM.
+func (in *DataSyncVM) DeepCopy() *DataSyncVM {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncVM)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSyncVolumeSource) DeepCopyInto(out *DataSyncVolumeSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSyncVolumeSource.
+func (in *DataSyncVolumeSource) DeepCopy() *DataSyncVolumeSource {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSyncVolumeSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceCatalog) DeepCopyInto(out *WorkspaceCatalog) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceCatalog.
+func (in *WorkspaceCatalog) DeepCopy() *WorkspaceCatalog {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceCatalog)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WorkspaceCatalog) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceCatalogEntry) DeepCopyInto(out *WorkspaceCatalogEntry) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceCatalogEntry.
+func (in *WorkspaceCatalogEntry) DeepCopy() *WorkspaceCatalogEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceCatalogEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceCatalogList) DeepCopyInto(out *WorkspaceCatalogList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]WorkspaceCatalog, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceCatalogList.
+func (in *WorkspaceCatalogList) DeepCopy() *WorkspaceCatalogList {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceCatalogList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WorkspaceCatalogList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceCatalogSource) DeepCopyInto(out *WorkspaceCatalogSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceCatalogSource.
+func (in *WorkspaceCatalogSource) DeepCopy() *WorkspaceCatalogSource {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceCatalogSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceCatalogSpec) DeepCopyInto(out *WorkspaceCatalogSpec) {
+	*out = *in
+	out.Source = in.Source
+	if in.PollInterval != nil {
+		in, out := &in.PollInterval, &out.PollInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Workspaces != nil {
+		in, out := &in.Workspaces, &out.Workspaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceCatalogSpec.
+func (in *WorkspaceCatalogSpec) DeepCopy() *WorkspaceCatalogSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceCatalogSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceCatalogStatus) DeepCopyInto(out *WorkspaceCatalogStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastPollTime != nil {
+		in, out := &in.LastPollTime, &out.LastPollTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Workspaces != nil {
+		in, out := &in.Workspaces, &out.Workspaces
+		*out = make([]WorkspaceCatalogEntry, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceCatalogStatus.
+func (in *WorkspaceCatalogStatus) DeepCopy() *WorkspaceCatalogStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceCatalogStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -21,21 +21,39 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/breaker"
+	"pelotech/ot-sync-operator/internal/catalog"
+	"pelotech/ot-sync-operator/internal/controller"
+	"pelotech/ot-sync-operator/internal/egress"
+	"pelotech/ot-sync-operator/internal/pipeline"
+	"pelotech/ot-sync-operator/internal/policy"
+	"pelotech/ot-sync-operator/internal/preflight"
+	"pelotech/ot-sync-operator/internal/pruner"
+	"pelotech/ot-sync-operator/internal/queue"
+	"pelotech/ot-sync-operator/internal/retry"
+	webhookv1 "pelotech/ot-sync-operator/internal/webhook/v1"
+	webhookv1alpha1 "pelotech/ot-sync-operator/internal/webhook/v1alpha1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -47,6 +65,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(otv1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -54,9 +73,15 @@ func init() {
 func main() {
 	var metricsAddr string
 	var metricsCertPath, metricsCertName, metricsCertKey string
+	var pipelineAddr string
+	var pipelineCertPath, pipelineCertName, pipelineCertKey string
+	var pipelineAudience string
 	var webhookCertPath, webhookCertName, webhookCertKey string
 	var enableLeaderElection bool
 	var probeAddr string
+	var policyNamespace string
+	var checksumImage string
+	var deltaImage string
 	var secureMetrics bool
 	var enableHTTP2 bool
 	var tlsOpts []func(*tls.Config)
@@ -75,8 +100,23 @@ func main() {
 		"The directory that contains the metrics server certificate.")
 	flag.StringVar(&metricsCertName, "metrics-cert-name", "tls.crt", "The name of the metrics server certificate file.")
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
+	flag.StringVar(&pipelineAddr, "pipeline-bind-address", "0", "The address the pipeline API binds to. "+
+		"Use :8444 to serve it over HTTPS, or leave as 0 to disable it.")
+	flag.StringVar(&pipelineCertPath, "pipeline-cert-path", "",
+		"The directory that contains the pipeline API certificate. A self-signed one is generated if empty.")
+	flag.StringVar(&pipelineCertName, "pipeline-cert-name", "tls.crt", "The name of the pipeline API certificate file.")
+	flag.StringVar(&pipelineCertKey, "pipeline-cert-key", "tls.key", "The name of the pipeline API key file.")
+	flag.StringVar(&pipelineAudience, "pipeline-audience", pipeline.DefaultAudience,
+		"The audience the tokens of pipeline API callers have to be issued for.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
-		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+		"If set, HTTP/2 will be enabled for the metrics, webhook and pipeline API servers")
+	flag.StringVar(&policyNamespace, "policy-namespace", os.Getenv("POD_NAMESPACE"),
+		"The namespace holding the "+policy.ConfigMapName+" ConfigMap. Defaults to the namespace of the operator.")
+	flag.StringVar(&checksumImage, "checksum-image", controller.DefaultVerifierImage,
+		"The image of the Jobs that verify the checksums of synced disks. It must provide sh and sha256sum.")
+	flag.StringVar(&deltaImage, "delta-image", "",
+		"The image of the Jobs that apply deltas to clones of earlier workspace versions. "+
+			"It must provide sh, curl and qemu-img. Delta sync is disabled if empty.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -85,6 +125,11 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if policyNamespace == "" {
+		setupLog.Error(nil, "the policy namespace must be set with --policy-namespace or POD_NAMESPACE")
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -100,8 +145,8 @@ func main() {
 		tlsOpts = append(tlsOpts, disableHTTP2)
 	}
 
-	// Create watchers for metrics and webhooks certificates
-	var metricsCertWatcher, webhookCertWatcher *certwatcher.CertWatcher
+	// Create watchers for metrics, webhooks and pipeline API certificates
+	var metricsCertWatcher, webhookCertWatcher, pipelineCertWatcher *certwatcher.CertWatcher
 
 	// Initial webhook TLS options
 	webhookTLSOpts := tlsOpts
@@ -174,11 +219,40 @@ func main() {
 		})
 	}
 
+	pipelineTLSOpts := tlsOpts
+	if pipelineAddr != "0" && len(pipelineCertPath) > 0 {
+		setupLog.Info("Initializing pipeline API certificate watcher using provided certificates",
+			"pipeline-cert-path", pipelineCertPath, "pipeline-cert-name", pipelineCertName, "pipeline-cert-key", pipelineCertKey)
+
+		var err error
+		pipelineCertWatcher, err = certwatcher.New(
+			filepath.Join(pipelineCertPath, pipelineCertName),
+			filepath.Join(pipelineCertPath, pipelineCertKey),
+		)
+		if err != nil {
+			setupLog.Error(err, "Failed to initialize pipeline API certificate watcher")
+			os.Exit(1)
+		}
+
+		pipelineTLSOpts = append(pipelineTLSOpts, func(config *tls.Config) {
+			config.GetCertificate = pipelineCertWatcher.GetCertificate
+		})
+	}
+
+	// The only ConfigMaps the operator reads are its policy and egress
+	// ledger, so avoid caching every ConfigMap in the cluster.
+	cacheOptions := cache.Options{
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.ConfigMap{}: {Namespaces: map[string]cache.Config{policyNamespace: {}}},
+		},
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
+		Cache:                  cacheOptions,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "1f5c5280.pelotech.ot",
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
@@ -198,6 +272,86 @@ func main() {
 		os.Exit(1)
 	}
 
+	policyStore := policy.NewStore()
+	if err := (&policy.Reconciler{
+		Client:    mgr.GetClient(),
+		Recorder:  mgr.GetEventRecorderFor("sync-operator-policy"),
+		Store:     policyStore,
+		Namespace: policyNamespace,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Policy")
+		os.Exit(1)
+	}
+	admissionQueue := queue.New(mgr.GetAPIReader(), policyStore)
+	if err := mgr.Add(admissionQueue); err != nil {
+		setupLog.Error(err, "unable to add admission queue to manager")
+		os.Exit(1)
+	}
+	egressLedger := egress.NewLedger(mgr.GetClient(), mgr.GetAPIReader(), policyNamespace)
+	if err := mgr.Add(egressLedger); err != nil {
+		setupLog.Error(err, "unable to add egress ledger to manager")
+		os.Exit(1)
+	}
+	sizer := preflight.NewHTTPSizer(10 * time.Second)
+	if err := (&controller.DataSyncReconciler{
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		Recorder:      mgr.GetEventRecorderFor("datasync-controller"),
+		Queue:         admissionQueue,
+		Policy:        policyStore,
+		RetryBudget:   retry.NewBudget(),
+		Preflight:     sizer,
+		Sizer:         sizer,
+		Reader:        mgr.GetAPIReader(),
+		Egress:        egressLedger,
+		Breakers:      breaker.New(),
+		VerifierImage: checksumImage,
+		DeltaImage:    deltaImage,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DataSync")
+		os.Exit(1)
+	}
+	if err := (&controller.WorkspaceCatalogReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("workspacecatalog-controller"),
+		Reader:   mgr.GetAPIReader(),
+		Fetcher:  catalog.NewFetcher(30 * time.Second),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "WorkspaceCatalog")
+		os.Exit(1)
+	}
+	if err := mgr.Add(&pruner.Pruner{
+		Client:   mgr.GetClient(),
+		Reader:   mgr.GetAPIReader(),
+		Recorder: mgr.GetEventRecorderFor("pruner"),
+		Policy:   policyStore,
+	}); err != nil {
+		setupLog.Error(err, "unable to add pruner to manager")
+		os.Exit(1)
+	}
+	if pipelineAddr != "0" {
+		if err := mgr.Add(&pipeline.Server{
+			BindAddress: pipelineAddr,
+			Client:      mgr.GetClient(),
+			TLSOpts:     pipelineTLSOpts,
+			Audience:    pipelineAudience,
+		}); err != nil {
+			setupLog.Error(err, "unable to add pipeline API to manager")
+			os.Exit(1)
+		}
+	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := webhookv1alpha1.SetupDataSyncWebhookWithManager(mgr, policyStore); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DataSync")
+			os.Exit(1)
+		}
+		if err := webhookv1.SetupVirtualMachineWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "VirtualMachine")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if metricsCertWatcher != nil {
@@ -216,6 +370,14 @@ func main() {
 		}
 	}
 
+	if pipelineCertWatcher != nil {
+		setupLog.Info("Adding pipeline API certificate watcher to manager")
+		if err := mgr.Add(pipelineCertWatcher); err != nil {
+			setupLog.Error(err, "unable to add pipeline API certificate watcher to manager")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -0,0 +1,210 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package breaker implements circuit breakers keyed by source host, so
+// DataSyncs stop failing and burning retries against a host that is down.
+package breaker
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// State is the state of the circuit of a host.
+type State int
+
+const (
+	// Closed lets every DataSync download from the host.
+	Closed State = iota
+	// HalfOpen lets a single DataSync probe whether the host recovered.
+	HalfOpen
+	// Open keeps DataSyncs from downloading from the host.
+	Open
+)
+
+// String returns the name of the state used in metrics and messages.
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// hostFailure matches import errors that point at the source host rather
+// than at the DataSync, such as server errors and timeouts.
+var hostFailure = regexp.MustCompile(`(?i)(status code:? 5\d\d|got 5\d\d|\b5\d\d (internal server error|bad gateway|service unavailable|gateway timeout)|timeout|timed out|deadline exceeded|connection refused|connection reset|no such host)`)
+
+// HostFailure reports whether an import failed because of its source host.
+func HostFailure(message string) bool {
+	return hostFailure.MatchString(message)
+}
+
+// circuit is the breaker of a single host.
+type circuit struct {
+	state    State
+	failures int
+	openedAt time.Time
+	// probe is the DataSync allowed through while the circuit is half-open.
+	probe types.NamespacedName
+}
+
+// Breakers holds the circuits of every source host. Circuits start closed
+// and open once imports from their host failed threshold times in a row.
+// After the cooldown a single DataSync probes the host: its success closes
+// the circuit and its failure opens it again.
+//
+// Circuits are kept in memory by the leader; a new leader starts with every
+// circuit closed.
+type Breakers struct {
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+// New returns Breakers with every circuit closed.
+func New() *Breakers {
+	return &Breakers{hosts: map[string]*circuit{}}
+}
+
+// Acquire reports whether key may start downloading from hosts at now and,
+// if not, why. While a circuit is half-open the first DataSync to ask becomes
+// its probe; it keeps that role until Release or the outcome of its sync.
+// The returned transitions list the hosts whose circuit became half-open.
+func (b *Breakers) Acquire(key types.NamespacedName, hosts []string, now time.Time, cooldown time.Duration) (bool, string, []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var halfOpened []string
+	for _, host := range hosts {
+		c, ok := b.hosts[host]
+		if !ok {
+			continue
+		}
+		if c.state == Open && !now.Before(c.openedAt.Add(cooldown)) {
+			b.transition(host, c, HalfOpen)
+			halfOpened = append(halfOpened, host)
+		}
+		switch {
+		case c.state == Open:
+			return false, fmt.Sprintf("Source host %s is unavailable after %d consecutive failures; probing it again at %s.",
+				host, c.failures, c.openedAt.Add(cooldown).UTC().Format(time.RFC3339)), halfOpened
+		case c.state == HalfOpen && c.probe != (types.NamespacedName{}) && c.probe != key:
+			return false, fmt.Sprintf("Source host %s is being probed by %s after an outage.", host, c.probe), halfOpened
+		}
+	}
+
+	for _, host := range hosts {
+		if c, ok := b.hosts[host]; ok && c.state == HalfOpen {
+			c.probe = key
+		}
+	}
+	return true, "", halfOpened
+}
+
+// Release gives up the probes held by key, e.g. once it was not admitted or
+// was deleted, so another DataSync may probe instead.
+func (b *Breakers) Release(key types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.hosts {
+		if c.probe == key {
+			c.probe = types.NamespacedName{}
+		}
+	}
+}
+
+// Failure records that an import of key from host failed because of the
+// host. It returns the state of the circuit and whether the failure opened
+// it. A threshold of zero disables the breaker.
+func (b *Breakers) Failure(key types.NamespacedName, host string, now time.Time, threshold int) (State, bool) {
+	if threshold <= 0 {
+		return Closed, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	if !ok {
+		c = &circuit{}
+		b.hosts[host] = c
+	}
+	c.failures++
+	if c.probe == key {
+		c.probe = types.NamespacedName{}
+	}
+	if c.state == Open {
+		return Open, false
+	}
+	// A failed probe opens the circuit again straight away.
+	if c.state == HalfOpen || c.failures >= threshold {
+		c.openedAt = now
+		b.transition(host, c, Open)
+		return Open, true
+	}
+	return c.state, false
+}
+
+// Success records that key downloaded from hosts. It returns the hosts whose
+// circuit it closed.
+func (b *Breakers) Success(key types.NamespacedName, hosts []string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var closed []string
+	for _, host := range hosts {
+		c, ok := b.hosts[host]
+		if !ok {
+			continue
+		}
+		// DataSyncs that started before the circuit opened may still finish;
+		// only the probe proves the host recovered.
+		if c.state != Closed && c.probe != key {
+			continue
+		}
+		if c.state != Closed {
+			closed = append(closed, host)
+			circuitState.WithLabelValues(host).Set(float64(Closed))
+			transitions.WithLabelValues(host, Closed.String()).Inc()
+		}
+		delete(b.hosts, host)
+	}
+	return closed
+}
+
+// State returns the state of the circuit of host.
+func (b *Breakers) State(host string) State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.hosts[host]; ok {
+		return c.state
+	}
+	return Closed
+}
+
+// transition moves c to state. The caller must hold the lock.
+func (b *Breakers) transition(host string, c *circuit, state State) {
+	c.state = state
+	c.probe = types.NamespacedName{}
+	circuitState.WithLabelValues(host).Set(float64(state))
+	transitions.WithLabelValues(host, state.String()).Inc()
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breaker
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Breakers", func() {
+	const (
+		host      = "mirror.example.com"
+		threshold = 3
+		cooldown  = 10 * time.Minute
+	)
+
+	var (
+		now    = time.Date(2025, 7, 11, 20, 0, 0, 0, time.UTC)
+		first  = types.NamespacedName{Namespace: "default", Name: "first"}
+		second = types.NamespacedName{Namespace: "default", Name: "second"}
+	)
+
+	It("should open after consecutive failures and probe after the cooldown", func() {
+		b := New()
+		for range threshold - 1 {
+			state, opened := b.Failure(first, host, now, threshold)
+			Expect(state).To(Equal(Closed))
+			Expect(opened).To(BeFalse())
+		}
+		state, opened := b.Failure(first, host, now, threshold)
+		Expect(state).To(Equal(Open))
+		Expect(opened).To(BeTrue())
+
+		ok, reason, _ := b.Acquire(first, []string{host}, now.Add(time.Minute), cooldown)
+		Expect(ok).To(BeFalse())
+		Expect(reason).To(Equal("Source host mirror.example.com is unavailable after 3 consecutive failures; " +
+			"probing it again at 2025-07-11T20:10:00Z."))
+
+		// Once the cooldown is over a single DataSync probes the host.
+		ok, _, halfOpened := b.Acquire(first, []string{host}, now.Add(cooldown), cooldown)
+		Expect(ok).To(BeTrue())
+		Expect(halfOpened).To(ConsistOf(host))
+		ok, reason, _ = b.Acquire(second, []string{host}, now.Add(cooldown), cooldown)
+		Expect(ok).To(BeFalse())
+		Expect(reason).To(Equal("Source host mirror.example.com is being probed by default/first after an outage."))
+
+		// Only the probe closes the circuit.
+		Expect(b.Success(second, []string{host})).To(BeEmpty())
+		Expect(b.Success(first, []string{host})).To(ConsistOf(host))
+		Expect(b.State(host)).To(Equal(Closed))
+		ok, _, _ = b.Acquire(second, []string{host}, now.Add(cooldown), cooldown)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should open again when the probe fails", func() {
+		b := New()
+		for range threshold {
+			b.Failure(first, host, now, threshold)
+		}
+		later := now.Add(cooldown)
+		ok, _, _ := b.Acquire(first, []string{host}, later, cooldown)
+		Expect(ok).To(BeTrue())
+		state, opened := b.Failure(first, host, later, threshold)
+		Expect(state).To(Equal(Open))
+		Expect(opened).To(BeTrue())
+		ok, _, _ = b.Acquire(second, []string{host}, later.Add(time.Minute), cooldown)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should hand the probe to another DataSync once released", func() {
+		b := New()
+		for range threshold {
+			b.Failure(first, host, now, threshold)
+		}
+		ok, _, _ := b.Acquire(first, []string{host}, now.Add(cooldown), cooldown)
+		Expect(ok).To(BeTrue())
+		b.Release(first)
+		ok, _, _ = b.Acquire(second, []string{host}, now.Add(cooldown), cooldown)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should reset the count of failures on success", func() {
+		b := New()
+		for range threshold - 1 {
+			b.Failure(first, host, now, threshold)
+		}
+		b.Success(second, []string{host})
+		state, _ := b.Failure(first, host, now, threshold)
+		Expect(state).To(Equal(Closed))
+	})
+
+	It("should stay closed when disabled", func() {
+		b := New()
+		for range 10 {
+			state, _ := b.Failure(first, host, now, 0)
+			Expect(state).To(Equal(Closed))
+		}
+	})
+
+	It("should only blame the host for server errors and timeouts", func() {
+		Expect(HostFailure("Unable to connect to http data source: expected status code 200, got 503. " +
+			"Status: 503 Service Unavailable")).To(BeTrue())
+		Expect(HostFailure("Get \"https://mirror.example.com/disk.qcow2\": dial tcp: i/o timeout")).To(BeTrue())
+		Expect(HostFailure("Unable to connect to http data source: expected status code 200, got 404. " +
+			"Status: 404 Not Found")).To(BeFalse())
+		Expect(HostFailure("")).To(BeFalse())
+	})
+})
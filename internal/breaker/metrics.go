@@ -0,0 +1,40 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breaker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// circuitState is the state of the circuit of each source host.
+	circuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ot_sync_circuit_state",
+		Help: "State of the circuit breaker of a source host: 0 closed, 1 half-open, 2 open.",
+	}, []string{"host"})
+
+	// transitions counts the state changes of the circuits.
+	transitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ot_sync_circuit_transitions_total",
+		Help: "Number of times the circuit breaker of a source host entered a state.",
+	}, []string{"host", "state"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(circuitState, transitions)
+}
@@ -0,0 +1,373 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package catalog reads the indexes of WorkspaceCatalogs from web servers and
+// OCI registries.
+package catalog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+)
+
+// maxIndexBytes bounds the size of an index.
+const maxIndexBytes = 8 << 20
+
+// Index is the document a WorkspaceCatalog points at. Each workspace version
+// it lists is the spec of the DataSync syncing it.
+type Index struct {
+	Workspaces []otv1alpha1.DataSyncSpec `json:"workspaces"`
+}
+
+// Parse reads an index from JSON or YAML. Unknown fields are rejected so
+// typos in the index do not go unnoticed.
+func Parse(data []byte) (*Index, error) {
+	index := &Index{}
+	if err := yaml.UnmarshalStrict(data, index); err != nil {
+		return nil, fmt.Errorf("invalid index: %w", err)
+	}
+	return index, nil
+}
+
+// Credentials authenticate the requests to a source, either with basic auth
+// or with a bearer token.
+type Credentials struct {
+	Username string
+	Password string
+	Token    string
+}
+
+// Fetched is the result of fetching an index.
+type Fetched struct {
+	// Data is the index, or nil if it did not change.
+	Data []byte
+	// ETag identifies the version of the index fetched, to be passed to the
+	// next fetch.
+	ETag string
+}
+
+// Fetcher fetches indexes.
+type Fetcher struct {
+	Client *http.Client
+}
+
+// NewFetcher returns a Fetcher whose requests give up after timeout.
+func NewFetcher(timeout time.Duration) *Fetcher {
+	return &Fetcher{Client: &http.Client{Timeout: timeout}}
+}
+
+// Fetch fetches the index of a source unless it is still the version
+// identified by etag, in which case the returned Data is nil.
+func (f *Fetcher) Fetch(ctx context.Context, source otv1alpha1.WorkspaceCatalogSource, creds Credentials, etag string) (*Fetched, error) {
+	switch source.Type {
+	case otv1alpha1.CatalogSourceTypeHTTP:
+		return f.fetchHTTP(ctx, source.URL, creds, etag)
+	case otv1alpha1.CatalogSourceTypeOCI:
+		return f.fetchOCI(ctx, source.URL, creds, etag)
+	default:
+		return nil, fmt.Errorf("unsupported source type %q", source.Type)
+	}
+}
+
+// fetchHTTP fetches an index served over http, letting the server answer
+// Not Modified for the version identified by etag.
+func (f *Fetcher) fetchHTTP(ctx context.Context, rawURL string, creds Credentials, etag string) (*Fetched, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("the URL of an http source must be http or https, not %q", u.Scheme)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	creds.authorize(req)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return &Fetched{ETag: etag}, nil
+	case http.StatusOK:
+		data, err := readBody(resp)
+		if err != nil {
+			return nil, err
+		}
+		return &Fetched{Data: data, ETag: resp.Header.Get("ETag")}, nil
+	default:
+		return nil, fmt.Errorf("fetching %s: %s", rawURL, resp.Status)
+	}
+}
+
+// ociManifestTypes are the manifest media types accepted from registries.
+var ociManifestTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ociManifest is the part of an OCI image manifest that locates the index.
+type ociManifest struct {
+	Layers []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"layers"`
+}
+
+// fetchOCI fetches the index stored as the first layer of an OCI artifact,
+// referenced as oci://registry/repository:tag or @digest. The digest of the
+// manifest identifies the version of the index, so an unchanged artifact
+// costs a single manifest request.
+func (f *Fetcher) fetchOCI(ctx context.Context, ref string, creds Credentials, etag string) (*Fetched, error) {
+	registry, repository, reference, err := parseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	session := &ociSession{client: f.Client, creds: creds}
+	base := "https://" + registry + "/v2/" + repository
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/manifests/"+reference, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(ociManifestTypes, ", "))
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := session.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotModified {
+		return &Fetched{ETag: etag}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching the manifest of %s: %s", ref, resp.Status)
+	}
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	version := resp.Header.Get("Docker-Content-Digest")
+	if version == "" {
+		version = digestOf(data)
+	}
+	// Not every registry honors If-None-Match.
+	if version == etag {
+		return &Fetched{ETag: etag}, nil
+	}
+	manifest := &ociManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest for %s: %w", ref, err)
+	}
+	if len(manifest.Layers) == 0 {
+		return nil, fmt.Errorf("the artifact %s has no layers", ref)
+	}
+
+	layer := manifest.Layers[0].Digest
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, base+"/blobs/"+layer, nil)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := session.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = blob.Body.Close() }()
+	if blob.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching the index of %s: %s", ref, blob.Status)
+	}
+	index, err := readBody(blob)
+	if err != nil {
+		return nil, err
+	}
+	if digestOf(index) != layer {
+		return nil, fmt.Errorf("the index of %s does not match its digest %s", ref, layer)
+	}
+	return &Fetched{Data: index, ETag: version}, nil
+}
+
+// parseReference splits oci://registry/repository:tag or @digest into its
+// parts. The tag defaults to latest.
+func parseReference(ref string) (registry, repository, reference string, err error) {
+	rest, ok := strings.CutPrefix(ref, "oci://")
+	if !ok {
+		return "", "", "", fmt.Errorf("the URL of an oci source must start with oci://, got %q", ref)
+	}
+	registry, path, ok := strings.Cut(rest, "/")
+	if !ok || registry == "" || path == "" {
+		return "", "", "", fmt.Errorf("%q does not name a repository", ref)
+	}
+	if repository, reference, ok = strings.Cut(path, "@"); ok {
+		return registry, repository, reference, nil
+	}
+	// A colon after the last slash separates the tag.
+	if i := strings.LastIndex(path, ":"); i > strings.LastIndex(path, "/") {
+		return registry, path[:i], path[i+1:], nil
+	}
+	return registry, path, "latest", nil
+}
+
+// ociSession sends requests to a registry, answering its authentication
+// challenges and reusing the token it obtained.
+type ociSession struct {
+	client *http.Client
+	creds  Credentials
+	token  string
+}
+
+// do sends req, authenticating if the registry asks for it.
+func (s *ociSession) do(req *http.Request) (*http.Response, error) {
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || s.token != "" {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	_ = resp.Body.Close()
+
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		if s.token, err = s.requestToken(req.Context(), parseChallenge(params)); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	case "basic":
+		if s.creds.Username == "" {
+			return nil, errors.New("the registry requires credentials")
+		}
+		req.SetBasicAuth(s.creds.Username, s.creds.Password)
+	default:
+		return nil, fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	return s.client.Do(req)
+}
+
+// requestToken obtains a bearer token from the token service named by a
+// challenge, with the credentials of the session if there are any.
+func (s *ociSession) requestToken(ctx context.Context, challenge map[string]string) (string, error) {
+	realm, err := url.Parse(challenge["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid token realm %q", challenge["realm"])
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if challenge[key] != "" {
+			query.Set(key, challenge[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	s.creds.authorize(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("requesting a registry token: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxIndexBytes)).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid registry token: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", errors.New("the registry returned no token")
+	}
+	return token.Token, nil
+}
+
+// parseChallenge parses the key="value" parameters of an authentication
+// challenge.
+func parseChallenge(params string) map[string]string {
+	parsed := map[string]string{}
+	for params != "" {
+		key, rest, ok := strings.Cut(strings.TrimLeft(params, " ,"), "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		parsed[strings.ToLower(strings.TrimSpace(key))] = value
+		params = rest
+	}
+	return parsed
+}
+
+// authorize sets the credentials on req, if there are any.
+func (c Credentials) authorize(req *http.Request) {
+	switch {
+	case c.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.Username != "":
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+// readBody reads the body of a response up to maxIndexBytes.
+func readBody(resp *http.Response) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxIndexBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxIndexBytes {
+		return nil, fmt.Errorf("%s is larger than %d bytes", resp.Request.URL, maxIndexBytes)
+	}
+	return data, nil
+}
+
+// digestOf returns the OCI digest of data.
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
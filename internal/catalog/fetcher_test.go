@@ -0,0 +1,147 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+)
+
+const index = `workspaces:
+- workspaceId: "035"
+  version: 1.4.0
+  vms:
+  - name: controller
+    url: https://mirror.example.com/workspaces/035/controller.qcow2
+    sourceType: http
+`
+
+var _ = Describe("Fetcher", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("should parse indexes and reject unknown fields", func() {
+		parsed, err := Parse([]byte(index))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Workspaces).To(HaveLen(1))
+		Expect(parsed.Workspaces[0].VMs[0].SourceType).To(Equal(otv1alpha1.SourceTypeHTTP))
+
+		_, err = Parse([]byte(strings.Replace(index, "workspaceId", "workspace", 1)))
+		Expect(err).To(MatchError(ContainSubstring("unknown field")))
+	})
+
+	It("should not download an http index again while its ETag matches", func() {
+		downloads := 0
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, password, _ := r.BasicAuth(); user != "ci" || password != "s3cret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			downloads++
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = fmt.Fprint(w, index)
+		}))
+		DeferCleanup(server.Close)
+		f := &Fetcher{Client: server.Client()}
+		source := otv1alpha1.WorkspaceCatalogSource{Type: otv1alpha1.CatalogSourceTypeHTTP, URL: server.URL + "/index.yaml"}
+		creds := Credentials{Username: "ci", Password: "s3cret"}
+
+		fetched, err := f.Fetch(ctx, source, creds, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(fetched.Data)).To(Equal(index))
+		Expect(fetched.ETag).To(Equal(`"v1"`))
+
+		fetched, err = f.Fetch(ctx, source, creds, fetched.ETag)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetched.Data).To(BeNil())
+		Expect(downloads).To(Equal(1))
+
+		_, err = f.Fetch(ctx, source, Credentials{}, "")
+		Expect(err).To(MatchError(ContainSubstring("401")))
+	})
+
+	It("should fetch the index of an OCI artifact with a registry token", func() {
+		layer := digestOf([]byte(index))
+		manifest := fmt.Sprintf(`{"schemaVersion": 2, "layers": [{"mediaType": "application/yaml", "digest": %q}]}`, layer)
+		var server *httptest.Server
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/token" {
+				Expect(r.URL.Query().Get("scope")).To(Equal("repository:pelotech/workspaces:pull"))
+				_, _ = fmt.Fprint(w, `{"token": "registry-token"}`)
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer registry-token" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+					`Bearer realm="%s/token",service="registry",scope="repository:pelotech/workspaces:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch r.URL.Path {
+			case "/v2/pelotech/workspaces/manifests/stable":
+				w.Header().Set("Docker-Content-Digest", digestOf([]byte(manifest)))
+				_, _ = fmt.Fprint(w, manifest)
+			case "/v2/pelotech/workspaces/blobs/" + layer:
+				_, _ = fmt.Fprint(w, index)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		DeferCleanup(server.Close)
+		f := &Fetcher{Client: server.Client()}
+		source := otv1alpha1.WorkspaceCatalogSource{
+			Type: otv1alpha1.CatalogSourceTypeOCI,
+			URL:  "oci://" + strings.TrimPrefix(server.URL, "https://") + "/pelotech/workspaces:stable",
+		}
+
+		fetched, err := f.Fetch(ctx, source, Credentials{}, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(fetched.Data)).To(Equal(index))
+		Expect(fetched.ETag).To(Equal(digestOf([]byte(manifest))))
+
+		fetched, err = f.Fetch(ctx, source, Credentials{}, fetched.ETag)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetched.Data).To(BeNil(), "an unchanged manifest is not fetched further")
+	})
+
+	It("should split OCI references", func() {
+		registry, repository, reference, err := parseReference("oci://registry.example.com:5000/pelotech/workspaces")
+		Expect(err).NotTo(HaveOccurred())
+		Expect([]string{registry, repository, reference}).To(Equal([]string{"registry.example.com:5000", "pelotech/workspaces", "latest"}))
+
+		_, _, reference, err = parseReference("oci://ghcr.io/pelotech/workspaces@sha256:abc")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reference).To(Equal("sha256:abc"))
+
+		_, _, _, err = parseReference("https://ghcr.io/pelotech/workspaces")
+		Expect(err).To(HaveOccurred())
+	})
+})
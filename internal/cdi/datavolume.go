@@ -0,0 +1,242 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cdi contains helpers for working with Containerized Data Importer objects.
+//
+// DataVolumes are handled as unstructured objects so the operator does not need to
+// pin its dependencies to a particular CDI release.
+package cdi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+)
+
+// DataVolumeGVK is the GroupVersionKind of a CDI DataVolume.
+var DataVolumeGVK = schema.GroupVersionKind{
+	Group:   "cdi.kubevirt.io",
+	Version: "v1beta1",
+	Kind:    "DataVolume",
+}
+
+// DataVolumePhase is the phase reported in a DataVolume's status.
+type DataVolumePhase string
+
+// The DataVolume phases the operator cares about. Any other phase is treated as in progress.
+const (
+	DataVolumePhaseUnset     DataVolumePhase = ""
+	DataVolumePhaseSucceeded DataVolumePhase = "Succeeded"
+	DataVolumePhaseFailed    DataVolumePhase = "Failed"
+)
+
+// annBindImmediate asks CDI to import even when the storage class uses
+// WaitForFirstConsumer binding. Preloading is the whole point of a DataSync,
+// so we never want the import to wait for a VM to be scheduled.
+const annBindImmediate = "cdi.kubevirt.io/storage.bind.immediate.requested"
+
+// NewDataVolume returns an empty DataVolume with its GroupVersionKind set.
+func NewDataVolume() *unstructured.Unstructured {
+	dv := &unstructured.Unstructured{}
+	dv.SetGroupVersionKind(DataVolumeGVK)
+	return dv
+}
+
+// NewDataVolumeList returns an empty DataVolume list with its GroupVersionKind set.
+func NewDataVolumeList() *unstructured.UnstructuredList {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(DataVolumeGVK.GroupVersion().WithKind(DataVolumeGVK.Kind + "List"))
+	return list
+}
+
+// DataVolumeName returns the name of the DataVolume created for a VM entry of
+// a DataSync. CDI gives the PVC of a DataVolume the same name.
+func DataVolumeName(ds *otv1alpha1.DataSync, vm otv1alpha1.DataSyncVM) string {
+	return ds.Name + "-" + vm.Name
+}
+
+// BuildDataVolume renders the DataVolume that imports the given VM disk. A
+// zero size leaves the size to CDI, which sizes clones and restores after
+// the volume they copy.
+func BuildDataVolume(name, namespace string, vm otv1alpha1.DataSyncVM, size resource.Quantity) (*unstructured.Unstructured, error) {
+	source, err := sourceFor(vm, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	dv := NewDataVolume()
+	dv.SetName(name)
+	dv.SetNamespace(namespace)
+	dv.SetAnnotations(map[string]string{annBindImmediate: "true"})
+	storage := map[string]any{}
+	if !size.IsZero() {
+		storage["resources"] = map[string]any{
+			"requests": map[string]any{
+				"storage": size.String(),
+			},
+		}
+	}
+	if vm.StorageClassName != nil {
+		storage["storageClassName"] = *vm.StorageClassName
+	}
+	if vm.AccessMode != "" {
+		storage["accessModes"] = []any{string(vm.AccessMode)}
+	}
+	dv.Object["spec"] = map[string]any{
+		"source":  source,
+		"storage": storage,
+	}
+	return dv, nil
+}
+
+// sourceFor maps a VM entry onto the matching CDI DataVolume source. PVCs and
+// VolumeSnapshots are only copied from namespace, the namespace of the
+// DataSync.
+func sourceFor(vm otv1alpha1.DataSyncVM, namespace string) (map[string]any, error) {
+	switch vm.SourceType {
+	case otv1alpha1.SourceTypeHTTP:
+		http := withCredentials(vm, map[string]any{"url": vm.URL})
+		if vm.HTTP != nil && len(vm.HTTP.Headers) > 0 {
+			headers := make([]any, 0, len(vm.HTTP.Headers))
+			for _, h := range vm.HTTP.Headers {
+				headers = append(headers, h.Name+": "+h.Value)
+			}
+			http["extraHeaders"] = headers
+		}
+		if vm.HTTP != nil && vm.HTTP.HeadersSecretRef != "" {
+			http["secretExtraHeaders"] = []any{vm.HTTP.HeadersSecretRef}
+		}
+		return map[string]any{"http": http}, nil
+	case otv1alpha1.SourceTypeRegistry:
+		registry := withCredentials(vm, map[string]any{"url": vm.URL})
+		if vm.Registry != nil && vm.Registry.PullMethod != "" {
+			registry["pullMethod"] = string(vm.Registry.PullMethod)
+		}
+		return map[string]any{"registry": registry}, nil
+	case otv1alpha1.SourceTypeS3:
+		return map[string]any{"s3": withCredentials(vm, map[string]any{"url": vm.URL})}, nil
+	case otv1alpha1.SourceTypePVC:
+		if vm.PVC == nil {
+			return nil, fmt.Errorf("vm %q of source type %q does not name a PVC", vm.Name, vm.SourceType)
+		}
+		ref, err := volumeSource(*vm.PVC, namespace)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"pvc": ref}, nil
+	case otv1alpha1.SourceTypeSnapshot:
+		if vm.Snapshot == nil {
+			return nil, fmt.Errorf("vm %q of source type %q does not name a VolumeSnapshot", vm.Name, vm.SourceType)
+		}
+		ref, err := volumeSource(*vm.Snapshot, namespace)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"snapshot": ref}, nil
+	default:
+		return nil, fmt.Errorf("unsupported source type %q for vm %q", vm.SourceType, vm.Name)
+	}
+}
+
+// withCredentials adds the Secret and CA bundle a VM entry names to the
+// settings of its remote source.
+func withCredentials(vm otv1alpha1.DataSyncVM, source map[string]any) map[string]any {
+	if vm.SecretRef != "" {
+		source["secretRef"] = vm.SecretRef
+	}
+	if vm.CertConfigMapRef != "" {
+		source["certConfigMap"] = vm.CertConfigMapRef
+	}
+	return source
+}
+
+// volumeSource renders a reference to a PVC or VolumeSnapshot in namespace.
+// CDI clones with the permissions of the operator, so references to other
+// namespaces are refused even if the webhook did not reject them.
+func volumeSource(ref otv1alpha1.DataSyncVolumeSource, namespace string) (map[string]any, error) {
+	if ref.Namespace != "" && ref.Namespace != namespace {
+		return nil, fmt.Errorf("%s is in namespace %s instead of %s", ref.Name, ref.Namespace, namespace)
+	}
+	return map[string]any{"namespace": namespace, "name": ref.Name}, nil
+}
+
+// Phase returns the phase reported by a DataVolume.
+func Phase(dv *unstructured.Unstructured) DataVolumePhase {
+	phase, _, _ := unstructured.NestedString(dv.Object, "status", "phase")
+	return DataVolumePhase(phase)
+}
+
+// Progress returns the import progress reported by a DataVolume, e.g. "42.10%".
+func Progress(dv *unstructured.Unstructured) string {
+	progress, _, _ := unstructured.NestedString(dv.Object, "status", "progress")
+	return progress
+}
+
+// ProgressFraction returns the import progress reported by a DataVolume as a
+// fraction between 0 and 1. Succeeded DataVolumes are complete whatever their
+// progress says; the progress of others may not be known, e.g. "N/A".
+func ProgressFraction(dv *unstructured.Unstructured) (float64, bool) {
+	if Phase(dv) == DataVolumePhaseSucceeded {
+		return 1, true
+	}
+	percent, ok := strings.CutSuffix(Progress(dv), "%")
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(percent, 64)
+	if err != nil || f < 0 {
+		return 0, false
+	}
+	return min(f/100, 1), true
+}
+
+// FailureMessage returns the message CDI reports for an import that is not
+// running, e.g. the error returned by the source.
+func FailureMessage(dv *unstructured.Unstructured) string {
+	conditions, _, _ := unstructured.NestedSlice(dv.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]any)
+		if !ok || condition["type"] != "Running" || condition["status"] == "True" {
+			continue
+		}
+		message, _ := condition["message"].(string)
+		return message
+	}
+	return ""
+}
+
+// RequestedSize returns the size requested for the volume of a DataVolume,
+// or zero if it was left to CDI.
+func RequestedSize(dv *unstructured.Unstructured) resource.Quantity {
+	size, _, _ := unstructured.NestedString(dv.Object, "spec", "storage", "resources", "requests", "storage")
+	q, err := resource.ParseQuantity(size)
+	if err != nil {
+		return resource.Quantity{}
+	}
+	return q
+}
+
+// RestartCount returns how many times CDI restarted the importer of a DataVolume.
+func RestartCount(dv *unstructured.Unstructured) int64 {
+	count, _, _ := unstructured.NestedInt64(dv.Object, "status", "restartCount")
+	return count
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/breaker"
+	"pelotech/ot-sync-operator/internal/cdi"
+	"pelotech/ot-sync-operator/internal/egress"
+)
+
+// acquireHosts asks the circuit breakers whether a DataSync may download
+// from the hosts of the VM disks it still has to sync, and returns why not.
+func (r *DataSyncReconciler) acquireHosts(ctx context.Context, ds *otv1alpha1.DataSync, now time.Time) (string, error) {
+	dvs, err := r.dataVolumesByVM(ctx, ds)
+	if err != nil {
+		return "", err
+	}
+
+	p := r.Policy.Get()
+	ok, reason, halfOpened := r.Breakers.Acquire(client.ObjectKeyFromObject(ds), sourceHosts(ds, dvs), now, p.CircuitBreakerCooldown)
+	for _, host := range halfOpened {
+		r.Recorder.Eventf(ds, corev1.EventTypeNormal, "CircuitHalfOpen", "Probing source host %s after an outage", host)
+	}
+	if ok {
+		return "", nil
+	}
+	if ds.Status.Message != reason {
+		r.Recorder.Event(ds, corev1.EventTypeWarning, "CircuitOpen", reason)
+	}
+	return reason, nil
+}
+
+// recordHostFailures reports the failed imports that point at their source
+// host to the circuit breakers, and returns a host of the DataSync whose
+// circuit is open, if any.
+func (r *DataSyncReconciler) recordHostFailures(ds *otv1alpha1.DataSync, failed []*unstructured.Unstructured) string {
+	if r.Breakers == nil {
+		return ""
+	}
+	key := client.ObjectKeyFromObject(ds)
+	defer r.Breakers.Release(key)
+
+	p := r.Policy.Get()
+	now := time.Now()
+	down := ""
+	for _, dv := range failed {
+		source := sourceURL(ds, dv.GetLabels()[otv1alpha1.LabelVM])
+		if source == "" || !breaker.HostFailure(cdi.FailureMessage(dv)) {
+			continue
+		}
+		host := egress.Host(source)
+		state, opened := r.Breakers.Failure(key, host, now, p.CircuitBreakerThreshold)
+		if opened {
+			r.Recorder.Eventf(ds, corev1.EventTypeWarning, "CircuitOpened",
+				"Source host %s is down; DataSyncs using it are held for %s", host, p.CircuitBreakerCooldown)
+		}
+		if state == breaker.Open && down == "" {
+			down = host
+		}
+	}
+	return down
+}
+
+// releaseProbes lets another DataSync probe the hosts key was probing.
+func (r *DataSyncReconciler) releaseProbes(key types.NamespacedName) {
+	if r.Breakers != nil {
+		r.Breakers.Release(key)
+	}
+}
+
+// sourceHosts returns the hosts the VM disks of a DataSync are downloaded
+// from, leaving out disks copied within the cluster and disks whose
+// DataVolume in dvs already succeeded.
+func sourceHosts(ds *otv1alpha1.DataSync, dvs map[string]*unstructured.Unstructured) []string {
+	var hosts []string
+	for _, vm := range ds.Spec.VMs {
+		if !vm.SourceType.Remote() {
+			continue
+		}
+		if dv, ok := dvs[vm.Name]; ok && cdi.Phase(dv) == cdi.DataVolumePhaseSucceeded {
+			continue
+		}
+		hosts = append(hosts, egress.Host(vm.URL))
+	}
+	slices.Sort(hosts)
+	return slices.Compact(hosts)
+}
+
+// sourceURL returns the URL of the VM entry name of a DataSync, which is
+// empty for disks copied within the cluster.
+func sourceURL(ds *otv1alpha1.DataSync, name string) string {
+	for _, vm := range ds.Spec.VMs {
+		if vm.Name == name {
+			return vm.URL
+		}
+	}
+	return ""
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/naming"
+	"pelotech/ot-sync-operator/internal/preflight"
+)
+
+// DefaultVerifierImage is the image checksums are verified with when the
+// reconciler does not name one. It only needs sh, head, sha256sum and cut.
+const DefaultVerifierImage = "busybox:1.36"
+
+// fatalExitCode is the exit code with which the Jobs verifying and patching
+// disks report a failure that retrying cannot fix, such as a verification
+// that hashed the disk and found another checksum. Other failures are
+// retried by the Job.
+const fatalExitCode = 3
+
+// verifyScript hashes the first $SIZE bytes of the disk at $DISK, or all of
+// it without $SIZE, and compares the hash with $EXPECTED, leaving what it
+// found in the termination message of the container.
+const verifyScript = `set -eu
+if [ -n "${SIZE:-}" ]; then
+  actual="sha256:$(head -c "$SIZE" "$DISK" | sha256sum | cut -d' ' -f1)"
+else
+  actual="sha256:$(sha256sum "$DISK" | cut -d' ' -f1)"
+fi
+if [ "$actual" != "$EXPECTED" ]; then
+  echo "expected $EXPECTED, got $actual" > /dev/termination-log
+  exit 3
+fi`
+
+// Where the Jobs find the disk. CDI stores the disk of a filesystem volume
+// as disk.img.
+const (
+	diskContainer  = "disk"
+	diskMountPath  = "/data"
+	diskFile       = diskMountPath + "/disk.img"
+	diskDevicePath = "/dev/disk"
+)
+
+// diskUser is the user and group the Jobs run as: the user CDI imports
+// disks as, so they may write the disks it imported.
+const diskUser = 107
+
+// verifyChecksum checks the disk of a succeeded DataVolume against the
+// checksum of its VM entry by running a Job that hashes the volume. CDI grows
+// the disk to fill the volume, so only as many bytes as the source holds are
+// hashed when its size can be looked up. It reports whether the disk is verified, or why the verification failed; a
+// verification still running is neither. A verified DataVolume is annotated
+// so it is not hashed again, and the Job is deleted.
+func (r *DataSyncReconciler) verifyChecksum(ctx context.Context, ds *otv1alpha1.DataSync, vm otv1alpha1.DataSyncVM, dv *unstructured.Unstructured) (bool, string, error) {
+	if vm.Checksum == "" || dv.GetAnnotations()[otv1alpha1.AnnotationChecksumVerified] == vm.Checksum {
+		return true, "", nil
+	}
+
+	job, err := r.finishedJob(ctx, dv, verifyJobName(dv), func(pvc *corev1.PersistentVolumeClaim) (*batchv1.Job, error) {
+		size, err := r.diskSize(ctx, ds.Namespace, vm)
+		if err != nil {
+			return nil, fmt.Errorf("looking up the disk size of %s: %w", vm.Name, err)
+		}
+		image := r.VerifierImage
+		if image == "" {
+			image = DefaultVerifierImage
+		}
+		env := []corev1.EnvVar{{Name: "EXPECTED", Value: vm.Checksum}}
+		if size > 0 {
+			env = append(env, corev1.EnvVar{Name: "SIZE", Value: strconv.FormatInt(size, 10)})
+		}
+		return diskJob(ds, vm, pvc, verifyJobName(dv), true, corev1.Container{
+			Image:   image,
+			Command: []string{"/bin/sh", "-c", verifyScript},
+			Env:     env,
+		}), nil
+	})
+	if err != nil || job == nil {
+		return false, "", err
+	}
+
+	switch failed := jobCondition(job, batchv1.JobFailed); {
+	case failed == nil:
+		if err := r.completeJob(ctx, dv, job, otv1alpha1.AnnotationChecksumVerified, vm.Checksum); err != nil {
+			return false, "", err
+		}
+		r.Recorder.Eventf(ds, corev1.EventTypeNormal, "ChecksumVerified", "The disk of %s matches %s", vm.Name, vm.Checksum)
+		return true, "", nil
+	case failed.Reason == batchv1.JobReasonPodFailurePolicy:
+		found := r.terminationMessage(ctx, job)
+		if found == "" {
+			found = "the checksum differs"
+		}
+		logf.FromContext(ctx).Info("checksum mismatch", "vm", vm.Name, "result", found)
+		r.Recorder.Eventf(ds, corev1.EventTypeWarning, "ChecksumMismatch", "The disk of %s does not match: %s", vm.Name, found)
+		return false, fmt.Sprintf("failed checksum verification (ChecksumMismatch: %s)", found), nil
+	default:
+		return false, fmt.Sprintf("could not be verified: %s", failed.Message), nil
+	}
+}
+
+// diskSize returns the size of the disk the http source of a VM entry of a
+// DataSync in namespace produces, or 0 when the source does not tell it.
+func (r *DataSyncReconciler) diskSize(ctx context.Context, namespace string, vm otv1alpha1.DataSyncVM) (int64, error) {
+	if r.Sizer == nil || r.Reader == nil || vm.SourceType != otv1alpha1.SourceTypeHTTP {
+		return 0, nil
+	}
+	src, err := preflight.SourceFor(ctx, r.Reader, namespace, &vm)
+	if err != nil {
+		return 0, err
+	}
+	size, err := r.Sizer.DiskSize(ctx, src)
+	if errors.Is(err, preflight.ErrNoDiskSize) {
+		return 0, nil
+	}
+	return size, err
+}
+
+// finishedJob returns the Job called name working on the volume of a
+// DataVolume once it finished, or nil while it runs. A missing Job is
+// created from build, which is given the PVC of the DataVolume.
+func (r *DataSyncReconciler) finishedJob(ctx context.Context, dv *unstructured.Unstructured, name string, build func(*corev1.PersistentVolumeClaim) (*batchv1.Job, error)) (*batchv1.Job, error) {
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: dv.GetNamespace(), Name: name}, job)
+	if apierrors.IsNotFound(err) {
+		return nil, r.createJob(ctx, dv, build)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// A Job left over from a DataVolume imported earlier is garbage collected
+	// along with it; the new DataVolume waits for its own.
+	if !metav1.IsControlledBy(job, dv) {
+		return nil, nil
+	}
+	if jobCondition(job, batchv1.JobComplete) == nil && jobCondition(job, batchv1.JobFailed) == nil {
+		return nil, nil
+	}
+	return job, nil
+}
+
+// createJob starts a Job working on the volume of a DataVolume. The Job is
+// owned by the DataVolume so it goes away along with it.
+func (r *DataSyncReconciler) createJob(ctx context.Context, dv *unstructured.Unstructured, build func(*corev1.PersistentVolumeClaim) (*batchv1.Job, error)) error {
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: dv.GetNamespace(), Name: dv.GetName()}, pvc); err != nil {
+		// CDI may not have handed the PVC over yet.
+		return client.IgnoreNotFound(err)
+	}
+	job, err := build(pvc)
+	if err != nil {
+		return err
+	}
+	if err := controllerutil.SetControllerReference(dv, job, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating Job %s: %w", job.Name, err)
+	}
+	logf.FromContext(ctx).Info("started Job", "dataVolume", dv.GetName(), "job", job.Name)
+	return nil
+}
+
+// completeJob records the result of a Job that completed in an annotation of
+// its DataVolume, so the work is not done again, and deletes the Job.
+func (r *DataSyncReconciler) completeJob(ctx context.Context, dv *unstructured.Unstructured, job *batchv1.Job, key, value string) error {
+	patch := client.MergeFrom(dv.DeepCopy())
+	annotations := dv.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[key] = value
+	dv.SetAnnotations(annotations)
+	if err := r.Patch(ctx, dv, patch); err != nil {
+		return fmt.Errorf("annotating DataVolume %s: %w", dv.GetName(), err)
+	}
+	if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("deleting Job %s: %w", job.Name, err)
+	}
+	return nil
+}
+
+// diskJob renders a Job running container on the disk in pvc, which it finds
+// at $DISK. The Job fails right away when the container exits with
+// fatalExitCode and retries other failures twice. Its pod meets the
+// restricted Pod Security Standard.
+func diskJob(ds *otv1alpha1.DataSync, vm otv1alpha1.DataSyncVM, pvc *corev1.PersistentVolumeClaim, name string, readOnly bool, container corev1.Container) *batchv1.Job {
+	container.Name = diskContainer
+	container.SecurityContext = &corev1.SecurityContext{
+		AllowPrivilegeEscalation: ptr.To(false),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+	container.TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	if pvc.Spec.VolumeMode != nil && *pvc.Spec.VolumeMode == corev1.PersistentVolumeBlock {
+		container.Env = append(container.Env, corev1.EnvVar{Name: "DISK", Value: diskDevicePath})
+		container.VolumeDevices = append(container.VolumeDevices, corev1.VolumeDevice{Name: "disk", DevicePath: diskDevicePath})
+	} else {
+		container.Env = append(container.Env, corev1.EnvVar{Name: "DISK", Value: diskFile})
+		container.VolumeMounts = append(container.VolumeMounts,
+			corev1.VolumeMount{Name: "disk", MountPath: diskMountPath, ReadOnly: readOnly})
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: pvc.Namespace,
+			Labels: map[string]string{
+				otv1alpha1.LabelDataSync: ds.Name,
+				otv1alpha1.LabelVM:       vm.Name,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](2),
+			PodFailurePolicy: &batchv1.PodFailurePolicy{Rules: []batchv1.PodFailurePolicyRule{{
+				Action: batchv1.PodFailurePolicyActionFailJob,
+				OnExitCodes: &batchv1.PodFailurePolicyOnExitCodesRequirement{
+					ContainerName: ptr.To(diskContainer),
+					Operator:      batchv1.PodFailurePolicyOnExitCodesOpIn,
+					Values:        []int32{fatalExitCode},
+				},
+			}}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{otv1alpha1.LabelDataSync: ds.Name}},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot:   ptr.To(true),
+						RunAsUser:      ptr.To[int64](diskUser),
+						RunAsGroup:     ptr.To[int64](diskUser),
+						FSGroup:        ptr.To[int64](diskUser),
+						SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+					},
+					Containers: []corev1.Container{container},
+					Volumes: []corev1.Volume{{
+						Name: "disk",
+						VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: pvc.Name,
+							ReadOnly:  readOnly,
+						}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// terminationMessage returns what the pod of a Job that failed for good
+// reported, or "" if it cannot be found.
+func (r *DataSyncReconciler) terminationMessage(ctx context.Context, job *batchv1.Job) string {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(job.Namespace),
+		client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return ""
+	}
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if t := status.State.Terminated; t != nil && t.ExitCode == fatalExitCode && t.Message != "" {
+				return t.Message
+			}
+		}
+	}
+	return ""
+}
+
+// verifyJobName returns the name of the Job verifying the disk of a DataVolume.
+// The name is bounded since Kubernetes copies it into the labels of the pods.
+func verifyJobName(dv *unstructured.Unstructured) string {
+	return naming.Bounded(dv.GetName() + "-verify")
+}
+
+// jobCondition returns the condition of type t of a Job if it is true.
+func jobCondition(job *batchv1.Job, t batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		if c := &job.Status.Conditions[i]; c.Type == t && c.Status == corev1.ConditionTrue {
+			return c
+		}
+	}
+	return nil
+}
+
+// jobFor maps a Job verifying or patching a disk to the DataSync it is for.
+func jobFor(_ context.Context, o client.Object) []reconcile.Request {
+	name := o.GetLabels()[otv1alpha1.LabelDataSync]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: o.GetNamespace(), Name: name}}}
+}
@@ -0,0 +1,841 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/breaker"
+	"pelotech/ot-sync-operator/internal/cdi"
+	"pelotech/ot-sync-operator/internal/egress"
+	"pelotech/ot-sync-operator/internal/kubevirt"
+	"pelotech/ot-sync-operator/internal/policy"
+	"pelotech/ot-sync-operator/internal/preflight"
+	"pelotech/ot-sync-operator/internal/queue"
+	"pelotech/ot-sync-operator/internal/retry"
+)
+
+// queueRecheckInterval is how often a queued DataSync asks the admission
+// queue for a slot again, in case a wake-up from the queue was missed.
+const queueRecheckInterval = 30 * time.Second
+
+// importerRestartLimit is the number of importer restarts after which a
+// DataVolume counts as failed. CDI restarts failing importers forever, which
+// would otherwise bypass the retry limit of the policy.
+const importerRestartLimit = 3
+
+// DataSyncReconciler reconciles a DataSync object
+type DataSyncReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Queue    *queue.Queue
+	Policy   *policy.Store
+
+	// RetryBudget limits how many failed DataSyncs may be retried cluster-wide.
+	RetryBudget *retry.Budget
+
+	// Preflight looks up how much an http source downloads. Without it the
+	// size of the VM disk is used as the estimate.
+	Preflight preflight.DownloadSizer
+
+	// Sizer looks up the size of the disk an http source produces, so its
+	// checksum is verified without the space CDI grows the disk by to fill
+	// the volume. Without it the whole volume is hashed.
+	Sizer preflight.Sizer
+
+	// Reader reads the Secrets and CA bundles sources are looked up with,
+	// which the operator does not cache.
+	Reader client.Reader
+
+	// Egress records the bytes DataSyncs download and enforces the monthly
+	// egress budget of the policy. Without it egress is only tracked in status.
+	Egress *egress.Ledger
+
+	// Breakers hold DataSyncs back from source hosts that keep failing.
+	// Without them every failure counts as a retry.
+	Breakers *breaker.Breakers
+
+	// VerifierImage is the image of the Jobs that verify the checksums of
+	// synced disks. Defaults to DefaultVerifierImage.
+	VerifierImage string
+
+	// DeltaImage is the image of the Jobs that apply the deltas of VM entries
+	// to clones of earlier workspace versions. It needs sh, curl and
+	// qemu-img. Delta sync is disabled without it and disks are downloaded
+	// in full.
+	DeltaImage string
+}
+
+// +kubebuilder:rbac:groups=pelotech.ot,resources=datasyncs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=pelotech.ot,resources=datasyncs/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=pelotech.ot,resources=datasyncs/finalizers,verbs=update
+// +kubebuilder:rbac:groups=cdi.kubevirt.io,resources=datavolumes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=cdi.kubevirt.io,resources=datavolumes/source,verbs=create
+// +kubebuilder:rbac:groups=kubevirt.io,resources=virtualmachines,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+
+// Reconcile moves a DataSync through its lifecycle. New requests are marked
+// Queued, queued requests that are admitted by the global queue have one
+// DataVolume created per VM entry and move to Syncing, and syncing requests
+// are resolved to Succeeded from the phases reported by their DataVolumes.
+// Failed attempts go back to Queued until the retry limit is reached and the
+// DataSync is marked Failed. Leaving Syncing releases the slot in the queue.
+// A DataSync whose source rejected its credentials is re-armed once the
+// Secret holding them is rotated.
+// Once Succeeded, VirtualMachines held by the launch gate are released; they
+// are also released once Failed or Cancelled, so they do not wait forever.
+// DataSyncs that have not finished are moved to Suspended while they or the
+// sync policy are suspended, and to Cancelled once annotated to be cancelled.
+// Deleted DataSyncs are held by a finalizer until their storage is torn down.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.21.0/pkg/reconcile
+func (r *DataSyncReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ds := &otv1alpha1.DataSync{}
+	if err := r.Get(ctx, req.NamespacedName, ds); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Queue.Forget(req.NamespacedName)
+			r.releaseProbes(req.NamespacedName)
+			transferredBytes.DeleteLabelValues(req.Namespace, req.Name)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if ds.Status.BytesTransferred > 0 {
+		transferredBytes.WithLabelValues(ds.Namespace, ds.Name).Set(float64(ds.Status.BytesTransferred))
+	}
+
+	if !ds.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, ds)
+	}
+	if controllerutil.AddFinalizer(ds, finalizer) {
+		if err := r.Update(ctx, ds); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if cancelRequested(ds) {
+		return ctrl.Result{}, r.cancel(ctx, ds)
+	}
+	if reason := r.suspendReason(ds); reason != "" {
+		return r.suspend(ctx, ds, reason)
+	}
+	if len(ds.Status.RejectedSecrets) > 0 &&
+		(ds.Status.Phase == otv1alpha1.DataSyncPhaseQueued || ds.Status.Phase == otv1alpha1.DataSyncPhaseFailed) {
+		secret, err := r.rotatedSecret(ctx, ds)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if secret != "" {
+			return ctrl.Result{}, r.rearm(ctx, ds, secret)
+		}
+	}
+
+	switch ds.Status.Phase {
+	case "":
+		return ctrl.Result{}, r.setPhase(ctx, ds, otv1alpha1.DataSyncPhaseQueued,
+			"Request is waiting for an available worker.")
+	case otv1alpha1.DataSyncPhaseSuspended:
+		return ctrl.Result{}, r.resume(ctx, ds)
+	case otv1alpha1.DataSyncPhaseQueued:
+		return r.reconcileQueued(ctx, ds)
+	case otv1alpha1.DataSyncPhaseSyncing:
+		return r.reconcileSyncing(ctx, ds)
+	case otv1alpha1.DataSyncPhaseSucceeded:
+		r.Queue.Release(req.NamespacedName)
+		return ctrl.Result{}, r.releaseVirtualMachines(ctx, ds)
+	case otv1alpha1.DataSyncPhaseFailed, otv1alpha1.DataSyncPhaseCancelled:
+		// VirtualMachines held for the DataSync stay halted: rotating its
+		// credentials may queue it again, and they would start without
+		// their data in the meantime.
+		r.Queue.Release(req.NamespacedName)
+		return ctrl.Result{}, nil
+	default:
+		r.Queue.Release(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+}
+
+// reconcileQueued asks the admission queue for a slot and, once admitted,
+// creates the DataVolumes and moves the DataSync to Syncing. A DataSync
+// waiting out its retry backoff does not take part in the queue, nothing is
+// admitted outside the sync windows of the policy, while the monthly egress
+// budget is exhausted or while the circuit of a source host is open, and a
+// retry additionally needs room in the cluster-wide retry budget.
+func (r *DataSyncReconciler) reconcileQueued(ctx context.Context, ds *otv1alpha1.DataSync) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+	now := time.Now()
+	key := client.ObjectKeyFromObject(ds)
+
+	if ds.Status.NextRetryTime != nil && now.Before(ds.Status.NextRetryTime.Time) {
+		return ctrl.Result{RequeueAfter: ds.Status.NextRetryTime.Sub(now)}, nil
+	}
+
+	if p := r.Policy.Get(); !p.SyncWindowOpen(now) && !exemptFromSyncWindows(p, ds) {
+		message := "Request is waiting for a sync window."
+		if next, ok := p.NextSyncWindow(now); ok {
+			message = fmt.Sprintf("Request is waiting for the next sync window at %s.", next.Format(time.RFC3339))
+		}
+		r.Queue.Withdraw(key)
+		return ctrl.Result{RequeueAfter: queueRecheckInterval},
+			r.setPhase(ctx, ds, otv1alpha1.DataSyncPhaseQueued, message)
+	}
+
+	if r.Egress != nil {
+		reason, err := r.Egress.Exhausted(ctx, now, r.Policy.Get().MonthlyEgressBudget)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if reason != "" {
+			r.Queue.Withdraw(key)
+			return ctrl.Result{RequeueAfter: queueRecheckInterval},
+				r.setPhase(ctx, ds, otv1alpha1.DataSyncPhaseQueued, reason)
+		}
+	}
+
+	if r.Breakers != nil {
+		if reason, err := r.acquireHosts(ctx, ds, now); err != nil || reason != "" {
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			r.Queue.Withdraw(key)
+			return ctrl.Result{RequeueAfter: queueRecheckInterval},
+				r.setPhase(ctx, ds, otv1alpha1.DataSyncPhaseQueued, reason)
+		}
+	}
+
+	if err := r.estimateBytes(ctx, ds); err != nil {
+		r.releaseProbes(key)
+		return ctrl.Result{}, err
+	}
+
+	decision, err := r.Queue.Admit(ctx, ds)
+	if err != nil {
+		r.releaseProbes(key)
+		return ctrl.Result{}, err
+	}
+	if !decision.Admitted {
+		r.releaseProbes(key)
+		return ctrl.Result{RequeueAfter: queueRecheckInterval},
+			r.setPhase(ctx, ds, otv1alpha1.DataSyncPhaseQueued, decision.Reason)
+	}
+
+	// Only retries of a failed attempt are charged, not attempts resuming a
+	// sync that was preempted, interrupted or suspended. The retry is charged
+	// once, however often starting it is retried.
+	if ds.Status.NextRetryTime != nil {
+		attempt := fmt.Sprintf("%s#%d", key, ds.Status.Attempts+1)
+		p := r.Policy.Get()
+		if ok, freeAt := r.RetryBudget.TryAcquire(attempt, now, p.RetryBudget, p.RetryBudgetWindow); !ok {
+			r.releaseProbes(key)
+			r.Queue.Release(key)
+			return ctrl.Result{RequeueAfter: freeAt.Sub(now)}, r.setPhase(ctx, ds, otv1alpha1.DataSyncPhaseQueued,
+				fmt.Sprintf("Retry budget exhausted (%d retries per %s); next retry possible at %s.",
+					p.RetryBudget, p.RetryBudgetWindow, freeAt.UTC().Format(time.RFC3339)))
+		}
+	}
+
+	log.Info("starting sync", "vms", len(ds.Spec.VMs), "attempt", ds.Status.Attempts+1)
+	if _, err := r.ensureDataVolumes(ctx, ds); err != nil {
+		if apierrors.IsInvalid(err) {
+			return ctrl.Result{}, r.rejectDataVolumes(ctx, ds, err)
+		}
+		return ctrl.Result{}, err
+	}
+	r.Recorder.Eventf(ds, corev1.EventTypeNormal, "SyncStarted", "Started attempt %d", ds.Status.Attempts+1)
+
+	ds.Status.Attempts++
+	ds.Status.NextRetryTime = nil
+	ds.Status.RejectedSecrets = nil
+	return ctrl.Result{}, r.setPhase(ctx, ds, otv1alpha1.DataSyncPhaseSyncing,
+		fmt.Sprintf("0/%d volumes ready.", len(ds.Spec.VMs)))
+}
+
+// reconcileSyncing recreates any missing DataVolumes and rolls their phases up
+// into the phase of the DataSync. Unless the policy lets syncs finish, a sync
+// still running when the sync windows close is stopped until the next one.
+func (r *DataSyncReconciler) reconcileSyncing(ctx context.Context, ds *otv1alpha1.DataSync) (ctrl.Result, error) {
+	if by, ok := r.Queue.PreemptedBy(client.ObjectKeyFromObject(ds)); ok {
+		return ctrl.Result{}, r.preempt(ctx, ds, by)
+	}
+
+	// windowCloses is when the sync has to stop, if the sync windows apply to it.
+	var windowCloses time.Duration
+	now := time.Now()
+	if p := r.Policy.Get(); p.SyncWindowCloseAction != policy.WindowCloseFinish && len(p.SyncWindows) > 0 &&
+		!exemptFromSyncWindows(p, ds) {
+		if !p.SyncWindowOpen(now) {
+			return ctrl.Result{}, r.closeWindow(ctx, ds, p.SyncWindowCloseAction)
+		}
+		windowCloses = p.SyncWindowClosesAt(now).Sub(now)
+	}
+	waiting, err := r.ensureDataVolumes(ctx, ds)
+	if err != nil {
+		if apierrors.IsInvalid(err) {
+			return ctrl.Result{}, r.rejectDataVolumes(ctx, ds, err)
+		}
+		return ctrl.Result{}, err
+	}
+
+	dvs, err := r.dataVolumesByVM(ctx, ds)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.accountTransfers(ctx, ds, dvs); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	ready := 0
+	var failed []*unstructured.Unstructured
+	why := "did not import"
+	for _, vm := range ds.Spec.VMs {
+		dv, ok := dvs[vm.Name]
+		if !ok || !dv.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		switch {
+		case cdi.Phase(dv) == cdi.DataVolumePhaseSucceeded:
+			verified, failure, err := r.applyDelta(ctx, ds, vm, dv)
+			if err == nil && verified {
+				verified, failure, err = r.verifyChecksum(ctx, ds, vm, dv)
+			}
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if failure != "" {
+				if len(failed) == 0 {
+					why = failure
+				}
+				failed = append(failed, dv)
+			} else if verified {
+				ready++
+			}
+		case cdi.Phase(dv) == cdi.DataVolumePhaseFailed, cdi.RestartCount(dv) >= importerRestartLimit:
+			failed = append(failed, dv)
+		}
+	}
+
+	if len(failed) > 0 {
+		return r.handleFailure(ctx, ds, failed, why)
+	}
+	if ready == len(ds.Spec.VMs) {
+		if r.Breakers != nil {
+			for _, host := range r.Breakers.Success(client.ObjectKeyFromObject(ds), sourceHosts(ds, nil)) {
+				r.Recorder.Eventf(ds, corev1.EventTypeNormal, "CircuitClosed", "Source host %s recovered", host)
+			}
+		}
+		r.Recorder.Event(ds, corev1.EventTypeNormal, "SyncSucceeded", "All DataVolumes are ready")
+		return ctrl.Result{}, r.finish(ctx, ds, otv1alpha1.DataSyncPhaseSucceeded, "All volumes are ready.")
+	}
+	// The DataVolumes of other DataSyncs are not watched, so a VM entry
+	// waiting for a shared download checks back for it.
+	result := ctrl.Result{RequeueAfter: windowCloses}
+	if waiting && (result.RequeueAfter == 0 || result.RequeueAfter > queueRecheckInterval) {
+		result.RequeueAfter = queueRecheckInterval
+	}
+	return result, r.setPhase(ctx, ds, otv1alpha1.DataSyncPhaseSyncing,
+		fmt.Sprintf("%d/%d volumes ready.", ready, len(ds.Spec.VMs)))
+}
+
+// handleFailure deletes the failed DataVolumes so their importers stop
+// downloading, then either schedules a retry with exponential backoff or
+// gives up once the retry limit of the policy is reached. DataVolumes that
+// already succeeded are kept and are not downloaded again. An attempt that
+// failed because the circuit of its source host is open is not a retry; the
+// DataSync waits in Queued until the host recovers. why describes how the
+// first of the failed DataVolumes failed.
+func (r *DataSyncReconciler) handleFailure(ctx context.Context, ds *otv1alpha1.DataSync, failed []*unstructured.Unstructured, why string) (ctrl.Result, error) {
+	for _, dv := range failed {
+		if err := r.Delete(ctx, dv, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, fmt.Errorf("deleting failed DataVolume %s: %w", dv.GetName(), err)
+		}
+	}
+
+	rejected, err := r.rejectedSecrets(ctx, ds, failed)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	ds.Status.RejectedSecrets = rejected
+
+	reason := fmt.Sprintf("Attempt %d failed: DataVolume %s %s", ds.Status.Attempts, failed[0].GetName(), why)
+	if len(rejected) > 0 {
+		reason += fmt.Sprintf(", the source rejected the credentials in Secret %s", rejected[0].Name)
+	}
+	p := r.Policy.Get()
+	if host := r.recordHostFailures(ds, failed); host != "" {
+		r.Recorder.Eventf(ds, corev1.EventTypeWarning, "SourceUnavailable",
+			"%s, source host %s is down; waiting for it to recover", reason, host)
+		ds.Status.Outages++
+		ds.Status.EstimatedBytes = 0
+		ds.Status.NextRetryTime = nil
+		return ctrl.Result{RequeueAfter: queueRecheckInterval}, r.finish(ctx, ds, otv1alpha1.DataSyncPhaseQueued,
+			fmt.Sprintf("%s; source host %s is down, waiting for it to recover.", reason, host))
+	}
+
+	retries := retriesUsed(ds)
+	if retries >= p.RetryLimit {
+		r.Recorder.Eventf(ds, corev1.EventTypeWarning, "SyncFailed", "%s, giving up after %d attempts", reason, ds.Status.Attempts)
+		return ctrl.Result{}, r.finish(ctx, ds, otv1alpha1.DataSyncPhaseFailed,
+			fmt.Sprintf("%s; giving up after %d attempts.", reason, ds.Status.Attempts))
+	}
+
+	// The retry only downloads what failed, so it is estimated again.
+	ds.Status.EstimatedBytes = 0
+	delay := retry.Backoff(p.RetryBackoffDuration, retries+1)
+	next := metav1.NewTime(time.Now().Add(delay))
+	ds.Status.NextRetryTime = &next
+	r.Recorder.Eventf(ds, corev1.EventTypeWarning, "RetryScheduled", "%s, retrying in %s", reason, delay.Round(time.Second))
+	if err := r.finish(ctx, ds, otv1alpha1.DataSyncPhaseQueued,
+		fmt.Sprintf("%s; retry %d/%d scheduled for %s.", reason, retries+1, p.RetryLimit, next.UTC().Format(time.RFC3339))); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: delay}, nil
+}
+
+// retriesUsed returns how many of the attempts of a DataSync were retries.
+// Attempts that were preempted, hit a source host outage, were stopped by a
+// closing sync window, were suspended or were forgiven when rotated
+// credentials re-armed the DataSync do not count, so the result is -1 before
+// the first attempt that counts.
+func retriesUsed(ds *otv1alpha1.DataSync) int {
+	return int(ds.Status.Attempts-ds.Status.Preemptions-ds.Status.Outages-
+		ds.Status.Interruptions-ds.Status.Suspensions-ds.Status.RearmedAttempts) - 1
+}
+
+// exemptFromSyncWindows reports whether ds may sync outside the sync windows of p.
+func exemptFromSyncWindows(p policy.Policy, ds *otv1alpha1.DataSync) bool {
+	return p.ExemptFromSyncWindows(ds.Spec.PriorityClassName, ds.Annotations[otv1alpha1.AnnotationOnDemand] == "true")
+}
+
+// estimateBytes records how many bytes the next attempt of a DataSync is
+// expected to download, so the admission queue can enforce the bandwidth
+// budget. VM disks whose DataVolume already succeeded are not counted. The
+// estimate is kept until the attempt fails, so sources are probed once per
+// attempt; the size of each download is also kept to account its egress.
+func (r *DataSyncReconciler) estimateBytes(ctx context.Context, ds *otv1alpha1.DataSync) error {
+	if ds.Status.EstimatedBytes > 0 {
+		return nil
+	}
+	dvs, err := r.dataVolumesByVM(ctx, ds)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, vm := range ds.Spec.VMs {
+		if dv, ok := dvs[vm.Name]; ok && cdi.Phase(dv) == cdi.DataVolumePhaseSucceeded {
+			continue
+		}
+		// Clones and restores do not download anything, and neither do disks
+		// shared with another DataSync.
+		if !vm.SourceType.Remote() {
+			continue
+		}
+		if donor, _, err := r.findDonor(ctx, ds, vm); err != nil {
+			return err
+		} else if donor != nil {
+			continue
+		}
+		// A disk cloned from an earlier version only downloads its delta.
+		if base, err := r.findBase(ctx, ds, vm); err != nil {
+			return err
+		} else if base != nil {
+			vm = deltaDownload(vm)
+		}
+		bytes := r.vmBytes(ctx, ds.Namespace, vm)
+		transfer(ds, vm.Name).TotalBytes = bytes
+		total += bytes
+	}
+	if total == 0 {
+		return nil
+	}
+	ds.Status.EstimatedBytes = total
+	return r.Status().Update(ctx, ds)
+}
+
+// vmBytes estimates the bytes downloaded for a VM disk of a DataSync in
+// namespace from the size its source reports, falling back to the size of
+// the disk.
+func (r *DataSyncReconciler) vmBytes(ctx context.Context, namespace string, vm otv1alpha1.DataSyncVM) int64 {
+	if r.Preflight != nil && r.Reader != nil && vm.SourceType == otv1alpha1.SourceTypeHTTP {
+		src, err := preflight.SourceFor(ctx, r.Reader, namespace, &vm)
+		var bytes int64
+		if err == nil {
+			bytes, err = r.Preflight.DownloadSize(ctx, src)
+		}
+		if err == nil && bytes > 0 {
+			return bytes
+		}
+		logf.FromContext(ctx).V(1).Info("could not look up the download size", "vm", vm.Name, "error", err)
+	}
+	if vm.Size != nil {
+		return vm.Size.Value()
+	}
+	size := r.Policy.Get().DefaultVolumeSize
+	return size.Value()
+}
+
+// preempt stops a sync so a more urgent DataSync can take its slot, and
+// requeues it. In pause mode only imports that have not finished are
+// stopped; in cancel mode every volume is deleted. The preempted attempt
+// does not count against the retry limit.
+func (r *DataSyncReconciler) preempt(ctx context.Context, ds *otv1alpha1.DataSync, by types.NamespacedName) error {
+	mode := r.Policy.Get().Preemption
+	if mode == policy.PreemptionNone {
+		// Preemption was switched off since the victim was chosen.
+		mode = policy.PreemptionPause
+	}
+	if err := r.stopImports(ctx, ds, mode == policy.PreemptionPause); err != nil {
+		return err
+	}
+
+	logf.FromContext(ctx).Info("preempted sync", "by", by.String(), "mode", mode)
+	r.Recorder.Eventf(ds, corev1.EventTypeNormal, "Preempted", "Made way for %s (%s)", by, mode)
+	ds.Status.Preemptions++
+	ds.Status.LastPreemption = &otv1alpha1.DataSyncPreemption{Time: metav1.Now(), By: by.String(), Mode: string(mode)}
+	ds.Status.EstimatedBytes = 0
+	return r.finish(ctx, ds, otv1alpha1.DataSyncPhaseQueued, fmt.Sprintf("Preempted by %s; requeued.", by))
+}
+
+// closeWindow stops a sync when the sync windows close and requeues it until
+// the next window. The stopped attempt does not count against the retry limit.
+func (r *DataSyncReconciler) closeWindow(ctx context.Context, ds *otv1alpha1.DataSync, action policy.WindowCloseAction) error {
+	if err := r.stopImports(ctx, ds, action == policy.WindowClosePause); err != nil {
+		return err
+	}
+
+	logf.FromContext(ctx).Info("stopped sync as the sync windows closed", "action", action)
+	r.Recorder.Eventf(ds, corev1.EventTypeNormal, "SyncWindowClosed", "Stopped the sync until the next sync window (%s)", action)
+	r.releaseProbes(client.ObjectKeyFromObject(ds))
+	ds.Status.Interruptions++
+	ds.Status.EstimatedBytes = 0
+	message := "The sync window closed; unfinished imports stopped until the next window."
+	if action == policy.WindowCloseCancel {
+		message = "The sync window closed; the sync was cancelled until the next window."
+	}
+	return r.finish(ctx, ds, otv1alpha1.DataSyncPhaseQueued, message)
+}
+
+// stopImports deletes the DataVolumes of a DataSync so their importers stop
+// downloading, after accounting what they downloaded. With keepFinished the
+// DataVolumes that already succeeded are kept.
+func (r *DataSyncReconciler) stopImports(ctx context.Context, ds *otv1alpha1.DataSync, keepFinished bool) error {
+	dvs, err := r.dataVolumesByVM(ctx, ds)
+	if err != nil {
+		return err
+	}
+	if err := r.accountTransfers(ctx, ds, dvs); err != nil {
+		return err
+	}
+	for _, dv := range dvs {
+		if keepFinished && cdi.Phase(dv) == cdi.DataVolumePhaseSucceeded {
+			continue
+		}
+		if err := r.Delete(ctx, dv, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("deleting DataVolume %s: %w", dv.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// rejectDataVolumes fails a DataSync whose DataVolumes the API server rejects
+// as invalid, which retrying would not change, and hands back its slot.
+func (r *DataSyncReconciler) rejectDataVolumes(ctx context.Context, ds *otv1alpha1.DataSync, err error) error {
+	r.releaseProbes(client.ObjectKeyFromObject(ds))
+	r.Recorder.Eventf(ds, corev1.EventTypeWarning, "SyncFailed", "The DataVolumes are invalid: %v", err)
+	return r.finish(ctx, ds, otv1alpha1.DataSyncPhaseFailed, fmt.Sprintf("The DataVolumes are invalid: %v.", err))
+}
+
+// finish records a phase that no longer needs a slot and hands the slot of
+// the DataSync back to the queue once the phase is persisted.
+func (r *DataSyncReconciler) finish(ctx context.Context, ds *otv1alpha1.DataSync, phase otv1alpha1.DataSyncPhase, message string) error {
+	if err := r.setPhase(ctx, ds, phase, message); err != nil {
+		return err
+	}
+	r.Queue.Release(client.ObjectKeyFromObject(ds))
+	return nil
+}
+
+// ensureDataVolumes creates the DataVolume for every VM entry that does not
+// have one yet. A disk another DataSync already synced is cloned from its
+// volume and a disk another DataSync is still downloading is waited for
+// rather than downloaded twice; it reports whether any VM entry is waiting.
+// Failing that, a disk with a delta is cloned from an earlier version of the
+// workspace, to which the delta is applied once the clone succeeded.
+func (r *DataSyncReconciler) ensureDataVolumes(ctx context.Context, ds *otv1alpha1.DataSync) (bool, error) {
+	existing, err := r.dataVolumesByVM(ctx, ds)
+	if err != nil {
+		return false, err
+	}
+
+	waiting := false
+	for i, vm := range ds.Spec.VMs {
+		if _, ok := existing[vm.Name]; ok {
+			continue
+		}
+		donor, inFlight, err := r.findDonor(ctx, ds, vm)
+		if err != nil {
+			return false, err
+		}
+		if inFlight {
+			logf.FromContext(ctx).V(1).Info("waiting for a shared download", "vm", vm.Name,
+				"dataVolume", donor.GetNamespace()+"/"+donor.GetName())
+			waiting = true
+			continue
+		}
+		var base *unstructured.Unstructured
+		if donor == nil {
+			if base, err = r.findBase(ctx, ds, vm); err != nil {
+				return false, err
+			}
+		}
+		dv, err := r.buildDataVolume(ds, vm, donor, base)
+		if err != nil {
+			// The spec cannot be turned into a DataVolume, which retrying
+			// would not change either.
+			return false, apierrors.NewInvalid(otv1alpha1.GroupVersion.WithKind("DataSync").GroupKind(), ds.Name,
+				field.ErrorList{field.Invalid(field.NewPath("spec", "vms").Index(i), vm.Name, err.Error())})
+		}
+		if err := r.Create(ctx, dv); err != nil && !apierrors.IsAlreadyExists(err) {
+			return false, fmt.Errorf("creating DataVolume %s: %w", dv.GetName(), err)
+		}
+		if donor != nil {
+			r.Recorder.Eventf(ds, corev1.EventTypeNormal, "Deduplicated",
+				"Cloning %s from DataVolume %s/%s instead of downloading it again", vm.Name, donor.GetNamespace(), donor.GetName())
+		}
+		if base != nil {
+			r.Recorder.Eventf(ds, corev1.EventTypeNormal, "DeltaSync",
+				"Cloning %s from version %s to apply its delta", vm.Name, base.GetLabels()[otv1alpha1.LabelWorkspaceVersion])
+		}
+	}
+	return waiting, nil
+}
+
+// buildDataVolume renders the DataVolume for a VM entry, owned by the
+// DataSync. With a donor, the DataVolume clones the volume of the donor; with
+// a base, it clones the volume of the earlier version to apply a delta to.
+func (r *DataSyncReconciler) buildDataVolume(ds *otv1alpha1.DataSync, vm otv1alpha1.DataSyncVM, donor, base *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	key, checksum := contentKey(vm), vm.Checksum
+	if donor != nil {
+		vm = cloneOf(vm, donor)
+	} else if base != nil {
+		vm = cloneOf(vm, base)
+	}
+
+	// The defaulting webhook normally fills these in; fall back to the policy
+	// for DataSyncs admitted while webhooks were disabled.
+	p := r.Policy.Get()
+	size := p.DefaultVolumeSize
+	if vm.Size != nil {
+		size = *vm.Size
+	} else if !vm.SourceType.Remote() {
+		// CDI sizes clones and restores after what they copy.
+		size = resource.Quantity{}
+	}
+	if vm.StorageClassName == nil && p.DefaultStorageClass != "" {
+		vm.StorageClassName = &p.DefaultStorageClass
+	}
+	if vm.AccessMode == "" {
+		vm.AccessMode = p.DefaultAccessMode
+	}
+
+	dv, err := cdi.BuildDataVolume(cdi.DataVolumeName(ds, vm), ds.Namespace, vm, size)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{
+		otv1alpha1.LabelDataSync:    ds.Name,
+		otv1alpha1.LabelWorkspaceID: ds.Spec.WorkspaceID,
+		otv1alpha1.LabelVM:          vm.Name,
+	}
+	if ds.Spec.Version != "" {
+		labels[otv1alpha1.LabelWorkspaceVersion] = ds.Spec.Version
+	}
+	if key != "" {
+		labels[otv1alpha1.LabelContentKey] = key
+	}
+	dv.SetLabels(labels)
+	if donor != nil {
+		annotations := dv.GetAnnotations()
+		annotations[otv1alpha1.AnnotationClonedFrom] = donor.GetNamespace() + "/" + donor.GetName()
+		// The donor was verified against the same checksum.
+		annotations[otv1alpha1.AnnotationChecksumVerified] = checksum
+		dv.SetAnnotations(annotations)
+	} else if base != nil {
+		annotations := dv.GetAnnotations()
+		annotations[otv1alpha1.AnnotationDeltaBase] = base.GetNamespace() + "/" + base.GetName()
+		dv.SetAnnotations(annotations)
+	}
+	if err := controllerutil.SetControllerReference(ds, dv, r.Scheme); err != nil {
+		return nil, err
+	}
+	return dv, nil
+}
+
+// dataVolumesByVM returns the DataVolumes created for a DataSync keyed by VM name.
+func (r *DataSyncReconciler) dataVolumesByVM(ctx context.Context, ds *otv1alpha1.DataSync) (map[string]*unstructured.Unstructured, error) {
+	list := cdi.NewDataVolumeList()
+	if err := r.List(ctx, list,
+		client.InNamespace(ds.Namespace),
+		client.MatchingLabels{otv1alpha1.LabelDataSync: ds.Name},
+	); err != nil {
+		return nil, fmt.Errorf("listing DataVolumes: %w", err)
+	}
+
+	dvs := make(map[string]*unstructured.Unstructured, len(list.Items))
+	for i := range list.Items {
+		dv := &list.Items[i]
+		if !metav1.IsControlledBy(dv, ds) {
+			continue
+		}
+		dvs[dv.GetLabels()[otv1alpha1.LabelVM]] = dv
+	}
+	return dvs, nil
+}
+
+// setPhase records the phase and message of a DataSync along with its Ready condition.
+func (r *DataSyncReconciler) setPhase(ctx context.Context, ds *otv1alpha1.DataSync, phase otv1alpha1.DataSyncPhase, message string) error {
+	if ds.Status.Phase == phase && ds.Status.Message == message && ds.Status.ObservedGeneration == ds.Generation {
+		return nil
+	}
+
+	ds.Status.Phase = phase
+	ds.Status.Message = message
+	ds.Status.ObservedGeneration = ds.Generation
+
+	ready := metav1.ConditionFalse
+	if phase == otv1alpha1.DataSyncPhaseSucceeded {
+		ready = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&ds.Status.Conditions, metav1.Condition{
+		Type:               otv1alpha1.ConditionReady,
+		Status:             ready,
+		Reason:             string(phase),
+		Message:            message,
+		ObservedGeneration: ds.Generation,
+	})
+
+	return r.Status().Update(ctx, ds)
+}
+
+// releaseVirtualMachines restores the run strategy of the VirtualMachines the
+// launch gate held until the DataSync succeeded. It is also called for a
+// deleted DataSync, whose held VirtualMachines are unheld unless it had
+// synced: they are left halted with a warning instead of starting without
+// their data.
+func (r *DataSyncReconciler) releaseVirtualMachines(ctx context.Context, ds *otv1alpha1.DataSync) error {
+	list := kubevirt.NewList(kubevirt.VirtualMachineGVK)
+	if err := r.List(ctx, list,
+		client.InNamespace(ds.Namespace),
+		client.MatchingLabels{otv1alpha1.LabelHeld: "true"},
+	); err != nil {
+		// Without KubeVirt installed there is nothing to release.
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return fmt.Errorf("listing held VirtualMachines: %w", err)
+	}
+
+	synced := ds.Status.Phase == otv1alpha1.DataSyncPhaseSucceeded
+	for i := range list.Items {
+		vm := &list.Items[i]
+		if kubevirt.HeldFor(vm) != ds.Name {
+			continue
+		}
+		var strategy string
+		if synced {
+			kubevirt.Release(vm)
+		} else {
+			strategy = kubevirt.Unhold(vm)
+		}
+		if err := r.Update(ctx, vm); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("releasing VirtualMachine %s: %w", vm.GetName(), err)
+		}
+		logf.FromContext(ctx).Info("released VirtualMachine", "virtualMachine", vm.GetName(), "phase", ds.Status.Phase)
+		if !synced {
+			r.Recorder.Eventf(vm, corev1.EventTypeWarning, "Unheld",
+				"DataSync %s was deleted before it synced; left halted instead of starting with run strategy %s",
+				ds.Name, strategy)
+			continue
+		}
+		r.Recorder.Eventf(vm, corev1.EventTypeNormal, "Released",
+			"DataSync %s has synced; starting with run strategy %s", ds.Name, kubevirt.RunStrategy(vm))
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager. Jobs verifying
+// checksums and applying deltas are watched through the DataSync label they carry, and only the
+// metadata of Secrets is watched, to notice rotated credentials. Held
+// VirtualMachines are watched when KubeVirt is installed, so a VirtualMachine
+// held just as its DataSync succeeded is released as well.
+func (r *DataSyncReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&otv1alpha1.DataSync{}).
+		Owns(cdi.NewDataVolume()).
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(jobFor)).
+		WatchesMetadata(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.rejectedBy)).
+		WatchesRawSource(r.Queue.Source())
+
+	gvk := kubevirt.VirtualMachineGVK
+	if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+		vm := &unstructured.Unstructured{}
+		vm.SetGroupVersionKind(gvk)
+		b = b.Watches(vm, handler.EnqueueRequestsFromMapFunc(heldFor),
+			builder.WithPredicates(predicate.NewPredicateFuncs(func(o client.Object) bool {
+				return o.GetLabels()[otv1alpha1.LabelHeld] == "true"
+			})))
+	}
+
+	return b.Named("datasync").Complete(r)
+}
+
+// heldFor maps a held VirtualMachine to the DataSync it waits for.
+func heldFor(_ context.Context, o client.Object) []reconcile.Request {
+	name := o.GetAnnotations()[otv1alpha1.AnnotationHeldFor]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: o.GetNamespace(), Name: name}}}
+}
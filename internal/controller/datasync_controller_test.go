@@ -0,0 +1,1074 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/breaker"
+	"pelotech/ot-sync-operator/internal/cdi"
+	"pelotech/ot-sync-operator/internal/egress"
+	"pelotech/ot-sync-operator/internal/kubevirt"
+	"pelotech/ot-sync-operator/internal/policy"
+	"pelotech/ot-sync-operator/internal/preflight"
+	"pelotech/ot-sync-operator/internal/queue"
+	"pelotech/ot-sync-operator/internal/retry"
+)
+
+// diskSizer reports the same disk size for every source.
+type diskSizer int64
+
+func (s diskSizer) DiskSize(context.Context, preflight.Source) (int64, error) {
+	return int64(s), nil
+}
+
+var _ = Describe("DataSync Controller", func() {
+	const resourceName = "sync-workspace-035"
+
+	var (
+		ctx                 context.Context
+		k8sClient           client.Client
+		controllerReconcile *DataSyncReconciler
+		store               *policy.Store
+		typeNamespacedName  = types.NamespacedName{Name: resourceName, Namespace: "default"}
+	)
+
+	reconcileOnce := func() {
+		_, err := controllerReconcile.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	fetch := func() *otv1alpha1.DataSync {
+		ds := &otv1alpha1.DataSync{}
+		Expect(k8sClient.Get(ctx, typeNamespacedName, ds)).To(Succeed())
+		return ds
+	}
+
+	setDataVolumePhase := func(name string, phase cdi.DataVolumePhase) {
+		dv := cdi.NewDataVolume()
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, dv)).To(Succeed())
+		Expect(unstructured.SetNestedField(dv.Object, string(phase), "status", "phase")).To(Succeed())
+		Expect(k8sClient.Update(ctx, dv)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		k8sClient = newFakeClient(&otv1alpha1.DataSync{
+			ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+			Spec: otv1alpha1.DataSyncSpec{
+				WorkspaceID: "035",
+				VMs: []otv1alpha1.DataSyncVM{
+					{Name: "controller", URL: "https://mirror.example.com/controller.qcow2", SourceType: otv1alpha1.SourceTypeHTTP},
+					{Name: "worker", URL: "docker://registry.example.com/worker:1", SourceType: otv1alpha1.SourceTypeRegistry},
+				},
+			},
+		})
+		store = policy.NewStore()
+		store.Set(policy.Defaults())
+		controllerReconcile = &DataSyncReconciler{
+			Client:      k8sClient,
+			Scheme:      testScheme,
+			Recorder:    record.NewFakeRecorder(100),
+			Queue:       queue.New(k8sClient, store),
+			Policy:      store,
+			RetryBudget: retry.NewBudget(),
+			Egress:      egress.NewLedger(k8sClient, k8sClient, "ot-sync-operator-system"),
+			Breakers:    breaker.New(),
+		}
+	})
+
+	It("should queue a new DataSync", func() {
+		reconcileOnce()
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		Expect(meta.IsStatusConditionFalse(ds.Status.Conditions, otv1alpha1.ConditionReady)).To(BeTrue())
+	})
+
+	It("should create an owned DataVolume per VM and start syncing", func() {
+		reconcileOnce()
+		reconcileOnce()
+		Expect(fetch().Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSyncing))
+		Expect(fetch().Status.EstimatedBytes).To(Equal(int64(20<<30)), "two disks of the default volume size")
+
+		list := cdi.NewDataVolumeList()
+		Expect(k8sClient.List(ctx, list, client.InNamespace("default"))).To(Succeed())
+		Expect(list.Items).To(HaveLen(2))
+		for _, dv := range list.Items {
+			Expect(dv.GetLabels()).To(HaveKeyWithValue(otv1alpha1.LabelWorkspaceID, "035"))
+			Expect(dv.GetOwnerReferences()).To(HaveLen(1))
+			Expect(dv.GetOwnerReferences()[0].Name).To(Equal(resourceName))
+		}
+
+		dv := cdi.NewDataVolume()
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-worker", Namespace: "default"}, dv)).
+			To(Succeed())
+		url, _, _ := unstructured.NestedString(dv.Object, "spec", "source", "registry", "url")
+		Expect(url).To(Equal("docker://registry.example.com/worker:1"))
+	})
+
+	It("should map typed sources onto their CDI sources", func() {
+		ds := fetch()
+		ds.Spec.VMs[0].HTTP = &otv1alpha1.DataSyncHTTPSource{
+			Headers:          []otv1alpha1.DataSyncHTTPHeader{{Name: "X-Mirror-Token", Value: "abc"}},
+			HeadersSecretRef: "mirror-token",
+		}
+		ds.Spec.VMs[1] = otv1alpha1.DataSyncVM{Name: "worker", SourceType: otv1alpha1.SourceTypePVC,
+			PVC: &otv1alpha1.DataSyncVolumeSource{Name: "golden-worker"}}
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+
+		reconcileOnce()
+		reconcileOnce()
+		Expect(fetch().Status.EstimatedBytes).To(Equal(int64(10<<30)), "clones do not download anything")
+
+		dv := cdi.NewDataVolume()
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-controller", Namespace: "default"}, dv)).
+			To(Succeed())
+		headers, _, _ := unstructured.NestedStringSlice(dv.Object, "spec", "source", "http", "extraHeaders")
+		Expect(headers).To(Equal([]string{"X-Mirror-Token: abc"}))
+		secretHeaders, _, _ := unstructured.NestedStringSlice(dv.Object, "spec", "source", "http", "secretExtraHeaders")
+		Expect(secretHeaders).To(Equal([]string{"mirror-token"}))
+
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-worker", Namespace: "default"}, dv)).
+			To(Succeed())
+		pvc, _, _ := unstructured.NestedStringMap(dv.Object, "spec", "source", "pvc")
+		Expect(pvc).To(Equal(map[string]string{"namespace": "default", "name": "golden-worker"}))
+		_, sized, _ := unstructured.NestedFieldNoCopy(dv.Object, "spec", "storage", "resources")
+		Expect(sized).To(BeFalse(), "CDI sizes the clone after its source")
+	})
+
+	It("should fail instead of cloning volumes of other namespaces", func() {
+		ds := fetch()
+		ds.Spec.VMs[1] = otv1alpha1.DataSyncVM{Name: "worker", SourceType: otv1alpha1.SourceTypePVC,
+			PVC: &otv1alpha1.DataSyncVolumeSource{Name: "golden-worker", Namespace: "images"}}
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+
+		reconcileOnce()
+		reconcileOnce()
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseFailed))
+		Expect(ds.Status.Message).To(ContainSubstring("golden-worker is in namespace images instead of default"))
+		Expect(controllerReconcile.Queue.Active()).To(BeZero())
+		dv := cdi.NewDataVolume()
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx,
+			types.NamespacedName{Name: resourceName + "-worker", Namespace: "default"}, dv))).To(BeTrue())
+	})
+
+	It("should succeed once every DataVolume has succeeded", func() {
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-controller", cdi.DataVolumePhaseSucceeded)
+		reconcileOnce()
+		Expect(fetch().Status.Message).To(Equal("1/2 volumes ready."))
+
+		setDataVolumePhase(resourceName+"-worker", cdi.DataVolumePhaseSucceeded)
+		reconcileOnce()
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSucceeded))
+		Expect(meta.IsStatusConditionTrue(ds.Status.Conditions, otv1alpha1.ConditionReady)).To(BeTrue())
+		Expect(controllerReconcile.Queue.Active()).To(BeZero())
+	})
+
+	It("should release held VirtualMachines once synced", func() {
+		vm := &unstructured.Unstructured{}
+		vm.SetGroupVersionKind(kubevirt.VirtualMachineGVK)
+		vm.SetName("workspace-035")
+		vm.SetNamespace("default")
+		Expect(unstructured.SetNestedField(vm.Object, kubevirt.RunStrategyAlways, "spec", "runStrategy")).To(Succeed())
+		Expect(kubevirt.Hold(vm, resourceName)).To(BeTrue())
+		Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-controller", cdi.DataVolumePhaseSucceeded)
+		setDataVolumePhase(resourceName+"-worker", cdi.DataVolumePhaseSucceeded)
+		reconcileOnce()
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(vm), vm)).To(Succeed())
+		Expect(kubevirt.HeldFor(vm)).To(Equal(resourceName))
+
+		reconcileOnce()
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(vm), vm)).To(Succeed())
+		Expect(kubevirt.HeldFor(vm)).To(BeEmpty())
+		Expect(kubevirt.RunStrategy(vm)).To(Equal(kubevirt.RunStrategyAlways))
+	})
+
+	It("should keep VirtualMachines held while the DataSync is failed", func() {
+		p := policy.Defaults()
+		p.RetryLimit = 0
+		store.Set(p)
+		vm := &unstructured.Unstructured{}
+		vm.SetGroupVersionKind(kubevirt.VirtualMachineGVK)
+		vm.SetName("workspace-035")
+		vm.SetNamespace("default")
+		Expect(unstructured.SetNestedField(vm.Object, kubevirt.RunStrategyAlways, "spec", "runStrategy")).To(Succeed())
+		Expect(kubevirt.Hold(vm, resourceName)).To(BeTrue())
+		Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-worker", cdi.DataVolumePhaseFailed)
+		reconcileOnce()
+		Expect(fetch().Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseFailed))
+
+		reconcileOnce()
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(vm), vm)).To(Succeed())
+		Expect(kubevirt.HeldFor(vm)).To(Equal(resourceName))
+		Expect(kubevirt.RunStrategy(vm)).To(Equal(kubevirt.RunStrategyHalted))
+	})
+
+	It("should unhold VirtualMachines but keep them halted when the DataSync is deleted before it synced", func() {
+		vm := &unstructured.Unstructured{}
+		vm.SetGroupVersionKind(kubevirt.VirtualMachineGVK)
+		vm.SetName("workspace-035")
+		vm.SetNamespace("default")
+		Expect(unstructured.SetNestedField(vm.Object, kubevirt.RunStrategyAlways, "spec", "runStrategy")).To(Succeed())
+		Expect(kubevirt.Hold(vm, resourceName)).To(BeTrue())
+		Expect(k8sClient.Create(ctx, vm)).To(Succeed())
+
+		reconcileOnce()
+		reconcileOnce()
+		Expect(k8sClient.Delete(ctx, fetch())).To(Succeed())
+		reconcileOnce()
+		Expect(k8sClient.Get(ctx, typeNamespacedName, &otv1alpha1.DataSync{})).To(Satisfy(apierrors.IsNotFound))
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(vm), vm)).To(Succeed())
+		Expect(kubevirt.HeldFor(vm)).To(BeEmpty())
+		Expect(vm.GetAnnotations()).NotTo(HaveKey(otv1alpha1.AnnotationHeldRunStrategy))
+		Expect(kubevirt.RunStrategy(vm)).To(Equal(kubevirt.RunStrategyHalted))
+	})
+
+	It("should make way for a more urgent DataSync when preempted", func() {
+		p := policy.Defaults()
+		p.Concurrency = 1
+		p.PriorityClasses = map[string]int{"release-day": 100}
+		p.Preemption = policy.PreemptionPause
+		store.Set(p)
+
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-controller", cdi.DataVolumePhaseSucceeded)
+
+		urgent := &otv1alpha1.DataSync{
+			ObjectMeta: metav1.ObjectMeta{Name: "release", Namespace: "default"},
+			Spec: otv1alpha1.DataSyncSpec{
+				WorkspaceID:       "036",
+				PriorityClassName: "release-day",
+				VMs:               fetch().Spec.VMs,
+			},
+			Status: otv1alpha1.DataSyncStatus{Phase: otv1alpha1.DataSyncPhaseQueued},
+		}
+		d, err := controllerReconcile.Queue.Admit(ctx, urgent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Reason).To(Equal("Request is preempting default/" + resourceName + "."))
+
+		reconcileOnce()
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		Expect(ds.Status.Message).To(Equal("Preempted by default/release; requeued."))
+		Expect(ds.Status.Preemptions).To(Equal(int32(1)))
+		Expect(ds.Status.LastPreemption.Mode).To(Equal("pause"))
+
+		// The finished volume is kept and the preempted attempt is not a retry.
+		list := cdi.NewDataVolumeList()
+		Expect(k8sClient.List(ctx, list, client.InNamespace("default"))).To(Succeed())
+		Expect(list.Items).To(HaveLen(1))
+		Expect(list.Items[0].GetName()).To(Equal(resourceName + "-controller"))
+
+		d, _ = controllerReconcile.Queue.Admit(ctx, urgent)
+		Expect(d.Admitted).To(BeTrue())
+	})
+
+	It("should account the bytes of every attempt", func() {
+		setProgress := func(name, uid string, phase cdi.DataVolumePhase, progress string) {
+			dv := cdi.NewDataVolume()
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, dv)).To(Succeed())
+			dv.SetUID(types.UID(uid))
+			Expect(unstructured.SetNestedField(dv.Object, string(phase), "status", "phase")).To(Succeed())
+			Expect(unstructured.SetNestedField(dv.Object, progress, "status", "progress")).To(Succeed())
+			Expect(k8sClient.Update(ctx, dv)).To(Succeed())
+		}
+
+		reconcileOnce()
+		reconcileOnce()
+		setProgress(resourceName+"-controller", "controller-1", "ImportInProgress", "50.00%")
+		setProgress(resourceName+"-worker", "worker-1", "ImportInProgress", "N/A")
+		reconcileOnce()
+		Expect(fetch().Status.BytesTransferred).To(Equal(int64(5 << 30)))
+
+		// The bytes of a failed import stay accounted for.
+		setProgress(resourceName+"-worker", "worker-1", cdi.DataVolumePhaseFailed, "25.00%")
+		reconcileOnce()
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		Expect(ds.Status.BytesTransferred).To(Equal(int64(5<<30 + 10<<30/4)))
+		Expect(ds.Status.Transfers).To(ContainElement(otv1alpha1.DataSyncTransfer{
+			Name: "worker", Host: "registry.example.com", TotalBytes: 10 << 30, Bytes: 10 << 30 / 4, DataVolumeUID: "worker-1",
+		}))
+
+		u, err := controllerReconcile.Egress.Usage(ctx, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.Bytes).To(Equal(ds.Status.BytesTransferred))
+	})
+
+	It("should not admit DataSyncs once the monthly egress budget is exhausted", func() {
+		p := policy.Defaults()
+		p.MonthlyEgressBudget = policy.EgressBudget{Bytes: 1 << 30}
+		store.Set(p)
+		Expect(controllerReconcile.Egress.Record(ctx, time.Now(), "mirror.example.com", 2<<30, 0)).To(Succeed())
+
+		reconcileOnce()
+		reconcileOnce()
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		Expect(ds.Status.Message).To(HavePrefix("Monthly egress budget exhausted (2.1 GB of 1.1 GB used)"))
+		Expect(controllerReconcile.Queue.Active()).To(BeZero())
+	})
+
+	It("should schedule a retry with backoff when a DataVolume fails", func() {
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-controller", cdi.DataVolumePhaseSucceeded)
+		setDataVolumePhase(resourceName+"-worker", cdi.DataVolumePhaseFailed)
+		reconcileOnce()
+
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		Expect(ds.Status.Attempts).To(Equal(int32(1)))
+		Expect(ds.Status.NextRetryTime).NotTo(BeNil())
+		Expect(ds.Status.NextRetryTime.Time).To(BeTemporally(">", time.Now().Add(4*time.Minute)))
+		Expect(controllerReconcile.Queue.Active()).To(BeZero())
+
+		// Only the failed DataVolume is deleted; the succeeded one is kept.
+		list := cdi.NewDataVolumeList()
+		Expect(k8sClient.List(ctx, list, client.InNamespace("default"))).To(Succeed())
+		Expect(list.Items).To(HaveLen(1))
+		Expect(list.Items[0].GetName()).To(Equal(resourceName + "-controller"))
+
+		// The retry does not start before the backoff has elapsed.
+		reconcileOnce()
+		Expect(fetch().Status.Attempts).To(Equal(int32(1)))
+
+		ds = fetch()
+		ds.Status.NextRetryTime = &metav1.Time{Time: time.Now().Add(-time.Second)}
+		Expect(k8sClient.Status().Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSyncing))
+		Expect(ds.Status.Attempts).To(Equal(int32(2)))
+		Expect(k8sClient.List(ctx, list, client.InNamespace("default"))).To(Succeed())
+		Expect(list.Items).To(HaveLen(2))
+	})
+
+	Context("When a VM entry has a checksum", func() {
+		const checksum = "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+		jobKey := types.NamespacedName{Name: resourceName + "-controller-verify", Namespace: "default"}
+
+		finishJob := func(condition batchv1.JobCondition) {
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, jobKey, job)).To(Succeed())
+			condition.Status = corev1.ConditionTrue
+			job.Status.Conditions = append(job.Status.Conditions, condition)
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			controllerReconcile.Sizer = diskSizer(3_221_291_008)
+			controllerReconcile.Reader = k8sClient
+			ds := fetch()
+			ds.Spec.VMs[0].Checksum = checksum
+			Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+
+			reconcileOnce()
+			reconcileOnce()
+			setDataVolumePhase(resourceName+"-controller", cdi.DataVolumePhaseSucceeded)
+			setDataVolumePhase(resourceName+"-worker", cdi.DataVolumePhaseSucceeded)
+			reconcileOnce()
+			Expect(fetch().Status.Message).To(Equal("1/2 volumes ready."), "waits for the PVC before verifying")
+
+			Expect(k8sClient.Create(ctx, &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-controller", Namespace: "default"},
+				Spec:       corev1.PersistentVolumeClaimSpec{VolumeMode: ptr.To(corev1.PersistentVolumeBlock)},
+			})).To(Succeed())
+			reconcileOnce()
+			Expect(fetch().Status.Message).To(Equal("1/2 volumes ready."))
+		})
+
+		It("should hash the volume in a Job owned by the DataVolume", func() {
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, jobKey, job)).To(Succeed())
+			Expect(job.OwnerReferences).To(HaveLen(1))
+			Expect(job.OwnerReferences[0].Name).To(Equal(resourceName + "-controller"))
+			container := job.Spec.Template.Spec.Containers[0]
+			Expect(container.Image).To(Equal(DefaultVerifierImage))
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "EXPECTED", Value: checksum}))
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "SIZE", Value: "3221291008"}),
+				"only the disk is hashed, not the space it was grown by")
+			Expect(container.VolumeDevices).To(HaveLen(1), "block volumes are hashed as a device")
+			podSecurity := job.Spec.Template.Spec.SecurityContext
+			Expect(podSecurity.RunAsNonRoot).To(Equal(ptr.To(true)))
+			Expect(podSecurity.SeccompProfile.Type).To(Equal(corev1.SeccompProfileTypeRuntimeDefault))
+		})
+
+		It("should keep the name of the Job short enough for labels", func() {
+			dv := cdi.NewDataVolume()
+			dv.SetName(resourceName + "-" + strings.Repeat("controller", 6))
+			name := verifyJobName(dv)
+			Expect(validation.IsValidLabelValue(name)).To(BeEmpty())
+			Expect(validation.IsDNS1123Subdomain(name)).To(BeEmpty())
+		})
+
+		It("should succeed once the checksum is verified", func() {
+			finishJob(batchv1.JobCondition{Type: batchv1.JobComplete})
+			reconcileOnce()
+			Expect(fetch().Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSucceeded))
+
+			dv := cdi.NewDataVolume()
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-controller", Namespace: "default"}, dv)).
+				To(Succeed())
+			Expect(dv.GetAnnotations()).To(HaveKeyWithValue(otv1alpha1.AnnotationChecksumVerified, checksum))
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, jobKey, &batchv1.Job{}))).To(BeTrue())
+		})
+
+		It("should retry the VM with a ChecksumMismatch reason when the checksum differs", func() {
+			Expect(k8sClient.Create(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: jobKey.Name + "-x7k2p", Namespace: "default",
+					Labels: map[string]string{batchv1.JobNameLabel: jobKey.Name}},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+					Name: "verify",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						ExitCode: 3,
+						Message:  "expected " + checksum + ", got sha256:e3b0c442",
+					}},
+				}}},
+			})).To(Succeed())
+			finishJob(batchv1.JobCondition{Type: batchv1.JobFailed, Reason: batchv1.JobReasonPodFailurePolicy})
+			reconcileOnce()
+
+			ds := fetch()
+			Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+			Expect(ds.Status.NextRetryTime).NotTo(BeNil())
+			Expect(ds.Status.Message).To(ContainSubstring("ChecksumMismatch: expected " + checksum + ", got sha256:e3b0c442"))
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx,
+				types.NamespacedName{Name: resourceName + "-controller", Namespace: "default"}, cdi.NewDataVolume()))).
+				To(BeTrue(), "the mismatching disk is imported again")
+		})
+	})
+
+	It("should share a disk another DataSync is syncing instead of downloading it again", func() {
+		const checksum = "sha256:3b5d5c3712955042212316173ccf37be800d8b3e2b2cae37a2b2c4e2b1e4c0a9"
+		ds := fetch()
+		ds.Spec.VMs[0].Checksum = checksum
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+		other := &otv1alpha1.DataSync{
+			ObjectMeta: metav1.ObjectMeta{Name: "sync-workspace-036", Namespace: "default"},
+			Spec: otv1alpha1.DataSyncSpec{
+				WorkspaceID: "036",
+				VMs: []otv1alpha1.DataSyncVM{
+					{Name: "base", URL: "https://cdn.example.com/base.qcow2", SourceType: otv1alpha1.SourceTypeHTTP,
+						Checksum: checksum},
+					{Name: "tools", URL: "https://mirror.example.com/tools.qcow2", SourceType: otv1alpha1.SourceTypeHTTP},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, other)).To(Succeed())
+		reconcileOther := func() ctrl.Result {
+			result, err := controllerReconcile.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(other)})
+			Expect(err).NotTo(HaveOccurred())
+			return result
+		}
+
+		reconcileOnce()
+		reconcileOnce()
+		reconcileOther()
+		reconcileOther()
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(other), other)).To(Succeed())
+		Expect(other.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSyncing))
+		Expect(other.Status.EstimatedBytes).To(Equal(int64(10<<30)), "the shared disk is not downloaded")
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx,
+			types.NamespacedName{Name: "sync-workspace-036-base", Namespace: "default"}, cdi.NewDataVolume()))).
+			To(BeTrue(), "waits for the download of the other DataSync")
+		Expect(reconcileOther().RequeueAfter).To(Equal(queueRecheckInterval))
+
+		dv := cdi.NewDataVolume()
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-controller", Namespace: "default"}, dv)).
+			To(Succeed())
+		Expect(dv.GetLabels()).To(HaveKeyWithValue(otv1alpha1.LabelContentKey, checksum[7:70]))
+		Expect(unstructured.SetNestedField(dv.Object, string(cdi.DataVolumePhaseSucceeded), "status", "phase")).To(Succeed())
+		dv.SetAnnotations(map[string]string{otv1alpha1.AnnotationChecksumVerified: checksum})
+		Expect(k8sClient.Update(ctx, dv)).To(Succeed())
+
+		reconcileOther()
+		clone := cdi.NewDataVolume()
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "sync-workspace-036-base", Namespace: "default"}, clone)).
+			To(Succeed())
+		pvc, _, _ := unstructured.NestedStringMap(clone.Object, "spec", "source", "pvc")
+		Expect(pvc).To(Equal(map[string]string{"namespace": "default", "name": resourceName + "-controller"}))
+		Expect(clone.GetAnnotations()).To(HaveKeyWithValue(otv1alpha1.AnnotationClonedFrom, "default/"+resourceName+"-controller"))
+		Expect(clone.GetAnnotations()).To(HaveKeyWithValue(otv1alpha1.AnnotationChecksumVerified, checksum))
+	})
+
+	It("should not share disks with DataSyncs in other namespaces", func() {
+		const checksum = "sha256:3b5d5c3712955042212316173ccf37be800d8b3e2b2cae37a2b2c4e2b1e4c0a9"
+		ds := fetch()
+		ds.Spec.VMs[0].Checksum = checksum
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		reconcileOnce()
+		dv := cdi.NewDataVolume()
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-controller", Namespace: "default"}, dv)).
+			To(Succeed())
+		Expect(unstructured.SetNestedField(dv.Object, string(cdi.DataVolumePhaseSucceeded), "status", "phase")).To(Succeed())
+		dv.SetAnnotations(map[string]string{otv1alpha1.AnnotationChecksumVerified: checksum})
+		Expect(k8sClient.Update(ctx, dv)).To(Succeed())
+
+		other := &otv1alpha1.DataSync{
+			ObjectMeta: metav1.ObjectMeta{Name: "sync-workspace-036", Namespace: "tenant-b"},
+			Spec: otv1alpha1.DataSyncSpec{
+				WorkspaceID: "036",
+				VMs: []otv1alpha1.DataSyncVM{{Name: "base", URL: "https://cdn.example.com/base.qcow2",
+					SourceType: otv1alpha1.SourceTypeHTTP, Checksum: checksum}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, other)).To(Succeed())
+		for range 2 {
+			_, err := controllerReconcile.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(other)})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		own := cdi.NewDataVolume()
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "sync-workspace-036-base", Namespace: "tenant-b"}, own)).
+			To(Succeed())
+		url, _, _ := unstructured.NestedString(own.Object, "spec", "source", "http", "url")
+		Expect(url).To(Equal("https://cdn.example.com/base.qcow2"))
+		Expect(own.GetAnnotations()).NotTo(HaveKey(otv1alpha1.AnnotationClonedFrom))
+	})
+
+	It("should clone the previous version of a workspace and apply only the delta", func() {
+		controllerReconcile.DeltaImage = "quay.io/pelotech/qemu-img:9"
+		ds := fetch()
+		ds.Spec.Version = "1.0.0"
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-controller", cdi.DataVolumePhaseSucceeded)
+
+		next := &otv1alpha1.DataSync{
+			ObjectMeta: metav1.ObjectMeta{Name: "sync-workspace-035-v2", Namespace: "default"},
+			Spec: otv1alpha1.DataSyncSpec{
+				WorkspaceID: "035",
+				Version:     "1.1.0",
+				VMs: []otv1alpha1.DataSyncVM{{
+					Name: "controller", URL: "https://mirror.example.com/controller-1.1.qcow2", SourceType: otv1alpha1.SourceTypeHTTP,
+					Delta: &otv1alpha1.DataSyncDeltaSource{
+						URL: "https://mirror.example.com/controller-1.0-1.1.qcow2", BaseVersion: "1.0.0"},
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, next)).To(Succeed())
+		reconcileNext := func() {
+			_, err := controllerReconcile.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(next)})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		reconcileNext()
+		reconcileNext()
+
+		dvKey := types.NamespacedName{Name: "sync-workspace-035-v2-controller", Namespace: "default"}
+		clone := cdi.NewDataVolume()
+		Expect(k8sClient.Get(ctx, dvKey, clone)).To(Succeed())
+		pvc, _, _ := unstructured.NestedStringMap(clone.Object, "spec", "source", "pvc")
+		Expect(pvc).To(Equal(map[string]string{"namespace": "default", "name": resourceName + "-controller"}))
+		Expect(clone.GetAnnotations()).To(HaveKeyWithValue(otv1alpha1.AnnotationDeltaBase, "default/"+resourceName+"-controller"))
+
+		setDataVolumePhase(dvKey.Name, cdi.DataVolumePhaseSucceeded)
+		Expect(k8sClient.Create(ctx, &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: dvKey.Name, Namespace: "default"},
+		})).To(Succeed())
+		reconcileNext()
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(next), next)).To(Succeed())
+		Expect(next.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSyncing), "the clone is not ready before the delta is applied")
+
+		job := &batchv1.Job{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: dvKey.Name + "-delta", Namespace: "default"}, job)).To(Succeed())
+		container := job.Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal("quay.io/pelotech/qemu-img:9"))
+		Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "DELTA_URL", Value: next.Spec.VMs[0].Delta.URL}))
+		Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "disk", MountPath: "/data"}))
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+
+		reconcileNext()
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(next), next)).To(Succeed())
+		Expect(next.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSucceeded))
+		Expect(k8sClient.Get(ctx, dvKey, clone)).To(Succeed())
+		Expect(clone.GetAnnotations()).To(HaveKeyWithValue(otv1alpha1.AnnotationDeltaApplied, next.Spec.VMs[0].Delta.URL))
+	})
+
+	It("should download the whole disk unless the base version of the delta was synced", func() {
+		controllerReconcile.DeltaImage = "quay.io/pelotech/qemu-img:9"
+		ds := fetch()
+		ds.Spec.Version = "1.0.0"
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-controller", cdi.DataVolumePhaseSucceeded)
+		setDataVolumePhase(resourceName+"-worker", cdi.DataVolumePhaseSucceeded)
+
+		next := &otv1alpha1.DataSync{
+			ObjectMeta: metav1.ObjectMeta{Name: "sync-workspace-035-v2", Namespace: "default"},
+			Spec: otv1alpha1.DataSyncSpec{
+				WorkspaceID: "035",
+				Version:     "1.1.0",
+				VMs: []otv1alpha1.DataSyncVM{{
+					Name: "controller", URL: "https://mirror.example.com/controller-1.1.qcow2", SourceType: otv1alpha1.SourceTypeHTTP,
+					Delta: &otv1alpha1.DataSyncDeltaSource{
+						URL: "https://mirror.example.com/controller-0.9-1.1.qcow2", BaseVersion: "0.9.0"},
+				}, {
+					Name: "worker", URL: "https://mirror.example.com/worker-1.1.qcow2", SourceType: otv1alpha1.SourceTypeHTTP,
+					Delta: &otv1alpha1.DataSyncDeltaSource{URL: "https://mirror.example.com/worker-1.0-1.1.qcow2"},
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, next)).To(Succeed())
+		for range 2 {
+			_, err := controllerReconcile.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(next)})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		for _, vm := range next.Spec.VMs {
+			dv := cdi.NewDataVolume()
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "sync-workspace-035-v2-" + vm.Name, Namespace: "default"}, dv)).
+				To(Succeed())
+			url, _, _ := unstructured.NestedString(dv.Object, "spec", "source", "http", "url")
+			Expect(url).To(Equal(vm.URL), "1.0.0 is not the base of the delta of %s", vm.Name)
+			Expect(dv.GetAnnotations()).NotTo(HaveKey(otv1alpha1.AnnotationDeltaBase))
+		}
+	})
+
+	It("should keep the name of the delta Job short enough for labels", func() {
+		dv := cdi.NewDataVolume()
+		dv.SetName(resourceName + "-v2-" + strings.Repeat("controller", 6))
+		name := deltaJobName(dv)
+		Expect(validation.IsValidLabelValue(name)).To(BeEmpty())
+		Expect(validation.IsDNS1123Subdomain(name)).To(BeEmpty())
+	})
+	It("should hold DataSyncs without using retries while their source host is down", func() {
+		p := policy.Defaults()
+		p.RetryLimit = 0
+		p.CircuitBreakerThreshold = 1
+		store.Set(p)
+
+		reconcileOnce()
+		reconcileOnce()
+		dv := cdi.NewDataVolume()
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-controller", Namespace: "default"}, dv)).
+			To(Succeed())
+		Expect(unstructured.SetNestedField(dv.Object, string(cdi.DataVolumePhaseFailed), "status", "phase")).To(Succeed())
+		Expect(unstructured.SetNestedSlice(dv.Object, []any{map[string]any{
+			"type":    "Running",
+			"status":  "False",
+			"message": "Unable to connect to http data source: expected status code 200, got 503. Status: 503 Service Unavailable",
+		}}, "status", "conditions")).To(Succeed())
+		Expect(k8sClient.Update(ctx, dv)).To(Succeed())
+
+		reconcileOnce()
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		Expect(ds.Status.Message).To(HaveSuffix("source host mirror.example.com is down, waiting for it to recover."))
+		Expect(ds.Status.Outages).To(Equal(int32(1)))
+		Expect(controllerReconcile.Breakers.State("mirror.example.com")).To(Equal(breaker.Open))
+
+		reconcileOnce()
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		Expect(ds.Status.Message).To(HavePrefix("Source host mirror.example.com is unavailable after 1 consecutive failures"))
+		Expect(ds.Status.Attempts).To(Equal(int32(1)))
+	})
+
+	It("should re-arm a DataSync whose credentials were rejected once they are rotated", func() {
+		p := policy.Defaults()
+		p.RetryLimit = 0
+		store.Set(p)
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "mirror-basic-auth", Namespace: "default"},
+			Data:       map[string][]byte{"accessKeyId": []byte("sync"), "secretKey": []byte("expired")},
+		}
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+		ds := fetch()
+		ds.Spec.VMs[0].SecretRef = secret.Name
+		ds.Spec.VMs[0].CertConfigMapRef = "internal-ca"
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+
+		reconcileOnce()
+		reconcileOnce()
+		dv := cdi.NewDataVolume()
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-controller", Namespace: "default"}, dv)).
+			To(Succeed())
+		source, _, _ := unstructured.NestedStringMap(dv.Object, "spec", "source", "http")
+		Expect(source).To(HaveKeyWithValue("secretRef", secret.Name))
+		Expect(source).To(HaveKeyWithValue("certConfigMap", "internal-ca"))
+
+		Expect(unstructured.SetNestedField(dv.Object, string(cdi.DataVolumePhaseFailed), "status", "phase")).To(Succeed())
+		Expect(unstructured.SetNestedSlice(dv.Object, []any{map[string]any{
+			"type":    "Running",
+			"status":  "False",
+			"message": "Unable to connect to http data source: expected status code 200, got 401. Status: 401 Unauthorized",
+		}}, "status", "conditions")).To(Succeed())
+		Expect(k8sClient.Update(ctx, dv)).To(Succeed())
+		reconcileOnce()
+
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseFailed))
+		Expect(ds.Status.Message).To(ContainSubstring("the source rejected the credentials in Secret mirror-basic-auth"))
+		Expect(ds.Status.RejectedSecrets).To(HaveLen(1))
+		Expect(controllerReconcile.rejectedBy(ctx, secret)).To(ConsistOf(
+			reconcile.Request{NamespacedName: typeNamespacedName}))
+
+		// Nothing happens until the Secret changes.
+		reconcileOnce()
+		Expect(fetch().Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseFailed))
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+		secret.Data["secretKey"] = []byte("rotated")
+		Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+		reconcileOnce()
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		Expect(ds.Status.RejectedSecrets).To(BeEmpty())
+		Expect(ds.Status.NextRetryTime).To(BeNil())
+
+		reconcileOnce()
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSyncing))
+		Expect(ds.Status.Attempts).To(Equal(int32(2)))
+		Expect(retriesUsed(ds)).To(Equal(0), "the rejected attempt was forgiven")
+	})
+
+	It("should only start syncing inside the sync windows", func() {
+		// closed opens an hour from now, so it is closed for the test.
+		closed := fmt.Sprintf("0 %d * * * 30m", (time.Now().UTC().Hour()+1)%24)
+		p, err := policy.Parse(map[string]string{
+			policy.KeySyncWindows:          closed,
+			policy.KeySyncWindowExemptions: policy.ExemptOnDemand,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		store.Set(p)
+
+		reconcileOnce()
+		reconcileOnce()
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		Expect(ds.Status.Message).To(HavePrefix("Request is waiting for the next sync window at "))
+		Expect(controllerReconcile.Queue.Active()).To(BeZero())
+
+		// A launched workspace waiting on the DataSync does not wait for the window.
+		ds.Annotations = map[string]string{otv1alpha1.AnnotationOnDemand: "true"}
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		Expect(fetch().Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSyncing))
+	})
+
+	It("should stop unfinished imports when the sync windows close", func() {
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-controller", cdi.DataVolumePhaseSucceeded)
+
+		p, err := policy.Parse(map[string]string{
+			policy.KeySyncWindows:           fmt.Sprintf("0 %d * * * 30m", (time.Now().UTC().Hour()+1)%24),
+			policy.KeySyncWindowCloseAction: string(policy.WindowClosePause),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		store.Set(p)
+
+		reconcileOnce()
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		Expect(ds.Status.Message).To(HavePrefix("The sync window closed"))
+		Expect(ds.Status.Interruptions).To(Equal(int32(1)))
+		Expect(retriesUsed(ds)).To(Equal(-1))
+		Expect(controllerReconcile.Queue.Active()).To(BeZero())
+
+		list := cdi.NewDataVolumeList()
+		Expect(k8sClient.List(ctx, list, client.InNamespace("default"))).To(Succeed())
+		Expect(list.Items).To(HaveLen(1))
+		Expect(list.Items[0].GetName()).To(Equal(resourceName + "-controller"))
+	})
+
+	It("should stop unfinished imports while suspended and resume later", func() {
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-controller", cdi.DataVolumePhaseSucceeded)
+
+		ds := fetch()
+		ds.Spec.Suspend = true
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSuspended))
+		Expect(ds.Status.Suspensions).To(Equal(int32(1)))
+		Expect(retriesUsed(ds)).To(Equal(-1))
+		Expect(controllerReconcile.Queue.Active()).To(BeZero())
+
+		list := cdi.NewDataVolumeList()
+		Expect(k8sClient.List(ctx, list, client.InNamespace("default"))).To(Succeed())
+		Expect(list.Items).To(HaveLen(1))
+		Expect(list.Items[0].GetName()).To(Equal(resourceName + "-controller"))
+
+		ds.Spec.Suspend = false
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		Expect(fetch().Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		reconcileOnce()
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSyncing))
+		Expect(ds.Status.Attempts).To(Equal(int32(2)))
+		Expect(ds.Status.EstimatedBytes).To(Equal(int64(10<<30)), "only the disk that did not finish")
+	})
+
+	It("should not admit anything while the sync policy is paused", func() {
+		p := policy.Defaults()
+		p.Paused = true
+		store.Set(p)
+
+		reconcileOnce()
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSuspended))
+		Expect(ds.Status.Message).To(Equal("Suspended while the sync policy is paused."))
+
+		store.Set(policy.Defaults())
+		reconcileOnce()
+		reconcileOnce()
+		Expect(fetch().Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSyncing))
+	})
+
+	It("should delete every volume when cancelled", func() {
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-controller", cdi.DataVolumePhaseSucceeded)
+
+		ds := fetch()
+		ds.Annotations = map[string]string{otv1alpha1.AnnotationCancel: "true"}
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseCancelled))
+		Expect(controllerReconcile.Queue.Active()).To(BeZero())
+
+		list := cdi.NewDataVolumeList()
+		Expect(k8sClient.List(ctx, list, client.InNamespace("default"))).To(Succeed())
+		Expect(list.Items).To(BeEmpty())
+
+		// Cancelled DataSyncs are not synced again.
+		reconcileOnce()
+		Expect(fetch().Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseCancelled))
+	})
+
+	It("should fail once the retry limit is reached", func() {
+		p := policy.Defaults()
+		p.RetryLimit = 0
+		store.Set(p)
+
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-worker", cdi.DataVolumePhaseFailed)
+		reconcileOnce()
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseFailed))
+		Expect(ds.Status.Message).To(ContainSubstring("giving up after 1 attempts"))
+	})
+
+	It("should fail and free its slot when its DataVolumes are invalid", func() {
+		controllerReconcile.Client = interceptor.NewClient(k8sClient.(client.WithWatch), interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if obj.GetObjectKind().GroupVersionKind() == cdi.DataVolumeGVK {
+					return apierrors.NewInvalid(cdi.DataVolumeGVK.GroupKind(), obj.GetName(), nil)
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		})
+
+		reconcileOnce()
+		reconcileOnce()
+		ds := fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseFailed))
+		Expect(ds.Status.Message).To(HavePrefix("The DataVolumes are invalid"))
+		Expect(controllerReconcile.Queue.Active()).To(BeZero())
+	})
+
+	It("should hold retries back when the retry budget is exhausted", func() {
+		p := policy.Defaults()
+		p.RetryBudget = 1
+		store.Set(p)
+		ok, _ := controllerReconcile.RetryBudget.TryAcquire("default/other#2", time.Now(), p.RetryBudget, p.RetryBudgetWindow)
+		Expect(ok).To(BeTrue())
+
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-worker", cdi.DataVolumePhaseFailed)
+		reconcileOnce()
+
+		ds := fetch()
+		ds.Status.NextRetryTime = &metav1.Time{Time: time.Now().Add(-time.Second)}
+		Expect(k8sClient.Status().Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseQueued))
+		Expect(ds.Status.Message).To(HavePrefix("Retry budget exhausted"))
+		Expect(controllerReconcile.Queue.Active()).To(BeZero())
+	})
+
+	It("should charge the retry budget once for a retry that takes several tries to start", func() {
+		p := policy.Defaults()
+		p.RetryBudget = 1
+		store.Set(p)
+
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-worker", cdi.DataVolumePhaseFailed)
+		reconcileOnce()
+		ds := fetch()
+		ds.Status.NextRetryTime = &metav1.Time{Time: time.Now().Add(-time.Second)}
+		Expect(k8sClient.Status().Update(ctx, ds)).To(Succeed())
+
+		failing := true
+		controllerReconcile.Client = interceptor.NewClient(k8sClient.(client.WithWatch), interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if failing && obj.GetObjectKind().GroupVersionKind() == cdi.DataVolumeGVK {
+					return apierrors.NewServerTimeout(cdi.DataVolumeGVK.GroupVersion().WithResource("datavolumes").GroupResource(), "create", 1)
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		})
+		_, err := controllerReconcile.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+		Expect(err).To(HaveOccurred())
+
+		failing = false
+		reconcileOnce()
+		Expect(fetch().Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSyncing))
+		Expect(controllerReconcile.RetryBudget.Used(time.Now(), p.RetryBudgetWindow)).To(Equal(1))
+	})
+
+	It("should not charge the retry budget again to resume a suspended retry", func() {
+		p := policy.Defaults()
+		p.RetryBudget = 1
+		store.Set(p)
+
+		reconcileOnce()
+		reconcileOnce()
+		setDataVolumePhase(resourceName+"-worker", cdi.DataVolumePhaseFailed)
+		reconcileOnce()
+		ds := fetch()
+		ds.Status.NextRetryTime = &metav1.Time{Time: time.Now().Add(-time.Second)}
+		Expect(k8sClient.Status().Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		Expect(fetch().Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSyncing))
+
+		ds = fetch()
+		ds.Spec.Suspend = true
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSuspended))
+		ds.Spec.Suspend = false
+		Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+		reconcileOnce()
+		reconcileOnce()
+		ds = fetch()
+		Expect(ds.Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSyncing))
+		Expect(ds.Status.Attempts).To(Equal(int32(3)))
+		Expect(retriesUsed(ds)).To(Equal(1), "the resumed attempt is the first retry")
+		Expect(controllerReconcile.RetryBudget.Used(time.Now(), p.RetryBudgetWindow)).To(Equal(1))
+	})
+
+	Context("When a syncing DataSync is deleted", func() {
+		// deleteMidSync deletes the DataSync after one of its two imports
+		// completed and returns which DataVolumes and PVCs are left.
+		deleteMidSync := func(deletionPolicy otv1alpha1.DeletionPolicy) (dvs, pvcs []string) {
+			reconcileOnce()
+			ds := fetch()
+			Expect(ds.Finalizers).To(ContainElement(finalizer))
+			ds.Spec.DeletionPolicy = deletionPolicy
+			Expect(k8sClient.Update(ctx, ds)).To(Succeed())
+
+			reconcileOnce()
+			setDataVolumePhase(resourceName+"-controller", cdi.DataVolumePhaseSucceeded)
+			for _, vm := range []string{"controller", "worker"} {
+				Expect(k8sClient.Create(ctx, &corev1.PersistentVolumeClaim{
+					ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-" + vm, Namespace: "default"},
+				})).To(Succeed())
+			}
+			Expect(controllerReconcile.Queue.Active()).To(Equal(1))
+
+			Expect(k8sClient.Delete(ctx, fetch())).To(Succeed())
+			reconcileOnce()
+			Expect(controllerReconcile.Queue.Active()).To(BeZero())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, &otv1alpha1.DataSync{})).
+				To(Satisfy(apierrors.IsNotFound))
+
+			dvList := cdi.NewDataVolumeList()
+			Expect(k8sClient.List(ctx, dvList, client.InNamespace("default"))).To(Succeed())
+			for _, dv := range dvList.Items {
+				Expect(dv.GetOwnerReferences()).To(BeEmpty())
+				dvs = append(dvs, dv.GetName())
+			}
+			pvcList := &corev1.PersistentVolumeClaimList{}
+			Expect(k8sClient.List(ctx, pvcList, client.InNamespace("default"))).To(Succeed())
+			for _, pvc := range pvcList.Items {
+				pvcs = append(pvcs, pvc.Name)
+			}
+			return dvs, pvcs
+		}
+
+		It("should delete every DataVolume and PVC by default", func() {
+			dvs, pvcs := deleteMidSync("")
+			Expect(dvs).To(BeEmpty())
+			Expect(pvcs).To(BeEmpty())
+		})
+
+		It("should keep completed DataVolumes and PVCs with Retain", func() {
+			dvs, pvcs := deleteMidSync(otv1alpha1.DeletionPolicyRetain)
+			Expect(dvs).To(ConsistOf(resourceName + "-controller"))
+			Expect(pvcs).To(ConsistOf(resourceName + "-controller"))
+		})
+
+		It("should keep only completed PVCs with Orphan", func() {
+			dvs, pvcs := deleteMidSync(otv1alpha1.DeletionPolicyOrphan)
+			Expect(dvs).To(BeEmpty())
+			Expect(pvcs).To(ConsistOf(resourceName + "-controller"))
+		})
+	})
+})
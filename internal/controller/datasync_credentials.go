@@ -0,0 +1,140 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"regexp"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/cdi"
+)
+
+// authFailure matches import errors where the source rejected the
+// credentials it was given, as reported by http servers, registries and S3.
+var authFailure = regexp.MustCompile(`(?i)(status code:? 40[13]|got 40[13]|\b40[13] (unauthorized|forbidden)|unauthorized|authentication required|access ?denied|invalidaccesskeyid|signaturedoesnotmatch)`)
+
+// secretMetadata returns an empty Secret of which only the metadata is read.
+// The operator never needs the credentials themselves, so it does not cache
+// them.
+func secretMetadata() *metav1.PartialObjectMetadata {
+	secret := &metav1.PartialObjectMetadata{}
+	secret.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+	return secret
+}
+
+// rejectedSecrets returns the Secrets of the failed DataVolumes whose sources
+// rejected their credentials, along with the version that was rejected.
+func (r *DataSyncReconciler) rejectedSecrets(ctx context.Context, ds *otv1alpha1.DataSync, failed []*unstructured.Unstructured) ([]otv1alpha1.DataSyncRejectedSecret, error) {
+	var rejected []otv1alpha1.DataSyncRejectedSecret
+	for _, dv := range failed {
+		if !authFailure.MatchString(cdi.FailureMessage(dv)) {
+			continue
+		}
+		i := slices.IndexFunc(ds.Spec.VMs, func(vm otv1alpha1.DataSyncVM) bool {
+			return vm.Name == dv.GetLabels()[otv1alpha1.LabelVM]
+		})
+		if i < 0 {
+			continue
+		}
+		for _, name := range credentialSecrets(ds.Spec.VMs[i]) {
+			if slices.ContainsFunc(rejected, func(s otv1alpha1.DataSyncRejectedSecret) bool { return s.Name == name }) {
+				continue
+			}
+			secret := secretMetadata()
+			if err := r.Get(ctx, types.NamespacedName{Namespace: ds.Namespace, Name: name}, secret); client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			rejected = append(rejected, otv1alpha1.DataSyncRejectedSecret{Name: name, ResourceVersion: secret.ResourceVersion})
+		}
+	}
+	return rejected, nil
+}
+
+// credentialSecrets returns the Secrets a VM entry sends credentials from:
+// its credentials Secret and the Secret of its http headers.
+func credentialSecrets(vm otv1alpha1.DataSyncVM) []string {
+	var names []string
+	if vm.SecretRef != "" {
+		names = append(names, vm.SecretRef)
+	}
+	if vm.HTTP != nil && vm.HTTP.HeadersSecretRef != "" {
+		names = append(names, vm.HTTP.HeadersSecretRef)
+	}
+	return names
+}
+
+// rotatedSecret returns the name of a Secret ds failed with that changed
+// since, or "" if none did. A Secret that was deleted has not been rotated
+// yet.
+func (r *DataSyncReconciler) rotatedSecret(ctx context.Context, ds *otv1alpha1.DataSync) (string, error) {
+	for _, rejected := range ds.Status.RejectedSecrets {
+		secret := secretMetadata()
+		err := r.Get(ctx, types.NamespacedName{Namespace: ds.Namespace, Name: rejected.Name}, secret)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if secret.ResourceVersion != rejected.ResourceVersion {
+			return rejected.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// rearm queues a DataSync whose rejected credentials were rotated again. The
+// attempts it used so far are forgiven and it does not wait for its retry
+// time, so the new credentials are tried right away.
+func (r *DataSyncReconciler) rearm(ctx context.Context, ds *otv1alpha1.DataSync, secret string) error {
+	logf.FromContext(ctx).Info("re-armed sync", "secret", secret)
+	r.Recorder.Eventf(ds, corev1.EventTypeNormal, "Rearmed", "Secret %s was rotated; retrying with the new credentials", secret)
+	ds.Status.RearmedAttempts += int32(retriesUsed(ds) + 1)
+	ds.Status.RejectedSecrets = nil
+	ds.Status.NextRetryTime = nil
+	return r.setPhase(ctx, ds, otv1alpha1.DataSyncPhaseQueued, "Request is waiting for an available worker.")
+}
+
+// rejectedBy maps a Secret to the DataSyncs in its namespace whose sources
+// rejected it.
+func (r *DataSyncReconciler) rejectedBy(ctx context.Context, o client.Object) []reconcile.Request {
+	list := &otv1alpha1.DataSyncList{}
+	if err := r.List(ctx, list, client.InNamespace(o.GetNamespace())); err != nil {
+		logf.FromContext(ctx).Error(err, "listing DataSyncs for rotated Secret", "secret", o.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, ds := range list.Items {
+		if slices.ContainsFunc(ds.Status.RejectedSecrets, func(s otv1alpha1.DataSyncRejectedSecret) bool {
+			return s.Name == o.GetName()
+		}) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ds)})
+		}
+	}
+	return requests
+}
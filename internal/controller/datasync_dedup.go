@@ -0,0 +1,115 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/cdi"
+)
+
+// contentKey returns the value of the content key label of the DataVolume of
+// a VM entry, or "" if its disk cannot be shared. Only downloads with a
+// checksum are shared: the checksum verification guarantees that every
+// DataVolume with the same key holds the same disk. Label values are limited
+// to 63 characters, which still leaves 252 bits of the digest.
+func contentKey(vm otv1alpha1.DataSyncVM) string {
+	if !vm.SourceType.Remote() || vm.Checksum == "" {
+		return ""
+	}
+	digest := strings.TrimPrefix(vm.Checksum, "sha256:")
+	return digest[:min(len(digest), 63)]
+}
+
+// findDonor looks for a DataVolume of another DataSync in the same namespace
+// holding the disk of a VM entry. Disks are not shared across namespaces, as
+// a DataSync could otherwise copy the disk of another tenant by knowing its
+// checksum, without the credentials needed to download it. A DataVolume whose
+// disk was verified is returned to be cloned.
+// Failing that, a DataVolume of a syncing DataSync still downloading or
+// verifying the same disk is returned with inFlight set, so the VM entry can
+// wait for it rather than download the disk a second time.
+func (r *DataSyncReconciler) findDonor(ctx context.Context, ds *otv1alpha1.DataSync, vm otv1alpha1.DataSyncVM) (donor *unstructured.Unstructured, inFlight bool, err error) {
+	key := contentKey(vm)
+	if key == "" {
+		return nil, false, nil
+	}
+	list := cdi.NewDataVolumeList()
+	if err := r.List(ctx, list, client.InNamespace(ds.Namespace), client.MatchingLabels{otv1alpha1.LabelContentKey: key}); err != nil {
+		return nil, false, fmt.Errorf("listing DataVolumes with content key %s: %w", key, err)
+	}
+
+	var downloading *unstructured.Unstructured
+	for i := range list.Items {
+		dv := &list.Items[i]
+		if dv.GetLabels()[otv1alpha1.LabelDataSync] == ds.Name || !dv.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		switch {
+		case cdi.Phase(dv) == cdi.DataVolumePhaseSucceeded &&
+			dv.GetAnnotations()[otv1alpha1.AnnotationChecksumVerified] == vm.Checksum:
+			return dv, false, nil
+		case downloading == nil && cdi.Phase(dv) != cdi.DataVolumePhaseFailed &&
+			dv.GetAnnotations()[otv1alpha1.AnnotationClonedFrom] == "":
+			syncing, err := r.ownerSyncing(ctx, dv)
+			if err != nil {
+				return nil, false, err
+			}
+			if syncing {
+				downloading = dv
+			}
+		}
+	}
+	return downloading, downloading != nil, nil
+}
+
+// ownerSyncing reports whether the DataSync owning a DataVolume is syncing,
+// so its download is going to finish rather than wait for a sync window or a
+// resume.
+func (r *DataSyncReconciler) ownerSyncing(ctx context.Context, dv *unstructured.Unstructured) (bool, error) {
+	ref := metav1.GetControllerOf(dv)
+	if ref == nil || ref.Kind != "DataSync" {
+		return false, nil
+	}
+	owner := &otv1alpha1.DataSync{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: dv.GetNamespace(), Name: ref.Name}, owner); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return owner.Status.Phase == otv1alpha1.DataSyncPhaseSyncing, nil
+}
+
+// cloneOf rewrites a VM entry to clone the volume of donor instead of
+// downloading its disk. The clone keeps the requested size unless the donor
+// is larger, in which case CDI sizes it after the donor.
+func cloneOf(vm otv1alpha1.DataSyncVM, donor *unstructured.Unstructured) otv1alpha1.DataSyncVM {
+	if donorSize := cdi.RequestedSize(donor); vm.Size != nil && vm.Size.Cmp(donorSize) < 0 {
+		vm.Size = nil
+	}
+	vm.SourceType = otv1alpha1.SourceTypePVC
+	vm.PVC = &otv1alpha1.DataSyncVolumeSource{Namespace: donor.GetNamespace(), Name: donor.GetName()}
+	vm.URL, vm.SecretRef, vm.CertConfigMapRef = "", "", ""
+	vm.HTTP, vm.Registry = nil, nil
+	return vm
+}
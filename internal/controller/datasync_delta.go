@@ -0,0 +1,174 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/cdi"
+	"pelotech/ot-sync-operator/internal/naming"
+)
+
+// deltaScript downloads the qcow2 overlay at $DELTA_URL, points it at the
+// raw disk at $DISK and commits it into the disk. The download is retried by
+// the Job; an overlay that does not apply fails it for good.
+const deltaScript = `set -eu
+set --
+if [ -n "${ACCESS_KEY_ID:-}" ]; then
+  set -- "$@" --user "$ACCESS_KEY_ID:$SECRET_KEY"
+fi
+if [ -d /certs ]; then
+  cat /certs/* > /scratch/ca.pem
+  set -- "$@" --cacert /scratch/ca.pem
+fi
+curl -fsSL "$@" -o /scratch/delta.qcow2 "$DELTA_URL"
+qemu-img rebase -u -f qcow2 -F raw -b "$DISK" /scratch/delta.qcow2 2> /dev/termination-log || exit 3
+qemu-img commit -f qcow2 /scratch/delta.qcow2 2> /dev/termination-log || exit 3`
+
+// findBase looks for the DataVolume of the same VM entry of the base version
+// of the delta of a VM entry to apply the delta to. It returns nil when the
+// VM entry has no delta, delta sync is disabled or the base version was not
+// synced, in which case the disk is downloaded in full. The overlay is
+// committed without checking its base, so no other version is ever used.
+func (r *DataSyncReconciler) findBase(ctx context.Context, ds *otv1alpha1.DataSync, vm otv1alpha1.DataSyncVM) (*unstructured.Unstructured, error) {
+	if vm.Delta == nil || vm.Delta.BaseVersion == "" || r.DeltaImage == "" || !vm.SourceType.Remote() {
+		return nil, nil
+	}
+	selector := client.MatchingLabels{
+		otv1alpha1.LabelWorkspaceID:      ds.Spec.WorkspaceID,
+		otv1alpha1.LabelWorkspaceVersion: vm.Delta.BaseVersion,
+		otv1alpha1.LabelVM:               vm.Name,
+	}
+	list := cdi.NewDataVolumeList()
+	if err := r.List(ctx, list, client.InNamespace(ds.Namespace), selector); err != nil {
+		return nil, fmt.Errorf("listing DataVolumes of earlier versions: %w", err)
+	}
+
+	var base *unstructured.Unstructured
+	for i := range list.Items {
+		dv := &list.Items[i]
+		if dv.GetLabels()[otv1alpha1.LabelDataSync] == ds.Name ||
+			!dv.GetDeletionTimestamp().IsZero() || cdi.Phase(dv) != cdi.DataVolumePhaseSucceeded {
+			continue
+		}
+		// A base that is itself still waiting for its delta is not complete.
+		if dv.GetAnnotations()[otv1alpha1.AnnotationDeltaBase] != "" &&
+			dv.GetAnnotations()[otv1alpha1.AnnotationDeltaApplied] == "" {
+			continue
+		}
+		if base == nil || base.GetCreationTimestamp().Time.Before(dv.GetCreationTimestamp().Time) {
+			base = dv
+		}
+	}
+	return base, nil
+}
+
+// applyDelta applies the delta of a VM entry to a DataVolume that cloned an
+// earlier version, by running a Job that commits the overlay into the disk.
+// It reports whether the disk is complete, or why applying the delta failed;
+// a Job still running is neither. DataVolumes that downloaded the whole disk
+// are complete as they are.
+func (r *DataSyncReconciler) applyDelta(ctx context.Context, ds *otv1alpha1.DataSync, vm otv1alpha1.DataSyncVM, dv *unstructured.Unstructured) (bool, string, error) {
+	annotations := dv.GetAnnotations()
+	if vm.Delta == nil || annotations[otv1alpha1.AnnotationDeltaBase] == "" ||
+		annotations[otv1alpha1.AnnotationDeltaApplied] == vm.Delta.URL {
+		return true, "", nil
+	}
+
+	name := deltaJobName(dv)
+	job, err := r.finishedJob(ctx, dv, name, func(pvc *corev1.PersistentVolumeClaim) (*batchv1.Job, error) {
+		return r.deltaJob(ds, vm, pvc, name), nil
+	})
+	if err != nil || job == nil {
+		return false, "", err
+	}
+
+	switch failed := jobCondition(job, batchv1.JobFailed); {
+	case failed == nil:
+		if err := r.completeJob(ctx, dv, job, otv1alpha1.AnnotationDeltaApplied, vm.Delta.URL); err != nil {
+			return false, "", err
+		}
+		r.Recorder.Eventf(ds, corev1.EventTypeNormal, "DeltaApplied", "Applied the delta of %s to a clone of %s",
+			vm.Name, annotations[otv1alpha1.AnnotationDeltaBase])
+		return true, "", nil
+	case failed.Reason == batchv1.JobReasonPodFailurePolicy:
+		found := r.terminationMessage(ctx, job)
+		if found == "" {
+			found = "the overlay does not apply"
+		}
+		r.Recorder.Eventf(ds, corev1.EventTypeWarning, "DeltaFailed", "The delta of %s does not apply to %s: %s",
+			vm.Name, annotations[otv1alpha1.AnnotationDeltaBase], found)
+		return false, fmt.Sprintf("failed to apply delta %s (%s)", vm.Delta.URL, found), nil
+	default:
+		return false, fmt.Sprintf("could not apply delta %s: %s", vm.Delta.URL, failed.Message), nil
+	}
+}
+
+// deltaJobName returns the name of the Job applying the delta of a DataVolume.
+// The name is bounded since Kubernetes copies it into the labels of the pods.
+func deltaJobName(dv *unstructured.Unstructured) string {
+	return naming.Bounded(dv.GetName() + "-delta")
+}
+
+// deltaDownload returns a VM entry downloading the delta of vm, to estimate
+// and account the bytes applying it downloads.
+func deltaDownload(vm otv1alpha1.DataSyncVM) otv1alpha1.DataSyncVM {
+	vm.SourceType, vm.URL = otv1alpha1.SourceTypeHTTP, vm.Delta.URL
+	return vm
+}
+
+// deltaJob renders the Job applying the delta of a VM entry to the disk in
+// pvc. The overlay is downloaded with the credentials and CA bundle of the
+// VM entry into scratch space of the node.
+func (r *DataSyncReconciler) deltaJob(ds *otv1alpha1.DataSync, vm otv1alpha1.DataSyncVM, pvc *corev1.PersistentVolumeClaim, name string) *batchv1.Job {
+	container := corev1.Container{
+		Image:        r.DeltaImage,
+		Command:      []string{"/bin/sh", "-c", deltaScript},
+		Env:          []corev1.EnvVar{{Name: "DELTA_URL", Value: vm.Delta.URL}},
+		VolumeMounts: []corev1.VolumeMount{{Name: "scratch", MountPath: "/scratch"}},
+	}
+	if vm.SecretRef != "" {
+		for _, env := range [][2]string{{"ACCESS_KEY_ID", "accessKeyId"}, {"SECRET_KEY", "secretKey"}} {
+			container.Env = append(container.Env, corev1.EnvVar{Name: env[0], ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: vm.SecretRef},
+					Key:                  env[1],
+					Optional:             ptr.To(true),
+				},
+			}})
+		}
+	}
+	volumes := []corev1.Volume{{Name: "scratch", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+	if vm.CertConfigMapRef != "" {
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "certs", MountPath: "/certs", ReadOnly: true})
+		volumes = append(volumes, corev1.Volume{Name: "certs", VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: vm.CertConfigMapRef}},
+		}})
+	}
+
+	job := diskJob(ds, vm, pvc, name, false, container)
+	job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, volumes...)
+	return job
+}
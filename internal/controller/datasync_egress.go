@@ -0,0 +1,131 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/cdi"
+	"pelotech/ot-sync-operator/internal/egress"
+)
+
+// egressDelta is a number of bytes downloaded from a host since the last reconcile.
+type egressDelta struct {
+	host  string
+	bytes int64
+}
+
+// accountTransfers adds the bytes the DataVolumes of a DataSync downloaded
+// since the last reconcile to its status and to the egress ledger. CDI
+// reports the progress of each import in its DataVolume from the importer
+// metrics; it is turned into bytes with the expected size of the download.
+// Bytes of imports that failed or were preempted stay accounted for, and a
+// new DataVolume for the same VM counts from zero again. Clones and restores
+// copy within the cluster and are not accounted, including disks cloned from
+// another DataSync. A disk cloned from an earlier version accounts its delta
+// once it is applied.
+func (r *DataSyncReconciler) accountTransfers(ctx context.Context, ds *otv1alpha1.DataSync, dvs map[string]*unstructured.Unstructured) error {
+	now := time.Now()
+	if r.Egress != nil {
+		// Load the ledger first so bytes recorded in status are never missing from it.
+		if _, err := r.Egress.Usage(ctx, now); err != nil {
+			return err
+		}
+	}
+
+	var deltas []egressDelta
+	changed := false
+	for _, vm := range ds.Spec.VMs {
+		dv, ok := dvs[vm.Name]
+		if !ok || !vm.SourceType.Remote() || dv.GetAnnotations()[otv1alpha1.AnnotationClonedFrom] != "" {
+			continue
+		}
+		downloaded := vm
+		delta := vm.Delta != nil && dv.GetAnnotations()[otv1alpha1.AnnotationDeltaBase] != ""
+		if delta {
+			downloaded = deltaDownload(vm)
+		}
+		t := transfer(ds, vm.Name)
+		if t.DataVolumeUID != dv.GetUID() {
+			t.DataVolumeUID, t.Bytes = dv.GetUID(), 0
+			changed = true
+		}
+		if host := egress.Host(downloaded.URL); t.Host != host {
+			t.Host = host
+			changed = true
+		}
+		if t.TotalBytes == 0 {
+			t.TotalBytes = r.vmBytes(ctx, ds.Namespace, downloaded)
+			changed = true
+		}
+
+		fraction, ok := cdi.ProgressFraction(dv)
+		if delta {
+			// The clone copies within the cluster; the Job applying the delta
+			// does not report progress.
+			fraction, ok = 0, dv.GetAnnotations()[otv1alpha1.AnnotationDeltaApplied] == vm.Delta.URL
+			if ok {
+				fraction = 1
+			}
+		}
+		if !ok {
+			continue
+		}
+		bytes := int64(fraction * float64(t.TotalBytes))
+		if bytes <= t.Bytes {
+			continue
+		}
+		deltas = append(deltas, egressDelta{host: t.Host, bytes: bytes - t.Bytes})
+		ds.Status.BytesTransferred += bytes - t.Bytes
+		t.Bytes = bytes
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := r.Status().Update(ctx, ds); err != nil {
+		return err
+	}
+	transferredBytes.WithLabelValues(ds.Namespace, ds.Name).Set(float64(ds.Status.BytesTransferred))
+	if r.Egress == nil {
+		return nil
+	}
+	p := r.Policy.Get()
+	for _, d := range deltas {
+		if err := r.Egress.Record(ctx, now, d.host, d.bytes, p.PricePerGB(d.host)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transfer returns the transfer of the VM entry name in the status of ds,
+// adding it if it is missing.
+func transfer(ds *otv1alpha1.DataSync, name string) *otv1alpha1.DataSyncTransfer {
+	for i := range ds.Status.Transfers {
+		if ds.Status.Transfers[i].Name == name {
+			return &ds.Status.Transfers[i]
+		}
+	}
+	ds.Status.Transfers = append(ds.Status.Transfers, otv1alpha1.DataSyncTransfer{Name: name})
+	return &ds.Status.Transfers[len(ds.Status.Transfers)-1]
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/cdi"
+)
+
+// finalizer holds a deleted DataSync until its storage has been torn down
+// according to its deletion policy.
+const finalizer = "pelotech.ot/finalizer"
+
+// finalize releases the slot of a deleted DataSync right away, cancels its
+// in-flight imports and deletes or keeps the remaining storage according to
+// spec.deletionPolicy. Owner reference garbage collection alone would keep
+// the slot held and the importers downloading until it catches up.
+// VirtualMachines still held for the DataSync are released or unheld, so
+// none is left waiting for a DataSync that no longer exists.
+func (r *DataSyncReconciler) finalize(ctx context.Context, ds *otv1alpha1.DataSync) error {
+	if !controllerutil.ContainsFinalizer(ds, finalizer) {
+		return nil
+	}
+	r.Queue.Forget(client.ObjectKeyFromObject(ds))
+
+	dvs, err := r.dataVolumesByVM(ctx, ds)
+	if err != nil {
+		return err
+	}
+
+	deletionPolicy := ds.Spec.DeletionPolicy
+	if deletionPolicy == "" {
+		deletionPolicy = otv1alpha1.DeletionPolicyDelete
+	}
+	cancelled, kept := 0, 0
+	for _, dv := range dvs {
+		done := cdi.Phase(dv) == cdi.DataVolumePhaseSucceeded
+		switch {
+		case !done:
+			cancelled++
+			err = r.deleteStorage(ctx, dv)
+		case deletionPolicy == otv1alpha1.DeletionPolicyRetain:
+			kept++
+			err = r.release(ctx, ds, dv)
+		case deletionPolicy == otv1alpha1.DeletionPolicyOrphan:
+			kept++
+			err = client.IgnoreNotFound(r.Delete(ctx, dv, client.PropagationPolicy(metav1.DeletePropagationOrphan)))
+		default:
+			err = r.deleteStorage(ctx, dv)
+		}
+		if err != nil {
+			return fmt.Errorf("tearing down DataVolume %s: %w", dv.GetName(), err)
+		}
+	}
+
+	logf.FromContext(ctx).Info("tore down storage", "deletionPolicy", deletionPolicy,
+		"cancelled", cancelled, "kept", kept, "deleted", len(dvs)-cancelled-kept)
+	r.Recorder.Eventf(ds, corev1.EventTypeNormal, "TornDown",
+		"Deletion policy %s: cancelled %d imports, kept %d volumes", deletionPolicy, cancelled, kept)
+
+	if err := r.releaseVirtualMachines(ctx, ds); err != nil {
+		return err
+	}
+
+	controllerutil.RemoveFinalizer(ds, finalizer)
+	return r.Update(ctx, ds)
+}
+
+// deleteStorage deletes a DataVolume together with its PVC. Deleting the PVC
+// directly stops the importer pod instead of waiting for garbage collection.
+func (r *DataSyncReconciler) deleteStorage(ctx context.Context, dv *unstructured.Unstructured) error {
+	background := client.PropagationPolicy(metav1.DeletePropagationBackground)
+	if err := r.Delete(ctx, dv, background); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	// CDI names the PVC after its DataVolume.
+	pvc := &corev1.PersistentVolumeClaim{}
+	pvc.SetName(dv.GetName())
+	pvc.SetNamespace(dv.GetNamespace())
+	return client.IgnoreNotFound(r.Delete(ctx, pvc, background))
+}
+
+// release detaches a DataVolume from the DataSync so it outlives it.
+func (r *DataSyncReconciler) release(ctx context.Context, ds *otv1alpha1.DataSync, dv *unstructured.Unstructured) error {
+	if err := controllerutil.RemoveControllerReference(ds, dv, r.Scheme); err != nil {
+		return err
+	}
+	return client.IgnoreNotFound(r.Update(ctx, dv))
+}
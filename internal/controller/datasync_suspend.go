@@ -0,0 +1,112 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+)
+
+// unfinished reports whether a DataSync may still sync, i.e. whether it can
+// be suspended or cancelled.
+func unfinished(ds *otv1alpha1.DataSync) bool {
+	switch ds.Status.Phase {
+	case "", otv1alpha1.DataSyncPhaseQueued, otv1alpha1.DataSyncPhaseSyncing, otv1alpha1.DataSyncPhaseSuspended:
+		return true
+	}
+	return false
+}
+
+// cancelRequested reports whether a DataSync that has not finished is
+// annotated to be cancelled.
+func cancelRequested(ds *otv1alpha1.DataSync) bool {
+	return ds.Annotations[otv1alpha1.AnnotationCancel] == "true" && unfinished(ds)
+}
+
+// suspendReason returns why a DataSync that has not finished may not sync,
+// or "" if neither it nor the sync policy is suspended.
+func (r *DataSyncReconciler) suspendReason(ds *otv1alpha1.DataSync) string {
+	if !unfinished(ds) {
+		return ""
+	}
+	switch {
+	case ds.Spec.Suspend:
+		return "Suspended by spec.suspend."
+	case r.Policy.Get().Paused:
+		return "Suspended while the sync policy is paused."
+	}
+	return ""
+}
+
+// suspend takes a DataSync out of the admission queue and, if it is syncing,
+// stops its unfinished imports and releases its slot. Volumes that finished
+// are kept and the stopped attempt does not count against the retry limit,
+// so the sync picks up where it left off once resumed.
+func (r *DataSyncReconciler) suspend(ctx context.Context, ds *otv1alpha1.DataSync, message string) (ctrl.Result, error) {
+	key := client.ObjectKeyFromObject(ds)
+	r.Queue.Withdraw(key)
+	r.releaseProbes(key)
+
+	if ds.Status.Phase == otv1alpha1.DataSyncPhaseSyncing {
+		if err := r.stopImports(ctx, ds, true); err != nil {
+			return ctrl.Result{}, err
+		}
+		logf.FromContext(ctx).Info("suspended sync", "reason", message)
+		r.Recorder.Event(ds, corev1.EventTypeNormal, "Suspended", message)
+		ds.Status.Suspensions++
+		ds.Status.EstimatedBytes = 0
+	}
+
+	// The policy is not watched, so a DataSync suspended by it checks back
+	// for the policy to be resumed.
+	var result ctrl.Result
+	if !ds.Spec.Suspend {
+		result.RequeueAfter = queueRecheckInterval
+	}
+	return result, r.finish(ctx, ds, otv1alpha1.DataSyncPhaseSuspended, message)
+}
+
+// resume queues a suspended DataSync again. A retry that was backing off
+// still waits for its retry time.
+func (r *DataSyncReconciler) resume(ctx context.Context, ds *otv1alpha1.DataSync) error {
+	r.Recorder.Event(ds, corev1.EventTypeNormal, "Resumed", "Queued the sync again")
+	return r.setPhase(ctx, ds, otv1alpha1.DataSyncPhaseQueued, "Request is waiting for an available worker.")
+}
+
+// cancel deletes every DataVolume of a DataSync, including the ones that
+// finished, and marks it Cancelled so it is not synced again.
+func (r *DataSyncReconciler) cancel(ctx context.Context, ds *otv1alpha1.DataSync) error {
+	key := client.ObjectKeyFromObject(ds)
+	if err := r.stopImports(ctx, ds, false); err != nil {
+		return err
+	}
+	r.Queue.Withdraw(key)
+	r.releaseProbes(key)
+
+	logf.FromContext(ctx).Info("cancelled sync")
+	r.Recorder.Eventf(ds, corev1.EventTypeNormal, "Cancelled", "Cancelled through the %s annotation", otv1alpha1.AnnotationCancel)
+	ds.Status.EstimatedBytes = 0
+	ds.Status.NextRetryTime = nil
+	return r.finish(ctx, ds, otv1alpha1.DataSyncPhaseCancelled,
+		"Cancelled by the "+otv1alpha1.AnnotationCancel+" annotation.")
+}
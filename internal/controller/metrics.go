@@ -0,0 +1,32 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// transferredBytes is the number of bytes downloaded per DataSync.
+var transferredBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "ot_sync_datasync_transferred_bytes",
+	Help: "Bytes downloaded for a DataSync over all of its attempts, including failed and preempted ones.",
+}, []string{"namespace", "name"})
+
+func init() {
+	metrics.Registry.MustRegister(transferredBytes)
+}
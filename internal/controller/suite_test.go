@@ -0,0 +1,69 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/cdi"
+	"pelotech/ot-sync-operator/internal/kubevirt"
+)
+
+// These tests drive the reconcilers against a fake client so they can run
+// without a control plane or the CDI CRDs installed.
+
+var testScheme *runtime.Scheme
+
+func TestControllers(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Controller Suite")
+}
+
+var _ = BeforeSuite(func() {
+	testScheme = runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+	Expect(otv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+	// DataVolumes and VirtualMachines are only ever handled as unstructured objects.
+	testScheme.AddKnownTypeWithName(cdi.DataVolumeGVK, &unstructured.Unstructured{})
+	testScheme.AddKnownTypeWithName(cdi.DataVolumeGVK.GroupVersion().WithKind(cdi.DataVolumeGVK.Kind+"List"),
+		&unstructured.UnstructuredList{})
+	testScheme.AddKnownTypeWithName(kubevirt.VirtualMachineGVK, &unstructured.Unstructured{})
+	testScheme.AddKnownTypeWithName(kubevirt.VirtualMachineGVK.GroupVersion().WithKind(kubevirt.VirtualMachineGVK.Kind+"List"),
+		&unstructured.UnstructuredList{})
+})
+
+// newFakeClient returns a fake client seeded with objs that serves the
+// DataSync and WorkspaceCatalog status subresources.
+func newFakeClient(objs ...client.Object) client.Client {
+	return fake.NewClientBuilder().
+		WithScheme(testScheme).
+		WithStatusSubresource(&otv1alpha1.DataSync{}, &otv1alpha1.WorkspaceCatalog{}).
+		WithObjects(objs...).
+		Build()
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/catalog"
+	"pelotech/ot-sync-operator/internal/naming"
+	"pelotech/ot-sync-operator/internal/pipeline"
+)
+
+// defaultCatalogPollInterval is how often an index is polled when the
+// WorkspaceCatalog was admitted without the default of its poll interval.
+const defaultCatalogPollInterval = 5 * time.Minute
+
+// WorkspaceCatalogReconciler reconciles a WorkspaceCatalog object. It polls
+// the index of the catalog and applies a DataSync for every workspace version
+// it lists, the same way the pipeline API applies a submitted manifest.
+//
+// The DataSyncs are labeled with the catalog but not owned by it: deleting a
+// catalog, or dropping a version from its index, leaves the synced volumes to
+// the retention rules of the policy.
+type WorkspaceCatalogReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Reader reads the Secrets holding the credentials of sources, which the
+	// operator does not cache.
+	Reader client.Reader
+
+	// Fetcher fetches the indexes.
+	Fetcher *catalog.Fetcher
+}
+
+// +kubebuilder:rbac:groups=pelotech.ot,resources=workspacecatalogs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=pelotech.ot,resources=workspacecatalogs/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+
+// Reconcile polls the index of a WorkspaceCatalog and polls it again after
+// its poll interval. An index that changed since the last poll is applied:
+// every entry that is new or changed becomes a DataSync, while entries
+// applied before are left alone so DataSyncs the pruner deleted are not
+// brought back.
+//
+// An index that cannot be fetched or applied is reported in the Ready
+// condition and polled again after the poll interval as well; only failing
+// to record the status is returned as an error.
+func (r *WorkspaceCatalogReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	wc := &otv1alpha1.WorkspaceCatalog{}
+	if err := r.Get(ctx, req.NamespacedName, wc); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	interval := defaultCatalogPollInterval
+	if wc.Spec.PollInterval != nil && wc.Spec.PollInterval.Duration > 0 {
+		interval = wc.Spec.PollInterval.Duration
+	}
+	if err := r.poll(ctx, wc); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// poll fetches and applies the index of a catalog and records the outcome in
+// its status, returning the error of recording it.
+func (r *WorkspaceCatalogReconciler) poll(ctx context.Context, wc *otv1alpha1.WorkspaceCatalog) error {
+	log := logf.FromContext(ctx)
+
+	// A changed spec may select other workspaces of the same index.
+	if wc.Status.ObservedGeneration != wc.Generation {
+		wc.Status.ETag, wc.Status.IndexDigest = "", ""
+	}
+	now := metav1.Now()
+	wc.Status.LastPollTime = &now
+	wc.Status.ObservedGeneration = wc.Generation
+
+	creds, err := r.credentials(ctx, wc)
+	if err != nil {
+		return r.setCatalogReady(ctx, wc, metav1.ConditionFalse, "SecretUnavailable", err.Error())
+	}
+	fetched, err := r.Fetcher.Fetch(ctx, wc.Spec.Source, creds, wc.Status.ETag)
+	if err != nil {
+		log.Info("could not fetch the index", "url", wc.Spec.Source.URL, "error", err.Error())
+		r.Recorder.Eventf(wc, corev1.EventTypeWarning, "FetchFailed", "Could not fetch the index: %v", err)
+		return r.setCatalogReady(ctx, wc, metav1.ConditionFalse, "FetchFailed", err.Error())
+	}
+	wc.Status.ETag = fetched.ETag
+	if fetched.Data == nil {
+		return r.Status().Update(ctx, wc)
+	}
+	sum := sha256.Sum256(fetched.Data)
+	digest := hex.EncodeToString(sum[:])
+	if digest == wc.Status.IndexDigest {
+		return r.Status().Update(ctx, wc)
+	}
+
+	index, err := catalog.Parse(fetched.Data)
+	if err != nil {
+		r.Recorder.Eventf(wc, corev1.EventTypeWarning, "InvalidIndex", "%v", err)
+		return r.setCatalogReady(ctx, wc, metav1.ConditionFalse, "InvalidIndex", err.Error())
+	}
+
+	entries, failed := r.applyIndex(ctx, wc, index)
+	wc.Status.Workspaces = entries
+	if failed > 0 {
+		// The index is downloaded and applied again on the next poll to
+		// retry the failures, even if the server reports it unchanged.
+		wc.Status.ETag, wc.Status.IndexDigest = "", ""
+		return r.setCatalogReady(ctx, wc, metav1.ConditionFalse, "ApplyFailed",
+			fmt.Sprintf("%d of %d workspace versions could not be applied.", failed, len(entries)))
+	}
+	wc.Status.IndexDigest = digest
+	message := fmt.Sprintf("%d workspace versions are applied.", len(entries))
+	if frozen := slices.IndexFunc(entries, func(e otv1alpha1.WorkspaceCatalogEntry) bool { return e.Error != "" }); frozen >= 0 {
+		message += fmt.Sprintf(" DataSync %s can no longer change; see its entry.", entries[frozen].DataSync)
+	}
+	return r.setCatalogReady(ctx, wc, metav1.ConditionTrue, "Applied", message)
+}
+
+// applyIndex applies the DataSync of every entry of index the catalog selects
+// and returns the entries for its status, along with how many failed in a way
+// applying them again may fix.
+func (r *WorkspaceCatalogReconciler) applyIndex(ctx context.Context, wc *otv1alpha1.WorkspaceCatalog, index *catalog.Index) ([]otv1alpha1.WorkspaceCatalogEntry, int) {
+	var entries []otv1alpha1.WorkspaceCatalogEntry
+	failed := 0
+	for _, spec := range index.Workspaces {
+		if len(wc.Spec.Workspaces) > 0 && !slices.Contains(wc.Spec.Workspaces, spec.WorkspaceID) {
+			continue
+		}
+		entry := otv1alpha1.WorkspaceCatalogEntry{
+			WorkspaceID: spec.WorkspaceID,
+			Version:     spec.Version,
+			DataSync:    naming.DataSyncName(spec.WorkspaceID, spec.Version),
+		}
+		var retry bool
+		entry.Digest, entry.Error, retry = r.applyEntry(ctx, wc, entries, entry, spec)
+		if retry {
+			failed++
+		}
+		entries = append(entries, entry)
+	}
+	return entries, failed
+}
+
+// applyEntry applies the DataSync of an entry of the index unless the same
+// entry was applied before. It returns the digest of the entry, or why it
+// could not be applied and whether applying it again may succeed. An entry
+// whose DataSync can no longer change is left as it is until the index
+// changes again.
+func (r *WorkspaceCatalogReconciler) applyEntry(ctx context.Context, wc *otv1alpha1.WorkspaceCatalog, applied []otv1alpha1.WorkspaceCatalogEntry, entry otv1alpha1.WorkspaceCatalogEntry, spec otv1alpha1.DataSyncSpec) (string, string, bool) {
+	if spec.WorkspaceID == "" {
+		return "", "the entry has no workspaceId", true
+	}
+	if slices.ContainsFunc(applied, func(e otv1alpha1.WorkspaceCatalogEntry) bool { return e.DataSync == entry.DataSync }) {
+		return "", "the index lists this workspace version more than once", true
+	}
+	digest, err := pipeline.ManifestDigest(spec)
+	if err != nil {
+		return "", err.Error(), true
+	}
+	if slices.ContainsFunc(wc.Status.Workspaces, func(e otv1alpha1.WorkspaceCatalogEntry) bool {
+		return e.DataSync == entry.DataSync && e.Digest == digest && e.Error == ""
+	}) {
+		return digest, "", false
+	}
+
+	key := types.NamespacedName{Namespace: wc.Namespace, Name: entry.DataSync}
+	_, result, err := pipeline.Apply(ctx, r.Client, key, map[string]string{otv1alpha1.LabelCatalog: wc.Name}, spec)
+	if pipeline.IsFrozen(err) {
+		r.Recorder.Eventf(wc, corev1.EventTypeWarning, "EntryFrozen", "Left DataSync %s unchanged: %v", entry.DataSync, err)
+		return digest, err.Error(), false
+	}
+	if err != nil {
+		r.Recorder.Eventf(wc, corev1.EventTypeWarning, "ApplyFailed", "Could not apply DataSync %s: %v", entry.DataSync, err)
+		return digest, err.Error(), true
+	}
+	if result != controllerutil.OperationResultNone {
+		logf.FromContext(ctx).Info("applied workspace version", "dataSync", entry.DataSync, "result", result)
+		r.Recorder.Eventf(wc, corev1.EventTypeNormal, "Applied", "DataSync %s %s for workspace %s version %s",
+			entry.DataSync, result, spec.WorkspaceID, spec.Version)
+	}
+	return digest, "", false
+}
+
+// credentials reads the credentials of the source of a catalog from its
+// Secret, if it names one.
+func (r *WorkspaceCatalogReconciler) credentials(ctx context.Context, wc *otv1alpha1.WorkspaceCatalog) (catalog.Credentials, error) {
+	if wc.Spec.Source.SecretRef == "" {
+		return catalog.Credentials{}, nil
+	}
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: wc.Namespace, Name: wc.Spec.Source.SecretRef}
+	if err := r.Reader.Get(ctx, key, secret); err != nil {
+		return catalog.Credentials{}, fmt.Errorf("reading Secret %s: %w", key.Name, err)
+	}
+	return catalog.Credentials{
+		Username: string(secret.Data["username"]),
+		Password: string(secret.Data["password"]),
+		Token:    string(secret.Data["token"]),
+	}, nil
+}
+
+// setCatalogReady records the Ready condition of a catalog along with the
+// rest of its status.
+func (r *WorkspaceCatalogReconciler) setCatalogReady(ctx context.Context, wc *otv1alpha1.WorkspaceCatalog, status metav1.ConditionStatus, reason, message string) error {
+	meta.SetStatusCondition(&wc.Status.Conditions, metav1.Condition{
+		Type:               otv1alpha1.ConditionReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: wc.Generation,
+	})
+	return r.Status().Update(ctx, wc)
+}
+
+// SetupWithManager sets up the controller with the Manager. Only changes to
+// the spec trigger a poll; the index is polled on a timer otherwise.
+func (r *WorkspaceCatalogReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&otv1alpha1.WorkspaceCatalog{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Named("workspacecatalog").
+		Complete(r)
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/catalog"
+)
+
+// catalogEntry renders an entry of an index for a version of a workspace.
+func catalogEntry(workspace, version string) string {
+	return fmt.Sprintf(`- workspaceId: %q
+  version: %q
+  vms:
+  - name: controller
+    url: https://mirror.example.com/workspaces/%s/controller-%s.qcow2
+    sourceType: http
+`, workspace, version, workspace, version)
+}
+
+var _ = Describe("WorkspaceCatalog Controller", func() {
+	var (
+		ctx        context.Context
+		k8sClient  client.Client
+		reconciler *WorkspaceCatalogReconciler
+		mu         sync.Mutex
+		index      string
+		revision   int
+		downloads  int
+		key        = types.NamespacedName{Name: "published-workspaces", Namespace: "default"}
+	)
+
+	setIndex := func(workspaces ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+		index = "workspaces:\n" + strings.Join(workspaces, "")
+		revision++
+	}
+
+	reconcileCatalog := func() *otv1alpha1.WorkspaceCatalog {
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(defaultCatalogPollInterval))
+		wc := &otv1alpha1.WorkspaceCatalog{}
+		Expect(k8sClient.Get(ctx, key, wc)).To(Succeed())
+		return wc
+	}
+
+	dataSyncs := func() []string {
+		list := &otv1alpha1.DataSyncList{}
+		Expect(k8sClient.List(ctx, list, client.InNamespace("default"),
+			client.MatchingLabels{otv1alpha1.LabelCatalog: key.Name})).To(Succeed())
+		var names []string
+		for _, ds := range list.Items {
+			names = append(names, ds.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		downloads = 0
+		setIndex(catalogEntry("035", "1.4.0"), catalogEntry("036", "2.0.0"))
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			etag := fmt.Sprintf(`"%d"`, revision)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			downloads++
+			w.Header().Set("ETag", etag)
+			_, _ = fmt.Fprint(w, index)
+		}))
+		DeferCleanup(server.Close)
+
+		k8sClient = newFakeClient(&otv1alpha1.WorkspaceCatalog{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec: otv1alpha1.WorkspaceCatalogSpec{
+				Source: otv1alpha1.WorkspaceCatalogSource{
+					Type: otv1alpha1.CatalogSourceTypeHTTP,
+					URL:  server.URL + "/workspaces/index.yaml",
+				},
+				Workspaces: []string{"035"},
+			},
+		})
+		reconciler = &WorkspaceCatalogReconciler{
+			Client:   k8sClient,
+			Scheme:   testScheme,
+			Recorder: record.NewFakeRecorder(100),
+			Reader:   k8sClient,
+			Fetcher:  &catalog.Fetcher{Client: server.Client()},
+		}
+	})
+
+	It("should generate a DataSync for every selected workspace version of the index", func() {
+		wc := reconcileCatalog()
+		Expect(dataSyncs()).To(ConsistOf("sync-workspace-035-1.4.0"))
+		Expect(meta.IsStatusConditionTrue(wc.Status.Conditions, otv1alpha1.ConditionReady)).To(BeTrue())
+		Expect(wc.Status.Workspaces).To(HaveLen(1))
+		Expect(wc.Status.ETag).NotTo(BeEmpty())
+
+		ds := &otv1alpha1.DataSync{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "sync-workspace-035-1.4.0", Namespace: "default"}, ds)).
+			To(Succeed())
+		Expect(ds.Spec.WorkspaceID).To(Equal("035"))
+		Expect(ds.Spec.VMs[0].URL).To(HaveSuffix("controller-1.4.0.qcow2"))
+
+		reconcileCatalog()
+		Expect(downloads).To(Equal(1), "an unchanged index is not downloaded again")
+	})
+
+	It("should add new versions without bringing back pruned ones", func() {
+		reconcileCatalog()
+		Expect(k8sClient.Delete(ctx, &otv1alpha1.DataSync{
+			ObjectMeta: metav1.ObjectMeta{Name: "sync-workspace-035-1.4.0", Namespace: "default"},
+		})).To(Succeed())
+
+		setIndex(catalogEntry("035", "1.4.0"), catalogEntry("035", "1.5.0"))
+		wc := reconcileCatalog()
+		Expect(dataSyncs()).To(ConsistOf("sync-workspace-035-1.5.0"))
+		Expect(wc.Status.Workspaces).To(HaveLen(2))
+	})
+
+	It("should report entries that cannot be applied and retry them", func() {
+		setIndex(catalogEntry("035", "1.4.0"), catalogEntry("035", "1.4.0"))
+		wc := reconcileCatalog()
+		Expect(meta.IsStatusConditionFalse(wc.Status.Conditions, otv1alpha1.ConditionReady)).To(BeTrue())
+		Expect(wc.Status.Workspaces[1].Error).To(ContainSubstring("more than once"))
+		Expect(wc.Status.IndexDigest).To(BeEmpty(), "the index is applied again on the next poll")
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx,
+			types.NamespacedName{Name: "sync-workspace-035-1.4.0", Namespace: "default"}, &otv1alpha1.DataSync{}))).
+			To(BeFalse())
+	})
+
+	It("should leave DataSyncs that left Queued alone without failing every poll", func() {
+		reconcileCatalog()
+		ds := &otv1alpha1.DataSync{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "sync-workspace-035-1.4.0", Namespace: "default"}, ds)).
+			To(Succeed())
+		ds.Status.Phase = otv1alpha1.DataSyncPhaseSyncing
+		Expect(k8sClient.Status().Update(ctx, ds)).To(Succeed())
+
+		setIndex(strings.Replace(catalogEntry("035", "1.4.0"), "controller-1.4.0", "controller-1.4.0-rebuilt", 1))
+		wc := reconcileCatalog()
+		Expect(wc.Status.Workspaces[0].Error).To(ContainSubstring("is Syncing and can no longer take another manifest"))
+		Expect(meta.IsStatusConditionTrue(wc.Status.Conditions, otv1alpha1.ConditionReady)).To(BeTrue())
+		Expect(wc.Status.IndexDigest).NotTo(BeEmpty(), "the index is not applied again until it changes")
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(ds), ds)).To(Succeed())
+		Expect(ds.Spec.VMs[0].URL).To(HaveSuffix("controller-1.4.0.qcow2"))
+
+		reconcileCatalog()
+		Expect(downloads).To(Equal(2))
+	})
+
+	It("should poll again after the poll interval when the index cannot be fetched", func() {
+		wc := &otv1alpha1.WorkspaceCatalog{}
+		Expect(k8sClient.Get(ctx, key, wc)).To(Succeed())
+		wc.Spec.Source.SecretRef = "missing-credentials"
+		Expect(k8sClient.Update(ctx, wc)).To(Succeed())
+
+		wc = reconcileCatalog()
+		Expect(meta.FindStatusCondition(wc.Status.Conditions, otv1alpha1.ConditionReady).Reason).
+			To(Equal("SecretUnavailable"))
+	})
+
+	It("should only return the error of recording the status", func() {
+		reconciler.Client = interceptor.NewClient(k8sClient.(client.WithWatch), interceptor.Funcs{
+			SubResourceUpdate: func(context.Context, client.Client, string, client.Object, ...client.SubResourceUpdateOption) error {
+				return apierrors.NewServiceUnavailable("etcd is down")
+			},
+		})
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).To(MatchError(ContainSubstring("etcd is down")))
+		Expect(result).To(BeZero(), "controller-runtime backs off on the error instead")
+	})
+
+	It("should retry failed entries of an index that did not change", func() {
+		failing := true
+		reconciler.Client = interceptor.NewClient(k8sClient.(client.WithWatch), interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if _, ok := obj.(*otv1alpha1.DataSync); ok && failing {
+					return apierrors.NewServerTimeout(otv1alpha1.GroupVersion.WithResource("datasyncs").GroupResource(), "create", 1)
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		})
+		wc := reconcileCatalog()
+		Expect(meta.IsStatusConditionFalse(wc.Status.Conditions, otv1alpha1.ConditionReady)).To(BeTrue())
+		Expect(wc.Status.ETag).To(BeEmpty(), "the index is downloaded again on the next poll")
+		Expect(dataSyncs()).To(BeEmpty())
+
+		failing = false
+		wc = reconcileCatalog()
+		Expect(downloads).To(Equal(2))
+		Expect(meta.IsStatusConditionTrue(wc.Status.Conditions, otv1alpha1.ConditionReady)).To(BeTrue())
+		Expect(dataSyncs()).To(ConsistOf("sync-workspace-035-1.4.0"))
+	})
+})
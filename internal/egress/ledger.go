@@ -0,0 +1,294 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package egress keeps the ledger of the bytes DataSyncs download and what
+// they cost per calendar month, so the sync policy can cap monthly egress.
+package egress
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"pelotech/ot-sync-operator/internal/policy"
+)
+
+// ConfigMapName is the name of the ConfigMap the ledger is persisted to. It
+// lives next to the policy ConfigMap.
+const ConfigMapName = "sync-operator-egress"
+
+// flushInterval is how often persisting the ledger is retried after Record
+// failed to persist it.
+const flushInterval = 30 * time.Second
+
+// retainedMonths is the number of months kept in the ConfigMap, including the current one.
+const retainedMonths = 12
+
+// bytesPerGB is the gigabyte egress is priced in.
+const bytesPerGB = 1e9
+
+// Usage is the egress of a calendar month.
+type Usage struct {
+	Bytes   int64
+	Dollars float64
+}
+
+// Ledger sums the egress of every DataSync per calendar month, in UTC. It is
+// loaded from its ConfigMap the first time it is used after the operator
+// becomes leader and is persisted with every Record, so the usage of the
+// month survives crashes, restarts and leader changes.
+type Ledger struct {
+	client    client.Client
+	reader    client.Reader
+	namespace string
+
+	mu     sync.Mutex
+	loaded bool
+	dirty  bool
+	months map[string]Usage
+}
+
+// The ledger only writes ConfigMaps in the policy namespace, which defaults
+// to the namespace of the operator. Bind the manager Role in the policy
+// namespace when it is set to another one.
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,namespace=system,resources=configmaps,verbs=create;update
+
+// NewLedger returns a Ledger persisted to a ConfigMap in namespace. The reader
+// should not be cached so a new leader sees the usage its predecessor wrote.
+func NewLedger(c client.Client, reader client.Reader, namespace string) *Ledger {
+	return &Ledger{client: c, reader: reader, namespace: namespace, months: map[string]Usage{}}
+}
+
+// Start retries persisting the ledger every flush interval until ctx is done
+// and persists it once more before returning.
+func (l *Ledger) Start(ctx context.Context) error {
+	log := logf.FromContext(ctx).WithName("egress")
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.Flush(ctx); err != nil {
+				log.Error(err, "persisting egress ledger failed")
+			}
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := l.Flush(flushCtx); err != nil {
+				log.Error(err, "persisting egress ledger failed")
+			}
+			l.mu.Lock()
+			l.loaded = false
+			l.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+// NeedLeaderElection ensures only the leader writes the ledger.
+func (l *Ledger) NeedLeaderElection() bool {
+	return true
+}
+
+// Record adds bytes downloaded from host at now, priced at pricePerGB, and
+// persists the ledger. Should persisting fail, the bytes are recorded all the
+// same and persisted again by Start.
+func (l *Ledger) Record(ctx context.Context, now time.Time, host string, bytes int64, pricePerGB float64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(ctx); err != nil {
+		return err
+	}
+
+	dollars := float64(bytes) / bytesPerGB * pricePerGB
+	month := monthOf(now)
+	u := l.months[month]
+	u.Bytes += bytes
+	u.Dollars += dollars
+	l.months[month] = u
+	l.dirty = true
+
+	egressBytes.WithLabelValues(host).Add(float64(bytes))
+	egressDollars.WithLabelValues(host).Add(dollars)
+	l.observe(now)
+	return l.flush(ctx)
+}
+
+// Usage returns the egress of the month of now.
+func (l *Ledger) Usage(ctx context.Context, now time.Time) (Usage, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(ctx); err != nil {
+		return Usage{}, err
+	}
+	return l.months[monthOf(now)], nil
+}
+
+// Exhausted returns why no more DataSyncs may be admitted in the month of
+// now, or "" if the budget is not exceeded.
+func (l *Ledger) Exhausted(ctx context.Context, now time.Time, budget policy.EgressBudget) (string, error) {
+	u, err := l.Usage(ctx, now)
+	if err != nil {
+		return "", err
+	}
+
+	var used, limit string
+	switch {
+	case budget.Bytes > 0 && u.Bytes >= budget.Bytes:
+		used, limit = formatGB(u.Bytes), formatGB(budget.Bytes)
+	case budget.Dollars > 0 && u.Dollars >= budget.Dollars:
+		used, limit = formatDollars(u.Dollars), formatDollars(budget.Dollars)
+	default:
+		budgetExhausted.Set(0)
+		return "", nil
+	}
+	budgetExhausted.Set(1)
+	next := time.Date(now.UTC().Year(), now.UTC().Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	return fmt.Sprintf("Monthly egress budget exhausted (%s of %s used); admission resumes on %s or once the budget is raised.",
+		used, limit, next.Format(time.DateOnly)), nil
+}
+
+// Flush persists the ledger if it changed since it was last persisted.
+func (l *Ledger) Flush(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.flush(ctx)
+}
+
+// flush persists the ledger if it changed. The caller must hold the lock.
+func (l *Ledger) flush(ctx context.Context) error {
+	if !l.loaded || !l.dirty {
+		return nil
+	}
+
+	months := make([]string, 0, len(l.months))
+	for month := range l.months {
+		months = append(months, month)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(months)))
+	data := map[string]string{}
+	for i, month := range months {
+		if i >= retainedMonths {
+			delete(l.months, month)
+			continue
+		}
+		u := l.months[month]
+		data[month+".bytes"] = strconv.FormatInt(u.Bytes, 10)
+		data[month+".dollars"] = strconv.FormatFloat(u.Dollars, 'f', -1, 64)
+	}
+
+	cm := &corev1.ConfigMap{}
+	err := l.reader.Get(ctx, types.NamespacedName{Namespace: l.namespace, Name: ConfigMapName}, cm)
+	switch {
+	case apierrors.IsNotFound(err):
+		cm.Namespace = l.namespace
+		cm.Name = ConfigMapName
+		cm.Data = data
+		err = l.client.Create(ctx, cm)
+	case err == nil:
+		cm.Data = data
+		err = l.client.Update(ctx, cm)
+	}
+	if err != nil {
+		return fmt.Errorf("persisting egress ledger: %w", err)
+	}
+	l.dirty = false
+	return nil
+}
+
+// load reads the ledger from its ConfigMap unless it was already loaded. The
+// caller must hold the lock.
+func (l *Ledger) load(ctx context.Context) error {
+	if l.loaded {
+		return nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	err := l.reader.Get(ctx, types.NamespacedName{Namespace: l.namespace, Name: ConfigMapName}, cm)
+	if client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("loading egress ledger: %w", err)
+	}
+
+	months := map[string]Usage{}
+	for key, value := range cm.Data {
+		month, field, _ := strings.Cut(key, ".")
+		if _, err := time.Parse("2006-01", month); err != nil {
+			continue
+		}
+		u := months[month]
+		var err error
+		switch field {
+		case "bytes":
+			u.Bytes, err = strconv.ParseInt(value, 10, 64)
+		case "dollars":
+			u.Dollars, err = strconv.ParseFloat(value, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("loading egress ledger: %s: %q is not a number", key, value)
+		}
+		months[month] = u
+	}
+
+	l.months = months
+	l.loaded = true
+	l.dirty = false
+	l.observe(time.Now())
+	return nil
+}
+
+// observe publishes the usage of the current month. The caller must hold the lock.
+func (l *Ledger) observe(now time.Time) {
+	u := l.months[monthOf(now)]
+	monthBytes.Set(float64(u.Bytes))
+	monthDollars.Set(u.Dollars)
+}
+
+// Host returns the host a source URL downloads from, e.g. the bucket of an
+// s3 URL, for pricing and metrics.
+func Host(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "unknown"
+	}
+	return u.Hostname()
+}
+
+// monthOf returns the key of the calendar month of t.
+func monthOf(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// formatGB renders bytes in gigabytes, the unit egress is priced in.
+func formatGB(bytes int64) string {
+	return fmt.Sprintf("%.1f GB", float64(bytes)/bytesPerGB)
+}
+
+// formatDollars renders an amount of dollars.
+func formatDollars(dollars float64) string {
+	return fmt.Sprintf("$%.2f", dollars)
+}
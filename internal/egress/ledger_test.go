@@ -0,0 +1,131 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package egress
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"pelotech/ot-sync-operator/internal/policy"
+)
+
+var _ = Describe("Ledger", func() {
+	const namespace = "ot-sync-operator-system"
+
+	var (
+		ctx context.Context
+		now = time.Date(2025, 7, 11, 20, 0, 0, 0, time.UTC)
+	)
+
+	newClient := func(objs ...client.Object) client.Client {
+		return fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(objs...).Build()
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("should sum the egress of the month and price it per host", func() {
+		c := newClient()
+		l := NewLedger(c, c, namespace)
+		Expect(l.Record(ctx, now, "mirror.example.com", 20e9, 0.05)).To(Succeed())
+		Expect(l.Record(ctx, now, "registry.example.com", 10e9, 0.09)).To(Succeed())
+		Expect(l.Record(ctx, now.AddDate(0, -1, 0), "mirror.example.com", 99e9, 0.05)).To(Succeed())
+
+		u, err := l.Usage(ctx, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.Bytes).To(Equal(int64(30e9)))
+		Expect(u.Dollars).To(BeNumerically("~", 1.9, 1e-9))
+	})
+
+	It("should report an exhausted budget in bytes or dollars", func() {
+		c := newClient()
+		l := NewLedger(c, c, namespace)
+		Expect(l.Record(ctx, now, "mirror.example.com", 500e9, 0.1)).To(Succeed())
+
+		reason, err := l.Exhausted(ctx, now, policy.EgressBudget{Bytes: 600e9})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reason).To(BeEmpty())
+		reason, _ = l.Exhausted(ctx, now, policy.EgressBudget{Bytes: 500e9})
+		Expect(reason).To(Equal("Monthly egress budget exhausted (500.0 GB of 500.0 GB used); " +
+			"admission resumes on 2025-08-01 or once the budget is raised."))
+		reason, _ = l.Exhausted(ctx, now, policy.EgressBudget{Dollars: 40})
+		Expect(reason).To(HavePrefix("Monthly egress budget exhausted ($50.00 of $40.00 used)"))
+		reason, _ = l.Exhausted(ctx, now, policy.EgressBudget{})
+		Expect(reason).To(BeEmpty())
+
+		// The budget starts over with the next month.
+		reason, _ = l.Exhausted(ctx, now.AddDate(0, 1, 0), policy.EgressBudget{Bytes: 500e9})
+		Expect(reason).To(BeEmpty())
+	})
+
+	It("should persist the ledger and load it after a restart", func() {
+		c := newClient(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: namespace},
+			Data:       map[string]string{"2025-07.bytes": "1000", "2025-07.dollars": "0.5"},
+		})
+		l := NewLedger(c, c, namespace)
+		Expect(l.Record(ctx, now, "mirror.example.com", 500, 0)).To(Succeed())
+		Expect(l.Flush(ctx)).To(Succeed())
+
+		cm := &corev1.ConfigMap{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ConfigMapName}, cm)).To(Succeed())
+		Expect(cm.Data).To(HaveKeyWithValue("2025-07.bytes", "1500"))
+
+		u, err := NewLedger(c, c, namespace).Usage(ctx, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u).To(Equal(Usage{Bytes: 1500, Dollars: 0.5}))
+	})
+
+	It("should persist every record right away", func() {
+		c := newClient()
+		l := NewLedger(c, c, namespace)
+		Expect(l.Record(ctx, now, "mirror.example.com", 42, 0)).To(Succeed())
+
+		u, err := NewLedger(c, c, namespace).Usage(ctx, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.Bytes).To(Equal(int64(42)))
+	})
+
+	It("should create the ConfigMap on the first flush", func() {
+		c := newClient()
+		l := NewLedger(c, c, namespace)
+		Expect(l.Flush(ctx)).To(Succeed())
+		Expect(l.Record(ctx, now, "mirror.example.com", 42, 0)).To(Succeed())
+		Expect(l.Flush(ctx)).To(Succeed())
+
+		cm := &corev1.ConfigMap{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ConfigMapName}, cm)).To(Succeed())
+		Expect(cm.Data).To(HaveKeyWithValue("2025-07.bytes", "42"))
+	})
+
+	It("should name the host of a source", func() {
+		Expect(Host("https://mirror.example.com:8443/disk.qcow2")).To(Equal("mirror.example.com"))
+		Expect(Host("docker://registry.example.com/worker:1")).To(Equal("registry.example.com"))
+		Expect(Host("not a url")).To(Equal("unknown"))
+	})
+})
@@ -0,0 +1,58 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package egress
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// egressBytes counts the bytes downloaded per source host.
+	egressBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ot_sync_egress_bytes_total",
+		Help: "Bytes downloaded by DataSyncs, including failed attempts, by source host.",
+	}, []string{"host"})
+
+	// egressDollars counts the cost of the bytes downloaded per source host.
+	egressDollars = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ot_sync_egress_cost_dollars_total",
+		Help: "Cost in dollars of the bytes downloaded by DataSyncs, by source host.",
+	}, []string{"host"})
+
+	// monthBytes is the egress of the current month.
+	monthBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ot_sync_egress_month_bytes",
+		Help: "Bytes downloaded by DataSyncs in the current calendar month.",
+	})
+
+	// monthDollars is the cost of the egress of the current month.
+	monthDollars = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ot_sync_egress_month_cost_dollars",
+		Help: "Cost in dollars of the bytes downloaded by DataSyncs in the current calendar month.",
+	})
+
+	// budgetExhausted is 1 while the monthly egress budget stops admission.
+	budgetExhausted = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ot_sync_egress_budget_exhausted",
+		Help: "Whether the monthly egress budget is exhausted and DataSyncs are not admitted (1) or not (0).",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(egressBytes, egressDollars, monthBytes, monthDollars, budgetExhausted)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kubevirt contains helpers for working with KubeVirt objects.
+//
+// Like DataVolumes, VirtualMachines are handled as unstructured objects so the
+// operator does not need to pin its dependencies to a particular KubeVirt release.
+package kubevirt
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+)
+
+// Run strategies of a VirtualMachine the operator cares about.
+const (
+	RunStrategyAlways = "Always"
+	RunStrategyHalted = "Halted"
+)
+
+var (
+	// VirtualMachineGVK is the GroupVersionKind of a KubeVirt VirtualMachine.
+	VirtualMachineGVK = schema.GroupVersionKind{Group: "kubevirt.io", Version: "v1", Kind: "VirtualMachine"}
+	// VirtualMachineInstanceGVK is the GroupVersionKind of a KubeVirt VirtualMachineInstance.
+	VirtualMachineInstanceGVK = schema.GroupVersionKind{Group: "kubevirt.io", Version: "v1", Kind: "VirtualMachineInstance"}
+)
+
+// NewList returns an empty list of the given kind with its GroupVersionKind set.
+func NewList(gvk schema.GroupVersionKind) *unstructured.UnstructuredList {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	return list
+}
+
+// ClaimNames returns the names of the PVCs and DataVolumes the volumes of a
+// VirtualMachine or VirtualMachineInstance refer to. CDI gives the PVC of a
+// DataVolume the same name, so both identify the claim that is used.
+func ClaimNames(obj *unstructured.Unstructured) []string {
+	path := []string{"spec", "volumes"}
+	if obj.GroupVersionKind().Kind == VirtualMachineGVK.Kind {
+		path = []string{"spec", "template", "spec", "volumes"}
+	}
+	volumes, _, _ := unstructured.NestedSlice(obj.Object, path...)
+
+	var names []string
+	for _, v := range volumes {
+		volume, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		if name, _, _ := unstructured.NestedString(volume, "persistentVolumeClaim", "claimName"); name != "" {
+			names = append(names, name)
+		}
+		if name, _, _ := unstructured.NestedString(volume, "dataVolume", "name"); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// RunStrategy returns the run strategy of a VirtualMachine, translating the
+// deprecated spec.running field.
+func RunStrategy(vm *unstructured.Unstructured) string {
+	if strategy, _, _ := unstructured.NestedString(vm.Object, "spec", "runStrategy"); strategy != "" {
+		return strategy
+	}
+	if running, _, _ := unstructured.NestedBool(vm.Object, "spec", "running"); running {
+		return RunStrategyAlways
+	}
+	return RunStrategyHalted
+}
+
+// Hold halts a VirtualMachine until the DataSync named dataSync has synced.
+// The run strategy it is released with is remembered in an annotation. Hold
+// returns false when the VirtualMachine would not start anyway.
+func Hold(vm *unstructured.Unstructured, dataSync string) bool {
+	strategy := RunStrategy(vm)
+	if strategy == RunStrategyHalted {
+		return false
+	}
+	unstructured.RemoveNestedField(vm.Object, "spec", "running")
+	_ = unstructured.SetNestedField(vm.Object, RunStrategyHalted, "spec", "runStrategy")
+
+	labels := vm.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[otv1alpha1.LabelHeld] = "true"
+	vm.SetLabels(labels)
+
+	annotations := vm.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[otv1alpha1.AnnotationHeldFor] = dataSync
+	annotations[otv1alpha1.AnnotationHeldRunStrategy] = strategy
+	vm.SetAnnotations(annotations)
+	return true
+}
+
+// HeldFor returns the name of the DataSync a held VirtualMachine waits for, or "".
+func HeldFor(vm *unstructured.Unstructured) string {
+	if vm.GetLabels()[otv1alpha1.LabelHeld] != "true" {
+		return ""
+	}
+	return vm.GetAnnotations()[otv1alpha1.AnnotationHeldFor]
+}
+
+// Release restores the run strategy of a held VirtualMachine and removes the
+// marks left by Hold.
+func Release(vm *unstructured.Unstructured) {
+	if strategy := Unhold(vm); strategy != "" {
+		_ = unstructured.SetNestedField(vm.Object, strategy, "spec", "runStrategy")
+	}
+}
+
+// Unhold removes the marks left by Hold but leaves the VirtualMachine halted.
+// It returns the run strategy the VirtualMachine would have been released with.
+func Unhold(vm *unstructured.Unstructured) string {
+	annotations := vm.GetAnnotations()
+	strategy := annotations[otv1alpha1.AnnotationHeldRunStrategy]
+	delete(annotations, otv1alpha1.AnnotationHeldFor)
+	delete(annotations, otv1alpha1.AnnotationHeldRunStrategy)
+	vm.SetAnnotations(annotations)
+
+	labels := vm.GetLabels()
+	delete(labels, otv1alpha1.LabelHeld)
+	vm.SetLabels(labels)
+	return strategy
+}
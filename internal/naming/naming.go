@@ -0,0 +1,63 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package naming names the objects the operator creates, keeping the names
+// valid and short enough to be copied into labels.
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// invalidNameChars matches the runs of characters that may not appear in an
+// object name.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// hashLen is the number of hex digits of the hash shortened names end with.
+const hashLen = 8
+
+// DataSyncName returns the name of the DataSync of a workspace version,
+// following sync-workspace-<id>-<version>.
+func DataSyncName(workspaceID, version string) string {
+	raw := "sync-workspace-" + workspaceID
+	if version != "" {
+		raw += "-" + version
+	}
+	return Bounded(raw)
+}
+
+// Bounded returns raw if it is a valid object name that fits in a label
+// value. Any other name is lowercased, stripped of invalid characters,
+// shortened and made unique with a hash of raw, so different raw names never
+// end up with the same name.
+func Bounded(raw string) string {
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(raw), "-"), "-.")
+	if name == raw && len(name) <= validation.DNS1123LabelMaxLength && len(validation.IsDNS1123Subdomain(name)) == 0 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(raw))
+	hash := hex.EncodeToString(sum[:])[:hashLen]
+	name = strings.Trim(name[:min(len(name), validation.DNS1123LabelMaxLength-hashLen-1)], "-.")
+	if name == "" {
+		return hash
+	}
+	return name + "-" + hash
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package naming
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bounded", func() {
+	It("should keep names that are valid label values", func() {
+		Expect(Bounded("sync-workspace-035-1.4.0")).To(Equal("sync-workspace-035-1.4.0"))
+	})
+
+	It("should shorten long names to a label value", func() {
+		raw := "sync-workspace-035-" + strings.Repeat("9", 60) + "-controller-verify"
+		name := Bounded(raw)
+		Expect(name).To(HavePrefix("sync-workspace-035-999"))
+		Expect(len(name)).To(Equal(63))
+		Expect(Bounded(raw + "x")).NotTo(Equal(name))
+	})
+
+	It("should not map different names onto the same name", func() {
+		Expect(Bounded("A_1")).To(HavePrefix("a-1-"))
+		Expect(Bounded("A_1")).NotTo(Equal(Bounded("a-1")))
+		Expect(Bounded("___")).To(HaveLen(hashLen))
+	})
+})
+
+var _ = Describe("DataSyncName", func() {
+	It("should name DataSyncs after the workspace version", func() {
+		Expect(DataSyncName("035", "1.4.0")).To(Equal("sync-workspace-035-1.4.0"))
+		Expect(DataSyncName("035", "")).To(Equal("sync-workspace-035"))
+		name := DataSyncName("Lab_035", strings.Repeat("9", 60))
+		Expect(name).To(HavePrefix("sync-workspace-lab-035-"))
+		Expect(len(name)).To(BeNumerically("<=", 63))
+	})
+})
@@ -0,0 +1,448 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package pipeline serves the HTTP API the publish pipeline submits workspace
+// manifests and watches their DataSyncs with, so CI jobs only need the token
+// of a ServiceAccount rather than a kubeconfig.
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	certutil "k8s.io/client-go/util/cert"
+	clientretry "k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+)
+
+// maxManifestBytes bounds the size of a submitted workspace manifest.
+const maxManifestBytes = 1 << 20
+
+// DefaultPollInterval is how often a status stream checks its DataSync when
+// the server does not set one.
+const DefaultPollInterval = 2 * time.Second
+
+// DefaultAudience is the audience the tokens of callers have to be issued
+// for when the server does not set one.
+const DefaultAudience = "ot-sync-operator"
+
+// Server serves the pipeline API over HTTPS:
+//
+//	PUT /v1/namespaces/{namespace}/datasyncs/{name}
+//	GET /v1/namespaces/{namespace}/datasyncs/{name}[?watch=true]
+//
+// PUT takes a workspace manifest, the spec of a DataSync as YAML or JSON, and
+// creates the DataSync or updates its spec. Submitting the manifest the
+// DataSync was last submitted with again leaves it alone, so a pipeline can
+// retry freely. GET returns the status of the DataSync; with watch=true or an
+// Accept header of text/event-stream it streams the status as server-sent
+// events until the DataSync finishes.
+//
+// Callers send a bearer token issued for the audience of the API, e.g. with
+// kubectl create token --audience, which is authenticated with a
+// TokenReview. Tokens for other audiences, such as the API server, are
+// refused, so callers never hand the API a token that could be replayed
+// against the cluster. A SubjectAccessReview then checks that the caller may create and update, or
+// get and watch, the DataSync itself, so the datasync editor and viewer roles
+// grant access to the API in the namespaces they are bound in.
+type Server struct {
+	// BindAddress is the address the API listens on.
+	BindAddress string
+	// Client reads and writes DataSyncs and creates the reviews
+	// authenticating and authorizing callers.
+	Client client.Client
+	// TLSOpts configure the TLS server. Without a certificate, a self-signed
+	// one is generated.
+	TLSOpts []func(*tls.Config)
+	// PollInterval is how often status streams check their DataSync.
+	// Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+	// Audience is the audience tokens have to be issued for. Defaults to
+	// DefaultAudience.
+	Audience string
+}
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// Response is what the API returns for a DataSync.
+type Response struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Result is created, updated or unchanged for a submitted manifest.
+	Result controllerutil.OperationResult `json:"result,omitempty"`
+	Status otv1alpha1.DataSyncStatus      `json:"status"`
+}
+
+// Start serves the API until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	log := logf.FromContext(ctx).WithName("pipeline")
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	for _, opt := range s.TLSOpts {
+		opt(config)
+	}
+	if config.GetCertificate == nil && len(config.Certificates) == 0 {
+		cert, key, err := certutil.GenerateSelfSignedCertKey("localhost", nil, nil)
+		if err != nil {
+			return fmt.Errorf("generating a self-signed certificate: %w", err)
+		}
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	listener, err := net.Listen("tcp", s.BindAddress)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.BindAddress, err)
+	}
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		TLSConfig:         config,
+		ReadHeaderTimeout: 10 * time.Second,
+		// Status streams end along with the server.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdown); err != nil {
+			log.Error(err, "shutting down the pipeline API")
+		}
+	}()
+
+	log.Info("serving the pipeline API", "address", listener.Addr().String())
+	if err := srv.ServeTLS(listener, "", ""); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection lets every replica serve the API.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Handler returns the handler serving the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /v1/namespaces/{namespace}/datasyncs/{name}", s.submit)
+	mux.HandleFunc("GET /v1/namespaces/{namespace}/datasyncs/{name}", s.get)
+	return mux
+}
+
+// submit creates or updates a DataSync from the workspace manifest in the
+// request body.
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.authorize(w, r, "create", "update")
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxManifestBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, apierrors.NewRequestEntityTooLargeError(err.Error()))
+		return
+	}
+	if err != nil {
+		writeError(w, apierrors.NewBadRequest(fmt.Sprintf("reading the workspace manifest: %v", err)))
+		return
+	}
+	var spec otv1alpha1.DataSyncSpec
+	if err := yaml.UnmarshalStrict(body, &spec); err != nil {
+		writeError(w, apierrors.NewBadRequest(fmt.Sprintf("invalid workspace manifest: %v", err)))
+		return
+	}
+
+	ds, result, err := Apply(r.Context(), s.Client, key, nil, spec)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if result != controllerutil.OperationResultNone {
+		logf.FromContext(r.Context()).WithName("pipeline").Info("submitted workspace manifest",
+			"dataSync", key.String(), "result", result)
+	}
+
+	code := http.StatusOK
+	if result == controllerutil.OperationResultCreated {
+		code = http.StatusCreated
+	}
+	writeJSON(w, code, Response{Namespace: ds.Namespace, Name: ds.Name, Result: result, Status: ds.Status})
+}
+
+// Apply creates the DataSync key from a workspace manifest, or updates its
+// spec to the manifest, and sets labels on it. A DataSync that was last
+// applied the same manifest is left alone, even if its spec was defaulted or
+// edited since.
+//
+// The VMs of a DataSync are frozen once it leaves Queued, so another
+// manifest for a DataSync that did fails with a Conflict for which IsFrozen
+// holds, and the DataSync is left unchanged.
+func Apply(ctx context.Context, c client.Client, key types.NamespacedName, labels map[string]string, spec otv1alpha1.DataSyncSpec) (*otv1alpha1.DataSync, controllerutil.OperationResult, error) {
+	digest, err := ManifestDigest(spec)
+	if err != nil {
+		return nil, controllerutil.OperationResultNone, err
+	}
+	ds := &otv1alpha1.DataSync{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	var result controllerutil.OperationResult
+	retriable := func(err error) bool { return apierrors.IsConflict(err) && !IsFrozen(err) }
+	err = clientretry.OnError(clientretry.DefaultRetry, retriable, func() error {
+		var err error
+		result, err = controllerutil.CreateOrUpdate(ctx, c, ds, func() error {
+			for k, v := range labels {
+				metav1.SetMetaDataLabel(&ds.ObjectMeta, k, v)
+			}
+			if ds.Annotations[otv1alpha1.AnnotationManifestDigest] == digest {
+				return nil
+			}
+			if phase := ds.Status.Phase; phase != "" && phase != otv1alpha1.DataSyncPhaseQueued {
+				return frozenError{apierrors.NewConflict(otv1alpha1.GroupVersion.WithResource("datasyncs").GroupResource(),
+					key.Name, fmt.Errorf("it is %s and can no longer take another manifest; "+
+						"delete it or submit the manifest as a new version", phase))}
+			}
+			ds.Spec = spec
+			metav1.SetMetaDataAnnotation(&ds.ObjectMeta, otv1alpha1.AnnotationManifestDigest, digest)
+			return nil
+		})
+		return err
+	})
+	return ds, result, err
+}
+
+// frozenError is the Conflict Apply fails with for a DataSync whose VMs can
+// no longer change.
+type frozenError struct {
+	*apierrors.StatusError
+}
+
+// IsFrozen reports whether Apply failed because the DataSync left Queued and
+// can no longer take another manifest.
+func IsFrozen(err error) bool {
+	var frozen frozenError
+	return errors.As(err, &frozen)
+}
+
+// ManifestDigest returns the SHA-256 digest of a workspace manifest. It
+// covers the manifest as parsed, so the same manifest in another format or
+// layout has the same digest.
+func ManifestDigest(spec otv1alpha1.DataSyncSpec) (string, error) {
+	canonical, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// get returns the status of a DataSync, or streams it when asked to.
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	stream := r.URL.Query().Get("watch") == "true" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	verbs := []string{"get"}
+	if stream {
+		verbs = append(verbs, "watch")
+	}
+	key, ok := s.authorize(w, r, verbs...)
+	if !ok {
+		return
+	}
+	if stream {
+		s.stream(w, r, key)
+		return
+	}
+	ds := &otv1alpha1.DataSync{}
+	if err := s.Client.Get(r.Context(), key, ds); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Namespace: ds.Namespace, Name: ds.Name, Status: ds.Status})
+}
+
+// stream sends the status of a DataSync as a status event whenever it
+// changes, until the DataSync finishes, is deleted or the caller goes away.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, key types.NamespacedName) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, apierrors.NewInternalError(errors.New("streaming is not supported")))
+		return
+	}
+	interval := s.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	ctx := r.Context()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	started, sent := false, ""
+	for {
+		ds := &otv1alpha1.DataSync{}
+		err := s.Client.Get(ctx, key, ds)
+		switch {
+		case apierrors.IsNotFound(err) && started:
+			_, _ = fmt.Fprint(w, "event: deleted\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		case err != nil && !started:
+			writeError(w, err)
+			return
+		case err != nil:
+			logf.FromContext(ctx).WithName("pipeline").Error(err, "reading DataSync for a status stream", "dataSync", key.String())
+		case ds.ResourceVersion != sent:
+			if !started {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-cache")
+				w.WriteHeader(http.StatusOK)
+				started = true
+			}
+			data, err := json.Marshal(Response{Namespace: ds.Namespace, Name: ds.Name, Status: ds.Status})
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+			sent = ds.ResourceVersion
+			if finished(ds.Status.Phase) {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// finished reports whether a DataSync in phase is done syncing.
+func finished(phase otv1alpha1.DataSyncPhase) bool {
+	return phase == otv1alpha1.DataSyncPhaseSucceeded || phase == otv1alpha1.DataSyncPhaseFailed ||
+		phase == otv1alpha1.DataSyncPhaseCancelled
+}
+
+// authorize authenticates the caller of a request and checks that it may use
+// verbs on the DataSync the request is for, whose key it returns. Requests
+// that are not allowed are answered.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, verbs ...string) (types.NamespacedName, bool) {
+	key := types.NamespacedName{Namespace: r.PathValue("namespace"), Name: r.PathValue("name")}
+	var invalid []string
+	invalid = append(invalid, validation.IsDNS1123Label(key.Namespace)...)
+	invalid = append(invalid, validation.IsDNS1123Subdomain(key.Name)...)
+	if len(invalid) > 0 {
+		writeError(w, apierrors.NewBadRequest(strings.Join(invalid, "; ")))
+		return key, false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, apierrors.NewUnauthorized("a bearer token is required"))
+		return key, false
+	}
+	audience := s.Audience
+	if audience == "" {
+		audience = DefaultAudience
+	}
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{
+		Token:     token,
+		Audiences: []string{audience},
+	}}
+	if err := s.Client.Create(r.Context(), review); err != nil {
+		writeError(w, err)
+		return key, false
+	}
+	if !review.Status.Authenticated || !slices.Contains(review.Status.Audiences, audience) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, apierrors.NewUnauthorized("the bearer token is not valid"))
+		return key, false
+	}
+
+	user := review.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	for _, verb := range verbs {
+		access := &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: key.Namespace,
+				Verb:      verb,
+				Group:     otv1alpha1.GroupVersion.Group,
+				Resource:  "datasyncs",
+				Name:      key.Name,
+			},
+		}}
+		if err := s.Client.Create(r.Context(), access); err != nil {
+			writeError(w, err)
+			return key, false
+		}
+		if !access.Status.Allowed {
+			writeError(w, apierrors.NewForbidden(otv1alpha1.GroupVersion.WithResource("datasyncs").GroupResource(), key.Name,
+				fmt.Errorf("%s may not %s it", user.Username, verb)))
+			return key, false
+		}
+	}
+	return key, true
+}
+
+// writeJSON answers a request with v as JSON.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers a request with err as a Kubernetes Status, keeping the
+// code of API errors such as those of the admission webhooks.
+func writeError(w http.ResponseWriter, err error) {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		status = apierrors.NewInternalError(err)
+	}
+	s := status.Status()
+	s.Kind, s.APIVersion = "Status", "v1"
+	writeJSON(w, int(s.Code), s)
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing/iotest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+)
+
+const manifest = `workspaceId: "035"
+version: 1.4.0
+vms:
+- name: controller
+  url: https://mirror.example.com/workspaces/035/controller.qcow2
+  sourceType: http
+`
+
+var _ = Describe("Server", func() {
+	var (
+		ctx     context.Context
+		c       client.Client
+		api     *httptest.Server
+		allowed map[string]bool
+	)
+
+	// request sends a request to the API as the pipeline ServiceAccount.
+	request := func(method, path, body string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, method, api.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer pipeline-token")
+		resp, err := api.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(resp.Body.Close)
+		return resp
+	}
+
+	decode := func(resp *http.Response) Response {
+		var r Response
+		Expect(json.NewDecoder(resp.Body).Decode(&r)).To(Succeed())
+		return r
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		allowed = map[string]bool{"create": true, "update": true, "get": true, "watch": true}
+		c = fake.NewClientBuilder().
+			WithScheme(testScheme).
+			WithStatusSubresource(&otv1alpha1.DataSync{}).
+			WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					switch review := obj.(type) {
+					case *authenticationv1.TokenReview:
+						// api-token is a valid token issued for the API server.
+						review.Status.Authenticated = review.Spec.Token == "pipeline-token" || review.Spec.Token == "api-token"
+						if review.Spec.Token == "pipeline-token" {
+							review.Status.Audiences = review.Spec.Audiences
+						}
+						review.Status.User.Username = "system:serviceaccount:ci:publish"
+						return nil
+					case *authorizationv1.SubjectAccessReview:
+						attrs := review.Spec.ResourceAttributes
+						review.Status.Allowed = review.Spec.User == "system:serviceaccount:ci:publish" &&
+							attrs.Namespace == "default" && attrs.Resource == "datasyncs" && allowed[attrs.Verb]
+						return nil
+					}
+					return c.Create(ctx, obj, opts...)
+				},
+			}).
+			Build()
+		api = httptest.NewServer((&Server{Client: c, PollInterval: 10 * time.Millisecond}).Handler())
+		DeferCleanup(api.Close)
+	})
+
+	It("should create a DataSync from a manifest and leave it alone when it is submitted again", func() {
+		resp := request(http.MethodPut, "/v1/namespaces/default/datasyncs/sync-workspace-035", manifest)
+		Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		Expect(decode(resp).Result).To(Equal(controllerutil.OperationResultCreated))
+
+		ds := &otv1alpha1.DataSync{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sync-workspace-035"}, ds)).To(Succeed())
+		Expect(ds.Spec.WorkspaceID).To(Equal("035"))
+		Expect(ds.Spec.VMs).To(HaveLen(1))
+		Expect(ds.Annotations).To(HaveKey(otv1alpha1.AnnotationManifestDigest))
+
+		// The same manifest as JSON is the same manifest.
+		resp = request(http.MethodPut, "/v1/namespaces/default/datasyncs/sync-workspace-035",
+			`{"workspaceId": "035", "version": "1.4.0", "vms": [{"name": "controller", "sourceType": "http",
+			  "url": "https://mirror.example.com/workspaces/035/controller.qcow2"}]}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(decode(resp).Result).To(Equal(controllerutil.OperationResultNone))
+
+		resp = request(http.MethodPut, "/v1/namespaces/default/datasyncs/sync-workspace-035",
+			strings.Replace(manifest, "controller.qcow2", "controller-2.qcow2", 1))
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(decode(resp).Result).To(Equal(controllerutil.OperationResultUpdated))
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(ds), ds)).To(Succeed())
+		Expect(ds.Spec.VMs[0].URL).To(HaveSuffix("controller-2.qcow2"))
+	})
+
+	It("should refuse another manifest for a DataSync that left Queued", func() {
+		Expect(request(http.MethodPut, "/v1/namespaces/default/datasyncs/sync-workspace-035", manifest).StatusCode).
+			To(Equal(http.StatusCreated))
+		ds := &otv1alpha1.DataSync{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sync-workspace-035"}, ds)).To(Succeed())
+		ds.Status.Phase = otv1alpha1.DataSyncPhaseSyncing
+		Expect(c.Status().Update(ctx, ds)).To(Succeed())
+
+		Expect(request(http.MethodPut, "/v1/namespaces/default/datasyncs/sync-workspace-035", manifest).StatusCode).
+			To(Equal(http.StatusOK), "the same manifest is still fine")
+		resp := request(http.MethodPut, "/v1/namespaces/default/datasyncs/sync-workspace-035",
+			strings.Replace(manifest, "controller.qcow2", "controller-2.qcow2", 1))
+		Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+		var status metav1.Status
+		Expect(json.NewDecoder(resp.Body).Decode(&status)).To(Succeed())
+		Expect(status.Message).To(ContainSubstring("it is Syncing and can no longer take another manifest"))
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(ds), ds)).To(Succeed())
+		Expect(ds.Spec.VMs[0].URL).To(HaveSuffix("/controller.qcow2"))
+	})
+
+	It("should reject callers without a valid token or access to the DataSync", func() {
+		resp, err := api.Client().Get(api.URL + "/v1/namespaces/default/datasyncs/sync-workspace-035")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(resp.Body.Close)
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		allowed["update"] = false
+		Expect(request(http.MethodPut, "/v1/namespaces/default/datasyncs/sync-workspace-035", manifest).StatusCode).
+			To(Equal(http.StatusForbidden))
+		Expect(request(http.MethodGet, "/v1/namespaces/kube-system/datasyncs/sync-workspace-035", "").StatusCode).
+			To(Equal(http.StatusForbidden))
+	})
+
+	It("should reject tokens issued for another audience", func() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, api.URL+"/v1/namespaces/default/datasyncs/sync-workspace-035", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer api-token")
+		resp, err := api.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(resp.Body.Close)
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should only blame the size of manifests that are too large", func() {
+		resp := request(http.MethodPut, "/v1/namespaces/default/datasyncs/sync-workspace-035",
+			manifest+strings.Repeat("#", maxManifestBytes))
+		Expect(resp.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+
+		req := httptest.NewRequest(http.MethodPut, "/v1/namespaces/default/datasyncs/sync-workspace-035",
+			iotest.ErrReader(errors.New("connection reset")))
+		req.Header.Set("Authorization", "Bearer pipeline-token")
+		rec := httptest.NewRecorder()
+		(&Server{Client: c}).Handler().ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(rec.Body.String()).To(ContainSubstring("connection reset"))
+	})
+
+	It("should reject manifests with unknown fields", func() {
+		resp := request(http.MethodPut, "/v1/namespaces/default/datasyncs/sync-workspace-035", manifest+"workspace: 035\n")
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should stream the status until the DataSync finishes", func() {
+		Expect(request(http.MethodPut, "/v1/namespaces/default/datasyncs/sync-workspace-035", manifest).StatusCode).
+			To(Equal(http.StatusCreated))
+
+		resp := request(http.MethodGet, "/v1/namespaces/default/datasyncs/sync-workspace-035?watch=true", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+		events := bufio.NewScanner(resp.Body)
+		next := func() Response {
+			for events.Scan() {
+				if data, ok := strings.CutPrefix(events.Text(), "data: "); ok {
+					var r Response
+					Expect(json.Unmarshal([]byte(data), &r)).To(Succeed())
+					return r
+				}
+			}
+			Fail("the stream ended")
+			return Response{}
+		}
+		Expect(next().Status.Phase).To(BeEmpty())
+
+		ds := &otv1alpha1.DataSync{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sync-workspace-035"}, ds)).To(Succeed())
+		ds.Status.Phase = otv1alpha1.DataSyncPhaseSucceeded
+		Expect(c.Status().Update(ctx, ds)).To(Succeed())
+		Expect(next().Status.Phase).To(Equal(otv1alpha1.DataSyncPhaseSucceeded))
+		// The stream ends once the DataSync finished.
+		for events.Scan() {
+			Expect(events.Text()).To(BeEmpty())
+		}
+	})
+})
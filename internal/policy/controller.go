@@ -0,0 +1,109 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// Reconciler keeps a Store in sync with the policy ConfigMap.
+type Reconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	Store    *Store
+
+	// Namespace is the namespace holding the policy ConfigMap.
+	Namespace string
+}
+
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+
+// Reconcile parses the policy ConfigMap and applies it. An invalid ConfigMap
+// is reported through an Event and the ot_sync_policy_valid metric while the
+// last-known-good policy stays in effect.
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, req.NamespacedName, cm); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		log.Info("policy ConfigMap not found, using the default policy")
+		r.Store.Set(Defaults())
+		policyValid.Set(1)
+		policyReloads.WithLabelValues("default").Inc()
+		return ctrl.Result{}, nil
+	}
+
+	p, err := Parse(cm.Data)
+	if err != nil {
+		log.Error(err, "rejected policy ConfigMap, keeping the last-known-good policy")
+		r.Recorder.Eventf(cm, corev1.EventTypeWarning, "InvalidPolicy",
+			"Keeping the last-known-good policy: %v", err)
+		policyValid.Set(0)
+		policyReloads.WithLabelValues("invalid").Inc()
+		if !r.Store.Loaded() {
+			r.Store.Set(Defaults())
+		}
+		return ctrl.Result{}, nil
+	}
+
+	r.Store.Set(p)
+	log.Info("applied policy", "policy", p)
+	r.Recorder.Event(cm, corev1.EventTypeNormal, "PolicyApplied", "Sync policy applied")
+	policyValid.Set(1)
+	policyReloads.WithLabelValues("success").Inc()
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager. Only the policy
+// ConfigMap in Namespace is reconciled. One reconcile is always triggered at
+// startup so the default policy is applied when the ConfigMap does not exist.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	isPolicy := predicate.NewPredicateFuncs(func(o client.Object) bool {
+		return o.GetName() == ConfigMapName && o.GetNamespace() == r.Namespace
+	})
+
+	initial := make(chan event.GenericEvent, 1)
+	cm := &corev1.ConfigMap{}
+	cm.SetName(ConfigMapName)
+	cm.SetNamespace(r.Namespace)
+	initial <- event.GenericEvent{Object: cm}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.ConfigMap{}, builder.WithPredicates(isPolicy)).
+		WatchesRawSource(source.Channel(initial, &handler.EnqueueRequestForObject{})).
+		Named("policy").
+		// Every replica serves webhooks that read the policy, not just the leader.
+		WithOptions(controller.Options{NeedLeaderElection: ptr.To(false)}).
+		Complete(r)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Policy Reconciler", func() {
+	const namespace = "ot-sync-operator-system"
+
+	var (
+		ctx       context.Context
+		k8sClient client.Client
+		recorder  *record.FakeRecorder
+		r         *Reconciler
+		key       = types.NamespacedName{Name: ConfigMapName, Namespace: namespace}
+	)
+
+	reconcileOnce := func() {
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		recorder = record.NewFakeRecorder(10)
+		r = &Reconciler{Client: k8sClient, Recorder: recorder, Store: NewStore(), Namespace: namespace}
+	})
+
+	It("should apply the default policy when the ConfigMap does not exist", func() {
+		Expect(r.Store.Loaded()).To(BeFalse())
+		reconcileOnce()
+		Expect(r.Store.Loaded()).To(BeTrue())
+		Expect(r.Store.Get()).To(Equal(Defaults()))
+	})
+
+	It("should keep the last-known-good policy when an edit is invalid", func() {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: namespace},
+			Data:       map[string]string{KeyConcurrency: "2"},
+		}
+		Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+		reconcileOnce()
+		Expect(r.Store.Get().Concurrency).To(Equal(2))
+
+		cm.Data[KeyConcurrency] = "two"
+		Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+		reconcileOnce()
+		Expect(r.Store.Get().Concurrency).To(Equal(2))
+		Eventually(recorder.Events).Should(Receive(ContainSubstring("PolicyApplied")))
+		Eventually(recorder.Events).Should(Receive(ContainSubstring("InvalidPolicy")))
+	})
+})
@@ -0,0 +1,41 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// policyValid is 1 when the policy ConfigMap currently parses and 0 when
+	// the operator is running on the last-known-good policy.
+	policyValid = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ot_sync_policy_valid",
+		Help: "Whether the sync-operator-policy ConfigMap is currently valid (1) or rejected (0).",
+	})
+
+	// policyReloads counts policy reloads by result.
+	policyReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ot_sync_policy_reloads_total",
+		Help: "Number of times the sync-operator-policy ConfigMap was reloaded, by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(policyValid, policyReloads)
+}
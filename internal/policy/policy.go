@@ -0,0 +1,633 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy loads the cluster-wide sync policy from the sync-operator-policy ConfigMap.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"pelotech/ot-sync-operator/internal/window"
+)
+
+// ConfigMapName is the name of the ConfigMap holding the sync policy.
+const ConfigMapName = "sync-operator-policy"
+
+// Keys understood in the policy ConfigMap.
+const (
+	KeyPaused                  = "paused"
+	KeyConcurrency             = "concurrency"
+	KeyMaxBytesInFlight        = "maxBytesInFlight"
+	KeyPriorityClasses         = "priorityClasses"
+	KeyPreemption              = "preemption"
+	KeyTenantLabel             = "tenantLabel"
+	KeyTenantQuotas            = "tenantQuotas"
+	KeyDefaultTenantQuota      = "defaultTenantQuota"
+	KeyTenantWeights           = "tenantWeights"
+	KeyMonthlyEgressBudget     = "monthlyEgressBudget"
+	KeyEgressPricePerGB        = "egressPricePerGB"
+	KeySyncWindows             = "syncWindows"
+	KeySyncWindowExemptions    = "syncWindowExemptions"
+	KeySyncWindowCloseAction   = "syncWindowCloseAction"
+	KeyRetryLimit              = "retryLimit"
+	KeyRetryBackoffDuration    = "retryBackoffDuration"
+	KeyRetryBudget             = "retryBudget"
+	KeyRetryBudgetWindow       = "retryBudgetWindow"
+	KeyCircuitBreakerThreshold = "circuitBreakerThreshold"
+	KeyCircuitBreakerCooldown  = "circuitBreakerCooldown"
+	KeyDefaultStorageClass     = "defaultStorageClass"
+	KeyDefaultVolumeSize       = "defaultVolumeSize"
+	KeyDefaultAccessMode       = "defaultAccessMode"
+	KeyPruneKeepVersions       = "pruneKeepVersions"
+	KeyPruneUnusedAfter        = "pruneUnusedAfter"
+	KeyPruneInterval           = "pruneInterval"
+	KeyPruneDryRun             = "pruneDryRun"
+)
+
+// Preemption decides what happens to a lower priority sync that is in the way
+// of a more urgent one.
+type Preemption string
+
+const (
+	// PreemptionNone lets urgent syncs wait for a free slot.
+	PreemptionNone Preemption = "none"
+	// PreemptionPause stops the imports of the lower priority sync that have
+	// not finished and requeues it. Volumes that finished are kept.
+	PreemptionPause Preemption = "pause"
+	// PreemptionCancel deletes every volume of the lower priority sync and requeues it.
+	PreemptionCancel Preemption = "cancel"
+)
+
+// WindowCloseAction decides what happens to a sync that is still running
+// when the sync windows close.
+type WindowCloseAction string
+
+const (
+	// WindowCloseFinish lets the sync finish.
+	WindowCloseFinish WindowCloseAction = "finish"
+	// WindowClosePause stops the imports that have not finished and requeues
+	// the sync until the next window. Volumes that finished are kept.
+	WindowClosePause WindowCloseAction = "pause"
+	// WindowCloseCancel deletes every volume of the sync and requeues it
+	// until the next window.
+	WindowCloseCancel WindowCloseAction = "cancel"
+)
+
+// ExemptOnDemand is the sync window exemption for DataSyncs a launched
+// workspace is waiting on.
+const ExemptOnDemand = "on-demand"
+
+// AnyHost is the host in egress prices that applies to hosts without a price of their own.
+const AnyHost = "*"
+
+// EgressBudget caps the egress of a calendar month either in bytes or in
+// dollars. The zero value does not cap egress.
+type EgressBudget struct {
+	// Bytes caps the bytes downloaded.
+	Bytes int64
+	// Dollars caps the cost of the bytes downloaded.
+	Dollars float64
+}
+
+// Enabled reports whether the budget caps egress.
+func (b EgressBudget) Enabled() bool {
+	return b.Bytes > 0 || b.Dollars > 0
+}
+
+// Policy is the effective sync policy enforced by the operator.
+type Policy struct {
+	// Paused suspends every DataSync that has not finished: running imports
+	// are stopped and nothing is admitted until the policy is resumed.
+	Paused bool
+	// Concurrency is the maximum number of DataSyncs allowed to be syncing at once.
+	Concurrency int
+	// MaxBytesInFlight caps the estimated number of bytes all syncing
+	// DataSyncs download at once. Zero means only Concurrency applies.
+	MaxBytesInFlight int64
+	// PriorityClasses maps the priority class names DataSyncs may refer to
+	// onto their priority. Higher priorities are admitted first.
+	PriorityClasses map[string]int
+	// Preemption decides whether urgent syncs preempt lower priority ones.
+	Preemption Preemption
+	// TenantLabel is the DataSync label whose value names the tenant a
+	// DataSync belongs to. Empty means every namespace is a tenant.
+	TenantLabel string
+	// TenantQuotas caps the number of DataSyncs each tenant may have syncing
+	// at once.
+	TenantQuotas map[string]int
+	// DefaultTenantQuota caps tenants missing from TenantQuotas. Zero means
+	// they are only limited by Concurrency.
+	DefaultTenantQuota int
+	// TenantWeights sets the share of the slots each tenant is entitled to
+	// when DataSyncs of several tenants wait with the same urgency. Tenants
+	// missing from the map have weight 1.
+	TenantWeights map[string]int
+	// MonthlyEgressBudget stops the admission of DataSyncs once the egress of
+	// the current calendar month exceeds it.
+	MonthlyEgressBudget EgressBudget
+	// EgressPricePerGB maps source hosts onto the price in dollars of
+	// downloading a gigabyte from them. AnyHost sets the price of the hosts
+	// that are not listed.
+	EgressPricePerGB map[string]float64
+	// SyncWindows are the windows DataSyncs may start syncing in. Without
+	// windows they may start at any time.
+	SyncWindows []window.Window
+	// SyncWindowExemptions lists the priority classes that may sync outside
+	// the sync windows. ExemptOnDemand exempts the DataSyncs a launched
+	// workspace is waiting on.
+	SyncWindowExemptions []string
+	// SyncWindowCloseAction decides what happens to syncs still running when
+	// the sync windows close.
+	SyncWindowCloseAction WindowCloseAction
+	// RetryLimit is the number of times a failed sync is retried.
+	RetryLimit int
+	// RetryBackoffDuration is the initial duration to wait after a failure before retrying.
+	RetryBackoffDuration time.Duration
+	// RetryBudget is the maximum number of retries started cluster-wide within
+	// RetryBudgetWindow. Zero means retries are not budgeted.
+	RetryBudget int
+	// RetryBudgetWindow is the sliding window RetryBudget applies to.
+	RetryBudgetWindow time.Duration
+	// CircuitBreakerThreshold is the number of consecutive imports failing
+	// because of their source host after which the host is considered down.
+	// Zero disables the circuit breaker.
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown is how long a host considered down is left alone
+	// before a single DataSync probes it again.
+	CircuitBreakerCooldown time.Duration
+	// DefaultStorageClass is the storage class given to volumes that do not
+	// name one. Empty means the cluster default storage class is used.
+	DefaultStorageClass string
+	// DefaultVolumeSize is the size given to volumes whose size is neither set
+	// nor reported by their source.
+	DefaultVolumeSize resource.Quantity
+	// DefaultAccessMode is the access mode given to volumes that do not set one.
+	DefaultAccessMode corev1.PersistentVolumeAccessMode
+	// PruneKeepVersions is the number of ready versions kept per workspace,
+	// along with the versions that failed since. Zero disables this rule.
+	PruneKeepVersions int
+	// PruneUnusedAfter is how long a version must have been unused before it
+	// is pruned. Zero disables this rule. When both rules are enabled a
+	// version must break both to be pruned.
+	PruneUnusedAfter time.Duration
+	// PruneInterval is how often the pruner runs.
+	PruneInterval time.Duration
+	// PruneDryRun makes the pruner report what it would prune without deleting anything.
+	PruneDryRun bool
+}
+
+// Priority returns the priority of a priority class. DataSyncs without a
+// class, or with a class the policy does not define, have priority zero.
+func (p Policy) Priority(class string) (int, bool) {
+	priority, ok := p.PriorityClasses[class]
+	return priority, ok
+}
+
+// Quota returns the number of DataSyncs tenant may have syncing at once, or
+// zero if it is not capped.
+func (p Policy) Quota(tenant string) int {
+	if quota, ok := p.TenantQuotas[tenant]; ok {
+		return quota
+	}
+	return p.DefaultTenantQuota
+}
+
+// Weight returns the fair-share weight of tenant.
+func (p Policy) Weight(tenant string) int {
+	if weight, ok := p.TenantWeights[tenant]; ok {
+		return weight
+	}
+	return 1
+}
+
+// PricePerGB returns the price in dollars of downloading a gigabyte from host.
+func (p Policy) PricePerGB(host string) float64 {
+	if price, ok := p.EgressPricePerGB[host]; ok {
+		return price
+	}
+	return p.EgressPricePerGB[AnyHost]
+}
+
+// SyncWindowOpen reports whether syncs may start at t.
+func (p Policy) SyncWindowOpen(t time.Time) bool {
+	if len(p.SyncWindows) == 0 {
+		return true
+	}
+	for _, w := range p.SyncWindows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextSyncWindow returns when the next sync window opens after t.
+func (p Policy) NextSyncWindow(t time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+	for _, w := range p.SyncWindows {
+		if open, ok := w.NextOpen(t); ok && (!found || open.Before(next)) {
+			next, found = open, true
+		}
+	}
+	return next, found
+}
+
+// SyncWindowClosesAt returns when the sync windows that are open at t close,
+// following windows that overlap or adjoin each other.
+func (p Policy) SyncWindowClosesAt(t time.Time) time.Time {
+	end := t
+	for changed := true; changed && end.Sub(t) < 7*24*time.Hour; {
+		changed = false
+		for _, w := range p.SyncWindows {
+			if !w.Contains(end) {
+				continue
+			}
+			if closes := w.ClosesAt(end); closes.After(end) {
+				end, changed = closes, true
+			}
+		}
+	}
+	return end
+}
+
+// ExemptFromSyncWindows reports whether a DataSync of a priority class, which
+// a launched workspace may be waiting on, may sync outside the sync windows.
+func (p Policy) ExemptFromSyncWindows(class string, onDemand bool) bool {
+	for _, exemption := range p.SyncWindowExemptions {
+		if (class != "" && exemption == class) || (onDemand && exemption == ExemptOnDemand) {
+			return true
+		}
+	}
+	return false
+}
+
+// PruningEnabled reports whether any retention rule is configured.
+func (p Policy) PruningEnabled() bool {
+	return p.PruneKeepVersions > 0 || p.PruneUnusedAfter > 0
+}
+
+// Defaults returns the policy used when no ConfigMap exists. The values match
+// the example in the design proposal.
+func Defaults() Policy {
+	return Policy{
+		Concurrency:             4,
+		Preemption:              PreemptionNone,
+		RetryLimit:              2,
+		RetryBackoffDuration:    5 * time.Minute,
+		RetryBudget:             0,
+		RetryBudgetWindow:       time.Hour,
+		CircuitBreakerThreshold: 3,
+		CircuitBreakerCooldown:  10 * time.Minute,
+		SyncWindowCloseAction:   WindowCloseFinish,
+		DefaultVolumeSize:       resource.MustParse("10Gi"),
+		DefaultAccessMode:       corev1.ReadWriteOnce,
+		PruneInterval:           time.Hour,
+	}
+}
+
+// Parse builds a Policy from the data of the policy ConfigMap. Keys that are
+// not set keep their default value. Every problem found is reported so an
+// admin can fix a ConfigMap in a single edit.
+func Parse(data map[string]string) (Policy, error) {
+	p := Defaults()
+	var errs []error
+
+	for _, key := range sortedKeys(data) {
+		value := data[key]
+		var err error
+		switch key {
+		case KeyPaused:
+			p.Paused, err = parseBool(value)
+		case KeyConcurrency:
+			p.Concurrency, err = parseInt(value, 1)
+		case KeyMaxBytesInFlight:
+			p.MaxBytesInFlight, err = parseBytes(value)
+		case KeyPriorityClasses:
+			p.PriorityClasses, err = parseNamedInts(value, "priority", math.MinInt)
+		case KeyPreemption:
+			p.Preemption, err = parsePreemption(value)
+		case KeyTenantLabel:
+			p.TenantLabel, err = parseLabelKey(value)
+		case KeyTenantQuotas:
+			p.TenantQuotas, err = parseNamedInts(value, "quota", 1)
+		case KeyDefaultTenantQuota:
+			p.DefaultTenantQuota, err = parseInt(value, 0)
+		case KeyTenantWeights:
+			p.TenantWeights, err = parseNamedInts(value, "weight", 1)
+		case KeyMonthlyEgressBudget:
+			p.MonthlyEgressBudget, err = parseEgressBudget(value)
+		case KeyEgressPricePerGB:
+			p.EgressPricePerGB, err = parsePrices(value)
+		case KeySyncWindows:
+			p.SyncWindows, err = parseWindows(value)
+		case KeySyncWindowExemptions:
+			p.SyncWindowExemptions, err = parseNames(value)
+		case KeySyncWindowCloseAction:
+			p.SyncWindowCloseAction, err = parseWindowCloseAction(value)
+		case KeyRetryLimit:
+			p.RetryLimit, err = parseInt(value, 0)
+		case KeyRetryBackoffDuration:
+			p.RetryBackoffDuration, err = parseDuration(value)
+		case KeyRetryBudget:
+			p.RetryBudget, err = parseInt(value, 0)
+		case KeyRetryBudgetWindow:
+			p.RetryBudgetWindow, err = parseDuration(value)
+		case KeyCircuitBreakerThreshold:
+			p.CircuitBreakerThreshold, err = parseInt(value, 0)
+		case KeyCircuitBreakerCooldown:
+			p.CircuitBreakerCooldown, err = parseDuration(value)
+		case KeyDefaultStorageClass:
+			p.DefaultStorageClass, err = parseName(value)
+		case KeyDefaultVolumeSize:
+			p.DefaultVolumeSize, err = parseQuantity(value)
+		case KeyDefaultAccessMode:
+			p.DefaultAccessMode, err = parseAccessMode(value)
+		case KeyPruneKeepVersions:
+			p.PruneKeepVersions, err = parseInt(value, 0)
+		case KeyPruneUnusedAfter:
+			p.PruneUnusedAfter, err = parseAge(value)
+		case KeyPruneInterval:
+			p.PruneInterval, err = parseDuration(value)
+		case KeyPruneDryRun:
+			p.PruneDryRun, err = parseBool(value)
+		default:
+			err = errors.New("unknown key")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return Policy{}, errors.Join(errs...)
+	}
+	return p, nil
+}
+
+// parseInt parses an integer that must be at least minimum.
+func parseInt(value string, minimum int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an integer", value)
+	}
+	if n < minimum {
+		return 0, fmt.Errorf("must be at least %d, got %d", minimum, n)
+	}
+	return n, nil
+}
+
+// parseDuration parses a strictly positive duration such as "5m".
+func parseDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a duration", value)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive, got %s", value)
+	}
+	return d, nil
+}
+
+// parseAge parses a strictly positive duration that may also be given in
+// whole days, such as "30d".
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := parseInt(days, 1)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number of days", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return parseDuration(value)
+}
+
+// parseBool parses "true" or "false".
+func parseBool(value string) (bool, error) {
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q must be \"true\" or \"false\"", value)
+}
+
+// parseName parses the name of an object such as a storage class.
+func parseName(value string) (string, error) {
+	if msgs := validation.IsDNS1123Subdomain(value); len(msgs) > 0 {
+		return "", fmt.Errorf("%q is not a valid name: %s", value, strings.Join(msgs, ", "))
+	}
+	return value, nil
+}
+
+// parseQuantity parses a strictly positive quantity such as "10Gi".
+func parseQuantity(value string) (resource.Quantity, error) {
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return resource.Quantity{}, fmt.Errorf("%q is not a quantity", value)
+	}
+	if q.Sign() <= 0 {
+		return resource.Quantity{}, fmt.Errorf("must be positive, got %s", value)
+	}
+	return q, nil
+}
+
+// parseBytes parses a number of bytes such as "500Gi". Zero is allowed.
+func parseBytes(value string) (int64, error) {
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a quantity", value)
+	}
+	if q.Sign() < 0 {
+		return 0, fmt.Errorf("must not be negative, got %s", value)
+	}
+	return q.Value(), nil
+}
+
+// parseNamedInts parses a comma separated list of named integers such as
+// "release-day=100,nightly=-10", where each integer must be at least minimum.
+// what names the integers in errors.
+func parseNamedInts(value, what string, minimum int) (map[string]int, error) {
+	values := map[string]int{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, number, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not of the form name=%s", entry, what)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(number))
+		if err != nil {
+			return nil, fmt.Errorf("%s of %q is not an integer", what, name)
+		}
+		if n < minimum {
+			return nil, fmt.Errorf("%s of %q must be at least %d, got %d", what, name, minimum, n)
+		}
+		if _, dup := values[name]; dup {
+			return nil, fmt.Errorf("%q is defined more than once", name)
+		}
+		values[name] = n
+	}
+	return values, nil
+}
+
+// parseEgressBudget parses a budget in bytes such as "5Ti", or in dollars
+// such as "$1200". Zero disables the budget.
+func parseEgressBudget(value string) (EgressBudget, error) {
+	if amount, ok := strings.CutPrefix(value, "$"); ok {
+		dollars, err := parseDollars(amount)
+		if err != nil {
+			return EgressBudget{}, err
+		}
+		return EgressBudget{Dollars: dollars}, nil
+	}
+	bytes, err := parseBytes(value)
+	if err != nil {
+		return EgressBudget{}, err
+	}
+	return EgressBudget{Bytes: bytes}, nil
+}
+
+// parsePrices parses a comma separated list of prices per host such as
+// "mirror.example.com=0.02,*=0.09".
+func parsePrices(value string) (map[string]float64, error) {
+	prices := map[string]float64{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, price, ok := strings.Cut(entry, "=")
+		host = strings.TrimSpace(host)
+		if !ok || host == "" {
+			return nil, fmt.Errorf("%q is not of the form host=price", entry)
+		}
+		dollars, err := parseDollars(strings.TrimSpace(price))
+		if err != nil {
+			return nil, fmt.Errorf("price of %q: %w", host, err)
+		}
+		if _, dup := prices[host]; dup {
+			return nil, fmt.Errorf("%q is defined more than once", host)
+		}
+		prices[host] = dollars
+	}
+	return prices, nil
+}
+
+// parseDollars parses an amount of dollars such as "0.09". Zero is allowed.
+func parseDollars(value string) (float64, error) {
+	dollars, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(dollars, 0) || math.IsNaN(dollars) {
+		return 0, fmt.Errorf("%q is not an amount of dollars", value)
+	}
+	if dollars < 0 {
+		return 0, fmt.Errorf("must not be negative, got %s", value)
+	}
+	return dollars, nil
+}
+
+// parseWindows parses sync windows separated by semicolons or new lines,
+// such as "0 22 * * 1-5 8h; 0 0 * * 0,6 24h".
+func parseWindows(value string) ([]window.Window, error) {
+	var windows []window.Window
+	for _, spec := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '\n' }) {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		w, err := window.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// parseNames parses a comma separated list of names such as "release-day,on-demand".
+func parseNames(value string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if slices.Contains(names, name) {
+			return nil, fmt.Errorf("%q is listed more than once", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// parseWindowCloseAction parses what to do with syncs when the sync windows close.
+func parseWindowCloseAction(value string) (WindowCloseAction, error) {
+	switch action := WindowCloseAction(value); action {
+	case WindowCloseFinish, WindowClosePause, WindowCloseCancel:
+		return action, nil
+	}
+	return "", fmt.Errorf("%q must be one of %q, %q or %q", value, WindowCloseFinish, WindowClosePause, WindowCloseCancel)
+}
+
+// parseLabelKey parses a label key such as "pelotech.ot/team".
+func parseLabelKey(value string) (string, error) {
+	if msgs := validation.IsQualifiedName(value); len(msgs) > 0 {
+		return "", fmt.Errorf("%q is not a valid label key: %s", value, strings.Join(msgs, ", "))
+	}
+	return value, nil
+}
+
+// parsePreemption parses a preemption mode.
+func parsePreemption(value string) (Preemption, error) {
+	switch mode := Preemption(value); mode {
+	case PreemptionNone, PreemptionPause, PreemptionCancel:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%q must be one of %q, %q or %q", value, PreemptionNone, PreemptionPause, PreemptionCancel)
+}
+
+// parseAccessMode parses a persistent volume access mode such as "ReadWriteOnce".
+func parseAccessMode(value string) (corev1.PersistentVolumeAccessMode, error) {
+	mode := corev1.PersistentVolumeAccessMode(value)
+	switch mode {
+	case corev1.ReadWriteOnce, corev1.ReadOnlyMany, corev1.ReadWriteMany, corev1.ReadWriteOncePod:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%q is not a persistent volume access mode", value)
+}
+
+// sortedKeys returns the keys of data in a stable order so errors are reported deterministically.
+func sortedKeys(data map[string]string) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Parse", func() {
+	It("should parse the example policy from the proposal", func() {
+		p, err := Parse(map[string]string{
+			KeyConcurrency:          "3",
+			KeyRetryLimit:           "0",
+			KeyRetryBackoffDuration: "90s",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Concurrency).To(Equal(3))
+		Expect(p.RetryLimit).To(Equal(0))
+		Expect(p.RetryBackoffDuration).To(Equal(90 * time.Second))
+	})
+
+	It("should fall back to defaults for keys that are not set", func() {
+		p, err := Parse(map[string]string{KeyConcurrency: "8"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Concurrency).To(Equal(8))
+		Expect(p.RetryLimit).To(Equal(Defaults().RetryLimit))
+	})
+
+	It("should parse the global pause", func() {
+		p, err := Parse(map[string]string{KeyPaused: "true"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Paused).To(BeTrue())
+		Expect(Defaults().Paused).To(BeFalse())
+
+		_, err = Parse(map[string]string{KeyPaused: "on"})
+		Expect(err).To(MatchError(ContainSubstring(`paused: "on" must be "true" or "false"`)))
+	})
+
+	It("should parse the bandwidth budget", func() {
+		p, err := Parse(map[string]string{KeyMaxBytesInFlight: "500Gi"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.MaxBytesInFlight).To(Equal(int64(500 << 30)))
+
+		_, err = Parse(map[string]string{KeyMaxBytesInFlight: "-1"})
+		Expect(err).To(MatchError(ContainSubstring("maxBytesInFlight: must not be negative")))
+	})
+
+	It("should parse priority classes and preemption", func() {
+		p, err := Parse(map[string]string{
+			KeyPriorityClasses: "release-day=100, nightly=-10",
+			KeyPreemption:      "pause",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.PriorityClasses).To(Equal(map[string]int{"release-day": 100, "nightly": -10}))
+		priority, ok := p.Priority("release-day")
+		Expect(ok).To(BeTrue())
+		Expect(priority).To(Equal(100))
+		Expect(p.Preemption).To(Equal(PreemptionPause))
+		Expect(Defaults().Preemption).To(Equal(PreemptionNone))
+
+		_, err = Parse(map[string]string{
+			KeyPriorityClasses: "release-day=high,nightly",
+			KeyPreemption:      "evict",
+		})
+		Expect(err).To(MatchError(ContainSubstring(`priorityClasses: priority of "release-day" is not an integer`)))
+		Expect(err).To(MatchError(ContainSubstring(`preemption: "evict" must be one of`)))
+	})
+
+	It("should parse tenant quotas and weights", func() {
+		p, err := Parse(map[string]string{
+			KeyTenantLabel:        "pelotech.ot/team",
+			KeyTenantQuotas:       "red=2, blue=4",
+			KeyDefaultTenantQuota: "1",
+			KeyTenantWeights:      "blue=3",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.TenantLabel).To(Equal("pelotech.ot/team"))
+		Expect(p.Quota("red")).To(Equal(2))
+		Expect(p.Quota("green")).To(Equal(1))
+		Expect(p.Weight("blue")).To(Equal(3))
+		Expect(p.Weight("red")).To(Equal(1))
+		Expect(Defaults().Quota("red")).To(BeZero())
+
+		_, err = Parse(map[string]string{
+			KeyTenantLabel:   "not a label",
+			KeyTenantQuotas:  "red=0",
+			KeyTenantWeights: "blue",
+		})
+		Expect(err).To(MatchError(ContainSubstring(`tenantLabel: "not a label" is not a valid label key`)))
+		Expect(err).To(MatchError(ContainSubstring(`tenantQuotas: quota of "red" must be at least 1, got 0`)))
+		Expect(err).To(MatchError(ContainSubstring(`tenantWeights: "blue" is not of the form name=weight`)))
+	})
+
+	It("should parse the circuit breaker", func() {
+		p, err := Parse(map[string]string{
+			KeyCircuitBreakerThreshold: "0",
+			KeyCircuitBreakerCooldown:  "30m",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.CircuitBreakerThreshold).To(BeZero())
+		Expect(p.CircuitBreakerCooldown).To(Equal(30 * time.Minute))
+		Expect(Defaults().CircuitBreakerThreshold).To(Equal(3))
+
+		_, err = Parse(map[string]string{KeyCircuitBreakerCooldown: "0s"})
+		Expect(err).To(MatchError(ContainSubstring("circuitBreakerCooldown: must be positive")))
+	})
+
+	It("should parse the egress budget and prices", func() {
+		p, err := Parse(map[string]string{
+			KeyMonthlyEgressBudget: "5Ti",
+			KeyEgressPricePerGB:    "mirror.example.com=0.02, *=0.09",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.MonthlyEgressBudget).To(Equal(EgressBudget{Bytes: 5 << 40}))
+		Expect(p.PricePerGB("mirror.example.com")).To(Equal(0.02))
+		Expect(p.PricePerGB("registry.example.com")).To(Equal(0.09))
+		Expect(Defaults().MonthlyEgressBudget.Enabled()).To(BeFalse())
+
+		p, err = Parse(map[string]string{KeyMonthlyEgressBudget: "$1200.50"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.MonthlyEgressBudget).To(Equal(EgressBudget{Dollars: 1200.5}))
+		Expect(p.PricePerGB("mirror.example.com")).To(BeZero())
+
+		_, err = Parse(map[string]string{
+			KeyMonthlyEgressBudget: "$lots",
+			KeyEgressPricePerGB:    "mirror.example.com=-1",
+		})
+		Expect(err).To(MatchError(ContainSubstring(`monthlyEgressBudget: "lots" is not an amount of dollars`)))
+		Expect(err).To(MatchError(ContainSubstring(`egressPricePerGB: price of "mirror.example.com": must not be negative`)))
+	})
+
+	It("should parse the sync windows", func() {
+		p, err := Parse(map[string]string{
+			KeySyncWindows:           "0 22 * * 1-5 8h; 0 0 * * 0,6 24h",
+			KeySyncWindowExemptions:  "release-day, on-demand",
+			KeySyncWindowCloseAction: "pause",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.SyncWindows).To(HaveLen(2))
+		monday := time.Date(2025, 7, 7, 12, 0, 0, 0, time.UTC)
+		Expect(p.SyncWindowOpen(monday)).To(BeFalse())
+		next, ok := p.NextSyncWindow(monday)
+		Expect(ok).To(BeTrue())
+		Expect(next).To(Equal(monday.Add(10 * time.Hour)))
+		Expect(p.SyncWindowOpen(monday.Add(11 * time.Hour))).To(BeTrue())
+		// Friday night runs into the weekend window, which runs into Monday.
+		friday := monday.Add(4*24*time.Hour + 11*time.Hour)
+		Expect(p.SyncWindowClosesAt(friday)).To(Equal(time.Date(2025, 7, 14, 0, 0, 0, 0, time.UTC)))
+		Expect(p.ExemptFromSyncWindows("release-day", false)).To(BeTrue())
+		Expect(p.ExemptFromSyncWindows("", true)).To(BeTrue())
+		Expect(p.ExemptFromSyncWindows("nightly", false)).To(BeFalse())
+		Expect(p.SyncWindowCloseAction).To(Equal(WindowClosePause))
+		Expect(Defaults().SyncWindowOpen(monday)).To(BeTrue())
+		Expect(Defaults().SyncWindowCloseAction).To(Equal(WindowCloseFinish))
+
+		_, err = Parse(map[string]string{
+			KeySyncWindows:           "0 22 * * 1-5",
+			KeySyncWindowExemptions:  "nightly,nightly",
+			KeySyncWindowCloseAction: "abort",
+		})
+		Expect(err).To(MatchError(ContainSubstring("syncWindows: ")))
+		Expect(err).To(MatchError(ContainSubstring(`syncWindowExemptions: "nightly" is listed more than once`)))
+		Expect(err).To(MatchError(ContainSubstring(`syncWindowCloseAction: "abort" must be one of`)))
+	})
+
+	It("should parse the storage defaults", func() {
+		p, err := Parse(map[string]string{
+			KeyDefaultStorageClass: "fast-ssd",
+			KeyDefaultVolumeSize:   "40Gi",
+			KeyDefaultAccessMode:   "ReadWriteMany",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.DefaultStorageClass).To(Equal("fast-ssd"))
+		Expect(p.DefaultVolumeSize.String()).To(Equal("40Gi"))
+		Expect(p.DefaultAccessMode).To(Equal(corev1.ReadWriteMany))
+
+		_, err = Parse(map[string]string{
+			KeyDefaultStorageClass: "Fast SSD",
+			KeyDefaultVolumeSize:   "0",
+			KeyDefaultAccessMode:   "ReadWriteSometimes",
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(`defaultStorageClass: "Fast SSD" is not a valid name`))
+		Expect(err.Error()).To(ContainSubstring("defaultVolumeSize: must be positive"))
+		Expect(err.Error()).To(ContainSubstring(`defaultAccessMode: "ReadWriteSometimes" is not a persistent volume access mode`))
+	})
+
+	It("should parse the retention policy", func() {
+		p, err := Parse(map[string]string{
+			KeyPruneKeepVersions: "3",
+			KeyPruneUnusedAfter:  "30d",
+			KeyPruneInterval:     "15m",
+			KeyPruneDryRun:       "true",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.PruningEnabled()).To(BeTrue())
+		Expect(p.PruneKeepVersions).To(Equal(3))
+		Expect(p.PruneUnusedAfter).To(Equal(30 * 24 * time.Hour))
+		Expect(p.PruneInterval).To(Equal(15 * time.Minute))
+		Expect(p.PruneDryRun).To(BeTrue())
+
+		Expect(Defaults().PruningEnabled()).To(BeFalse())
+		_, err = Parse(map[string]string{KeyPruneUnusedAfter: "0d", KeyPruneDryRun: "yes"})
+		Expect(err).To(MatchError(ContainSubstring(`pruneUnusedAfter: "0d" is not a number of days`)))
+		Expect(err).To(MatchError(ContainSubstring(`pruneDryRun: "yes" must be "true" or "false"`)))
+	})
+
+	It("should report every invalid key", func() {
+		_, err := Parse(map[string]string{
+			KeyConcurrency:          "0",
+			KeyRetryBackoffDuration: "soon",
+			"concurency":            "4",
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("concurrency: must be at least 1"))
+		Expect(err.Error()).To(ContainSubstring(`retryBackoffDuration: "soon" is not a duration`))
+		Expect(err.Error()).To(ContainSubstring("concurency: unknown key"))
+	})
+})
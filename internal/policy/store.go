@@ -0,0 +1,68 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Store holds the effective policy and swaps it atomically so readers never
+// observe a partially applied ConfigMap.
+type Store struct {
+	current atomic.Pointer[Policy]
+
+	mu          sync.Mutex
+	subscribers []func(Policy)
+}
+
+// NewStore returns a Store that has not loaded a policy yet.
+func NewStore() *Store {
+	return &Store{}
+}
+
+// Get returns the effective policy, or the default policy if none has been loaded.
+func (s *Store) Get() Policy {
+	if p := s.current.Load(); p != nil {
+		return *p
+	}
+	return Defaults()
+}
+
+// Set replaces the effective policy and notifies subscribers.
+func (s *Store) Set(p Policy) {
+	s.current.Store(&p)
+
+	s.mu.Lock()
+	subscribers := append([]func(Policy){}, s.subscribers...)
+	s.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(p)
+	}
+}
+
+// Subscribe registers fn to be called every time a policy is applied.
+func (s *Store) Subscribe(fn func(Policy)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// Loaded reports whether a policy has been applied since startup.
+func (s *Store) Loaded() bool {
+	return s.current.Load() != nil
+}
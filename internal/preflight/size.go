@@ -0,0 +1,196 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package preflight inspects sync sources before anything is downloaded.
+package preflight
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// qcow2Magic starts every qcow2 image. The virtual disk size is stored as a
+// big endian uint64 at byte 24 of the header.
+var qcow2Magic = []byte{'Q', 'F', 'I', 0xfb}
+
+const (
+	qcow2HeaderLen  = 32
+	qcow2SizeOffset = 24
+)
+
+// foreignMagics start images whose length is not the size of the disk they
+// produce: compressed images and disk formats other than qcow2 and raw.
+var foreignMagics = map[string][]byte{
+	"gzip":  {0x1f, 0x8b},
+	"xz":    {0xfd, '7', 'z', 'X', 'Z', 0x00},
+	"zstd":  {0x28, 0xb5, 0x2f, 0xfd},
+	"bzip2": []byte("BZh"),
+	"vmdk":  []byte("KDMV"),
+	"vhdx":  []byte("vhdxfile"),
+}
+
+// ErrNoDiskSize is returned for images that do not tell the size of the disk
+// they produce without downloading them.
+var ErrNoDiskSize = errors.New("the size of the disk cannot be looked up")
+
+// Sizer estimates the size of the disk an http source will produce.
+type Sizer interface {
+	DiskSize(ctx context.Context, src Source) (int64, error)
+}
+
+// DownloadSizer reports how many bytes downloading an http source transfers.
+type DownloadSizer interface {
+	DownloadSize(ctx context.Context, src Source) (int64, error)
+}
+
+// HTTPSizer estimates disk sizes with a ranged GET of the image header and
+// download sizes with a HEAD request.
+type HTTPSizer struct {
+	Client *http.Client
+}
+
+// NewHTTPSizer returns an HTTPSizer whose requests time out after timeout.
+// Its requests are not sent to loopback, link-local or unspecified
+// addresses, so sources cannot point it at the operator itself or at the
+// metadata services of cloud providers.
+func NewHTTPSizer(timeout time.Duration) *HTTPSizer {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: timeout, Control: refuseLocal}).DialContext
+	return &HTTPSizer{Client: &http.Client{Timeout: timeout, Transport: transport}}
+}
+
+// refuseLocal refuses connections to addresses local to the node.
+func refuseLocal(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("refusing to look up sources at %s", host)
+	}
+	return nil
+}
+
+// DiskSize returns the virtual size of a qcow2 image, or the length of a raw
+// image, without downloading more than its header. Other images fail with
+// ErrNoDiskSize.
+func (s *HTTPSizer) DiskSize(ctx context.Context, src Source) (int64, error) {
+	req, err := src.request(ctx, http.MethodGet)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", qcow2HeaderLen-1))
+
+	resp, err := s.client(src).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var length int64
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		length, err = totalLength(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return 0, err
+		}
+	case http.StatusOK:
+		// The server ignored the range; only read the header we asked for.
+		length = resp.ContentLength
+	default:
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	header := make([]byte, qcow2HeaderLen)
+	n, err := io.ReadFull(resp.Body, header)
+	for format, magic := range foreignMagics {
+		if bytes.HasPrefix(header[:n], magic) {
+			return 0, fmt.Errorf("%w from a %s image", ErrNoDiskSize, format)
+		}
+	}
+	switch {
+	case err == nil && bytes.HasPrefix(header, qcow2Magic):
+		return int64(binary.BigEndian.Uint64(header[qcow2SizeOffset:])), nil
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		// The whole image is shorter than a qcow2 header.
+		if length <= 0 {
+			length = int64(n)
+		}
+	case err != nil:
+		return 0, err
+	}
+	if length <= 0 {
+		return 0, fmt.Errorf("server did not report the size of %s", src.URL)
+	}
+	return length, nil
+}
+
+// DownloadSize returns the Content-Length the server reports for a source.
+func (s *HTTPSizer) DownloadSize(ctx context.Context, src Source) (int64, error) {
+	req, err := src.request(ctx, http.MethodHead)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.client(src).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf("server did not report the size of %s", src.URL)
+	}
+	return resp.ContentLength, nil
+}
+
+// client returns the client to send the requests for a source with, which
+// trusts the CA bundle of the source if it has one.
+func (s *HTTPSizer) client(src Source) *http.Client {
+	if src.RootCAs == nil {
+		return s.Client
+	}
+	transport, ok := s.Client.Transport.(*http.Transport)
+	if !ok || transport == nil {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: src.RootCAs}
+	c := *s.Client
+	c.Transport = transport
+	return &c
+}
+
+// totalLength parses the complete length from a "bytes 0-31/12345" Content-Range header.
+func totalLength(contentRange string) (int64, error) {
+	var start, end, total int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total); err != nil {
+		return 0, fmt.Errorf("unexpected Content-Range %q", contentRange)
+	}
+	return total, nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package preflight
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func qcow2Image(virtualSize uint64) []byte {
+	image := make([]byte, 4096)
+	copy(image, qcow2Magic)
+	binary.BigEndian.PutUint64(image[qcow2SizeOffset:], virtualSize)
+	return image
+}
+
+var _ = Describe("HTTPSizer", func() {
+	var (
+		server *httptest.Server
+		sizer  *HTTPSizer
+	)
+
+	BeforeEach(func() {
+		raw := bytes.Repeat([]byte{0}, 1000)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/disk.qcow2", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "disk.qcow2", time.Time{}, bytes.NewReader(qcow2Image(40<<30)))
+		})
+		mux.HandleFunc("/disk.img", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "disk.img", time.Time{}, bytes.NewReader(raw))
+		})
+		mux.HandleFunc("/no-range.img", func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write(raw)
+		})
+		mux.HandleFunc("/tiny.img", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "tiny.img", time.Time{}, strings.NewReader("tiny"))
+		})
+		mux.HandleFunc("/disk.img.gz", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "disk.img.gz", time.Time{}, bytes.NewReader(append([]byte{0x1f, 0x8b, 8}, raw...)))
+		})
+		mux.HandleFunc("/private.qcow2", func(w http.ResponseWriter, r *http.Request) {
+			if user, password, ok := r.BasicAuth(); !ok || user != "ci" || password != "hunter2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			http.ServeContent(w, r, "private.qcow2", time.Time{}, bytes.NewReader(qcow2Image(8<<30)))
+		})
+		server = httptest.NewServer(mux)
+		DeferCleanup(server.Close)
+		// The test server listens on loopback, which NewHTTPSizer refuses.
+		sizer = &HTTPSizer{Client: &http.Client{Timeout: time.Second}}
+	})
+
+	source := func(path string) Source {
+		return Source{URL: server.URL + path}
+	}
+
+	It("should read the virtual size of qcow2 images from their header", func() {
+		Expect(sizer.DiskSize(context.Background(), source("/disk.qcow2"))).To(Equal(int64(40 << 30)))
+	})
+
+	It("should use the length of other images", func() {
+		Expect(sizer.DiskSize(context.Background(), source("/disk.img"))).To(Equal(int64(1000)))
+		Expect(sizer.DiskSize(context.Background(), source("/no-range.img"))).To(Equal(int64(1000)))
+		Expect(sizer.DiskSize(context.Background(), source("/tiny.img"))).To(Equal(int64(4)))
+	})
+
+	It("should not take the length of compressed images for the size of their disk", func() {
+		Expect(sizer.DiskSize(context.Background(), source("/disk.img.gz"))).Error().To(MatchError(ErrNoDiskSize))
+	})
+
+	It("should send the headers of the source", func() {
+		src := source("/private.qcow2")
+		Expect(sizer.DiskSize(context.Background(), src)).Error().To(HaveOccurred())
+		src.Header = http.Header{}
+		src.Header.Set("Authorization", "Basic Y2k6aHVudGVyMg==")
+		Expect(sizer.DiskSize(context.Background(), src)).To(Equal(int64(8 << 30)))
+	})
+
+	It("should refuse to look up sources on loopback addresses", func() {
+		Expect(NewHTTPSizer(time.Second).DiskSize(context.Background(), source("/disk.qcow2"))).Error().To(
+			MatchError(ContainSubstring("refusing to look up sources")))
+	})
+
+	It("should report the download size from a HEAD request", func() {
+		Expect(sizer.DownloadSize(context.Background(), source("/disk.qcow2"))).To(Equal(int64(4096)))
+		Expect(sizer.DownloadSize(context.Background(), source("/missing"))).Error().To(HaveOccurred())
+	})
+
+	It("should fail for missing images", func() {
+		Expect(sizer.DiskSize(context.Background(), source("/missing"))).Error().To(HaveOccurred())
+	})
+})
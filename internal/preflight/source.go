@@ -0,0 +1,101 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package preflight
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+)
+
+// Source is an http source along with what CDI downloads it with, so it is
+// looked up the same way it is imported.
+type Source struct {
+	URL string
+	// Header is sent with every request, including the credentials of the
+	// source.
+	Header http.Header
+	// RootCAs verify the server instead of the system roots when set.
+	RootCAs *x509.CertPool
+}
+
+// SourceFor returns the source of an http VM entry of a DataSync in
+// namespace, with the extra headers of the entry and its headers Secret, the
+// credentials in its Secret and the CA bundle in its ConfigMap, which are
+// read with reader.
+func SourceFor(ctx context.Context, reader client.Reader, namespace string, vm *otv1alpha1.DataSyncVM) (Source, error) {
+	src := Source{URL: vm.URL, Header: http.Header{}}
+	if vm.HTTP != nil {
+		for _, h := range vm.HTTP.Headers {
+			src.Header.Add(h.Name, h.Value)
+		}
+		if vm.HTTP.HeadersSecretRef != "" {
+			secret := &corev1.Secret{}
+			key := types.NamespacedName{Namespace: namespace, Name: vm.HTTP.HeadersSecretRef}
+			if err := reader.Get(ctx, key, secret); err != nil {
+				return Source{}, fmt.Errorf("reading Secret %s: %w", vm.HTTP.HeadersSecretRef, err)
+			}
+			// Like CDI, every value is a header in the form "Name: value".
+			for _, line := range secret.Data {
+				if name, value, ok := strings.Cut(string(line), ":"); ok {
+					src.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+				}
+			}
+		}
+	}
+	if vm.SecretRef != "" {
+		secret := &corev1.Secret{}
+		if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: vm.SecretRef}, secret); err != nil {
+			return Source{}, fmt.Errorf("reading Secret %s: %w", vm.SecretRef, err)
+		}
+		// CDI sends the credentials of http sources as basic auth.
+		credentials := string(secret.Data["accessKeyId"]) + ":" + string(secret.Data["secretKey"])
+		src.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	if vm.CertConfigMapRef != "" {
+		cm := &corev1.ConfigMap{}
+		if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: vm.CertConfigMapRef}, cm); err != nil {
+			return Source{}, fmt.Errorf("reading ConfigMap %s: %w", vm.CertConfigMapRef, err)
+		}
+		src.RootCAs = x509.NewCertPool()
+		for _, bundle := range cm.Data {
+			src.RootCAs.AppendCertsFromPEM([]byte(bundle))
+		}
+	}
+	return src, nil
+}
+
+// request returns a request for the source with its headers.
+func (src Source) request(ctx context.Context, method string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, src.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range src.Header {
+		req.Header[name] = values
+	}
+	return req, nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package preflight
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+)
+
+var _ = Describe("SourceFor", func() {
+	It("should send the headers of the entry and of its headers Secret", func() {
+		reader := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "mirror-token", Namespace: "default"},
+			Data:       map[string][]byte{"token": []byte("Authorization: Bearer abc")},
+		}).Build()
+		vm := &otv1alpha1.DataSyncVM{
+			URL: "https://mirror.example.com/disk.qcow2",
+			HTTP: &otv1alpha1.DataSyncHTTPSource{
+				Headers:          []otv1alpha1.DataSyncHTTPHeader{{Name: "X-Workspace", Value: "035"}},
+				HeadersSecretRef: "mirror-token",
+			},
+		}
+
+		src, err := SourceFor(context.Background(), reader, "default", vm)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src.Header.Get("X-Workspace")).To(Equal("035"))
+		Expect(src.Header.Get("Authorization")).To(Equal("Bearer abc"))
+
+		_, err = SourceFor(context.Background(), reader, "other", vm)
+		Expect(err).To(MatchError(ContainSubstring("reading Secret mirror-token")))
+	})
+})
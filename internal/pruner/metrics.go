@@ -0,0 +1,41 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pruner
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// pruneRuns counts pruning passes by result.
+	pruneRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ot_sync_pruner_runs_total",
+		Help: "Number of pruning passes, by result.",
+	}, []string{"result"})
+
+	// prunedVersions counts pruned workspace versions. Versions only reported
+	// in dry-run mode are counted with dry_run="true".
+	prunedVersions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ot_sync_pruner_pruned_total",
+		Help: "Number of workspace versions pruned, or reported in dry-run mode.",
+	}, []string{"dry_run"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(pruneRuns, prunedVersions)
+}
@@ -0,0 +1,334 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package pruner deletes stale workspace versions according to the retention
+// rules of the sync policy, without ever touching a volume that is in use.
+package pruner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/cdi"
+	"pelotech/ot-sync-operator/internal/kubevirt"
+	"pelotech/ot-sync-operator/internal/policy"
+)
+
+// Pruner periodically deletes the DataSyncs of workspace versions that the
+// retention rules of the policy no longer keep. The storage of a pruned
+// DataSync is torn down according to its deletion policy.
+//
+// A version is in use while any of its PVCs is referenced by a VirtualMachine,
+// a VirtualMachineInstance or a running pod. Versions in use are never pruned
+// and have their status.lastUsedTime refreshed on every run.
+type Pruner struct {
+	// Client deletes DataSyncs and records when they were last used.
+	Client client.Client
+	// Reader lists the objects inspected on every run. It should not be cached
+	// so the pruner does not keep every pod of the cluster in memory.
+	Reader   client.Reader
+	Recorder record.EventRecorder
+	Policy   *policy.Store
+}
+
+// +kubebuilder:rbac:groups=kubevirt.io,resources=virtualmachines;virtualmachineinstances,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+
+// Start runs the pruner every prune interval until ctx is done. Nothing is
+// pruned unless the policy configures a retention rule. The policy is read
+// again after every run and whenever it changes, so the first run waits for
+// it to load and a new interval applies right away.
+func (p *Pruner) Start(ctx context.Context) error {
+	log := logf.FromContext(ctx).WithName("pruner")
+	changed := make(chan struct{}, 1)
+	p.Policy.Subscribe(func(policy.Policy) {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	var last time.Time
+	for {
+		pol := p.Policy.Get()
+		// next stays nil, blocking until the policy changes, while there is
+		// nothing to prune.
+		var next <-chan time.Time
+		if p.Policy.Loaded() && pol.PruningEnabled() {
+			wait := time.Until(last.Add(pol.PruneInterval))
+			if wait <= 0 {
+				if err := p.Prune(ctx, time.Now()); err != nil {
+					log.Error(err, "pruning failed")
+				}
+				last = time.Now()
+				continue
+			}
+			next = time.After(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-next:
+		case <-changed:
+		}
+	}
+}
+
+// NeedLeaderElection ensures only the leader prunes.
+func (p *Pruner) NeedLeaderElection() bool {
+	return true
+}
+
+// candidate is a DataSync the retention rules no longer keep.
+type candidate struct {
+	ds     *otv1alpha1.DataSync
+	reason string
+}
+
+// Prune runs a single pruning pass as of now.
+func (p *Pruner) Prune(ctx context.Context, now time.Time) error {
+	log := logf.FromContext(ctx).WithName("pruner")
+	pol := p.Policy.Get()
+
+	list := &otv1alpha1.DataSyncList{}
+	if err := p.Reader.List(ctx, list); err != nil {
+		pruneRuns.WithLabelValues("error").Inc()
+		return fmt.Errorf("listing DataSyncs: %w", err)
+	}
+	claims, err := p.claimsInUse(ctx)
+	if err != nil {
+		pruneRuns.WithLabelValues("error").Inc()
+		return err
+	}
+
+	var errs []error
+	used := map[types.NamespacedName]bool{}
+	for i := range list.Items {
+		ds := &list.Items[i]
+		if !inUse(ds, claims) {
+			continue
+		}
+		used[client.ObjectKeyFromObject(ds)] = true
+		if err := p.markUsed(ctx, ds, now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, c := range plan(list.Items, used, pol, now) {
+		if pol.PruneDryRun {
+			log.Info("would prune DataSync", "namespace", c.ds.Namespace, "name", c.ds.Name, "reason", c.reason)
+			p.Recorder.Eventf(c.ds, corev1.EventTypeNormal, "PruneCandidate", "Would prune: %s", c.reason)
+			prunedVersions.WithLabelValues(strconv.FormatBool(true)).Inc()
+			continue
+		}
+
+		// A VirtualMachine may have started using the version since the run
+		// began, so its namespace is checked again right before deleting it.
+		claims, err := p.claimsInUse(ctx, client.InNamespace(c.ds.Namespace))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if inUse(c.ds, claims) {
+			if err := p.markUsed(ctx, c.ds, now); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		log.Info("pruning DataSync", "namespace", c.ds.Namespace, "name", c.ds.Name, "reason", c.reason)
+		// The preconditions make sure nothing changed since the DataSync was judged stale.
+		err = p.Client.Delete(ctx, c.ds, client.Preconditions{UID: &c.ds.UID, ResourceVersion: &c.ds.ResourceVersion})
+		switch {
+		case apierrors.IsNotFound(err), apierrors.IsConflict(err):
+			continue
+		case err != nil:
+			errs = append(errs, fmt.Errorf("pruning DataSync %s/%s: %w", c.ds.Namespace, c.ds.Name, err))
+			continue
+		}
+		p.Recorder.Eventf(c.ds, corev1.EventTypeNormal, "Pruned", "Pruned: %s", c.reason)
+		prunedVersions.WithLabelValues(strconv.FormatBool(false)).Inc()
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		pruneRuns.WithLabelValues("error").Inc()
+		return err
+	}
+	pruneRuns.WithLabelValues("success").Inc()
+	return nil
+}
+
+// plan returns the DataSyncs the retention rules no longer keep. DataSyncs
+// are grouped by namespace and workspace and ranked newest first; only ready
+// versions count towards the versions to keep, but failed and cancelled
+// versions newer than the last of them are kept too, as rotated credentials
+// may still re-arm them. Versions that are in use, still syncing or already
+// being deleted are never returned.
+func plan(items []otv1alpha1.DataSync, used map[types.NamespacedName]bool, pol policy.Policy, now time.Time) []candidate {
+	type workspace struct{ namespace, id string }
+	groups := map[workspace][]*otv1alpha1.DataSync{}
+	var order []workspace
+	for i := range items {
+		ds := &items[i]
+		key := workspace{ds.Namespace, ds.Spec.WorkspaceID}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], ds)
+	}
+
+	var candidates []candidate
+	for _, key := range order {
+		versions := groups[key]
+		sort.SliceStable(versions, func(i, j int) bool {
+			a, b := versions[i].CreationTimestamp, versions[j].CreationTimestamp
+			if !a.Equal(&b) {
+				return b.Before(&a)
+			}
+			return versions[i].Name < versions[j].Name
+		})
+
+		ready := 0
+		for _, ds := range versions {
+			phase := ds.Status.Phase
+			// newerReady counts the ready versions newer than ds.
+			newerReady := ready
+			if phase == otv1alpha1.DataSyncPhaseSucceeded {
+				ready++
+			}
+			if !ds.DeletionTimestamp.IsZero() || used[client.ObjectKeyFromObject(ds)] ||
+				(phase != otv1alpha1.DataSyncPhaseSucceeded && phase != otv1alpha1.DataSyncPhaseFailed &&
+					phase != otv1alpha1.DataSyncPhaseCancelled) {
+				continue
+			}
+
+			var reasons []string
+			if pol.PruneKeepVersions > 0 {
+				if newerReady < pol.PruneKeepVersions {
+					continue
+				}
+				reasons = append(reasons, fmt.Sprintf("not among the %d newest ready versions of workspace %s",
+					pol.PruneKeepVersions, key.id))
+			}
+			if pol.PruneUnusedAfter > 0 {
+				unused := now.Sub(lastUsed(ds))
+				if unused < pol.PruneUnusedAfter {
+					continue
+				}
+				reasons = append(reasons, "unused for "+duration.HumanDuration(unused))
+			}
+			candidates = append(candidates, candidate{ds: ds, reason: describe(ds) + " is " + strings.Join(reasons, " and ")})
+		}
+	}
+	return candidates
+}
+
+// lastUsed returns when a DataSync was last seen in use, falling back to when
+// it became ready or failed, or to its creation.
+func lastUsed(ds *otv1alpha1.DataSync) time.Time {
+	if ds.Status.LastUsedTime != nil {
+		return ds.Status.LastUsedTime.Time
+	}
+	if c := meta.FindStatusCondition(ds.Status.Conditions, otv1alpha1.ConditionReady); c != nil {
+		return c.LastTransitionTime.Time
+	}
+	return ds.CreationTimestamp.Time
+}
+
+// describe names the workspace version of a DataSync for events.
+func describe(ds *otv1alpha1.DataSync) string {
+	if ds.Spec.Version == "" {
+		return fmt.Sprintf("DataSync %s of workspace %s", ds.Name, ds.Spec.WorkspaceID)
+	}
+	return fmt.Sprintf("version %s of workspace %s", ds.Spec.Version, ds.Spec.WorkspaceID)
+}
+
+// markUsed records that a DataSync was seen in use.
+func (p *Pruner) markUsed(ctx context.Context, ds *otv1alpha1.DataSync, now time.Time) error {
+	patch := client.MergeFrom(ds.DeepCopy())
+	ds.Status.LastUsedTime = &metav1.Time{Time: now}
+	if err := p.Client.Status().Patch(ctx, ds, patch); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("recording use of DataSync %s/%s: %w", ds.Namespace, ds.Name, err)
+	}
+	return nil
+}
+
+// inUse reports whether any PVC of a DataSync is referenced.
+func inUse(ds *otv1alpha1.DataSync, claims map[types.NamespacedName]bool) bool {
+	for _, vm := range ds.Spec.VMs {
+		if claims[types.NamespacedName{Namespace: ds.Namespace, Name: cdi.DataVolumeName(ds, vm)}] {
+			return true
+		}
+	}
+	return false
+}
+
+// claimsInUse returns every PVC referenced by a VirtualMachine, a
+// VirtualMachineInstance or a pod that has not terminated, among the objects
+// opts select. Any error aborts pruning, since pruning on partial
+// information could delete a volume in use.
+func (p *Pruner) claimsInUse(ctx context.Context, opts ...client.ListOption) (map[types.NamespacedName]bool, error) {
+	claims := map[types.NamespacedName]bool{}
+
+	pods := &corev1.PodList{}
+	if err := p.Reader.List(ctx, pods, opts...); err != nil {
+		return nil, fmt.Errorf("listing pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil {
+				claims[types.NamespacedName{Namespace: pod.Namespace, Name: volume.PersistentVolumeClaim.ClaimName}] = true
+			}
+		}
+	}
+
+	for _, gvk := range []schema.GroupVersionKind{kubevirt.VirtualMachineGVK, kubevirt.VirtualMachineInstanceGVK} {
+		list := kubevirt.NewList(gvk)
+		if err := p.Reader.List(ctx, list, opts...); err != nil {
+			// Without KubeVirt installed nothing but pods can use a volume.
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, fmt.Errorf("listing %s: %w", gvk.Kind, err)
+		}
+		for i := range list.Items {
+			for _, name := range kubevirt.ClaimNames(&list.Items[i]) {
+				claims[types.NamespacedName{Namespace: list.Items[i].GetNamespace(), Name: name}] = true
+			}
+		}
+	}
+	return claims, nil
+}
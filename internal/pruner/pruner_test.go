@@ -0,0 +1,245 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pruner
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/kubevirt"
+	"pelotech/ot-sync-operator/internal/policy"
+)
+
+var _ = Describe("Pruner", func() {
+	var (
+		ctx      context.Context
+		now      time.Time
+		store    *policy.Store
+		recorder *record.FakeRecorder
+		objects  []client.Object
+	)
+
+	// version returns a DataSync for a version of workspace 035 created age ago.
+	version := func(name string, phase otv1alpha1.DataSyncPhase, age time.Duration) *otv1alpha1.DataSync {
+		return &otv1alpha1.DataSync{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "sync-035-" + name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+			},
+			Spec: otv1alpha1.DataSyncSpec{
+				WorkspaceID: "035",
+				Version:     name,
+				VMs:         []otv1alpha1.DataSyncVM{{Name: "disk", URL: "https://mirror.example.com/disk.qcow2", SourceType: otv1alpha1.SourceTypeHTTP}},
+			},
+			Status: otv1alpha1.DataSyncStatus{Phase: phase},
+		}
+	}
+
+	// run prunes once and returns the versions that are left.
+	run := func() []string {
+		c := fake.NewClientBuilder().
+			WithScheme(testScheme).
+			WithStatusSubresource(&otv1alpha1.DataSync{}).
+			WithObjects(objects...).
+			Build()
+		p := &Pruner{Client: c, Reader: c, Recorder: recorder, Policy: store}
+		Expect(p.Prune(ctx, now)).To(Succeed())
+
+		list := &otv1alpha1.DataSyncList{}
+		Expect(c.List(ctx, list)).To(Succeed())
+		var left []string
+		for _, ds := range list.Items {
+			left = append(left, ds.Spec.Version)
+		}
+		return left
+	}
+
+	setPolicy := func(keep int, unusedAfter time.Duration, dryRun bool) {
+		p := policy.Defaults()
+		p.PruneKeepVersions = keep
+		p.PruneUnusedAfter = unusedAfter
+		p.PruneDryRun = dryRun
+		store.Set(p)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		now = time.Now().Truncate(time.Second)
+		store = policy.NewStore()
+		recorder = record.NewFakeRecorder(100)
+		objects = []client.Object{
+			version("v1", otv1alpha1.DataSyncPhaseSucceeded, 40*24*time.Hour),
+			version("v2", otv1alpha1.DataSyncPhaseFailed, 30*24*time.Hour),
+			version("v3", otv1alpha1.DataSyncPhaseSucceeded, 20*24*time.Hour),
+			version("v4", otv1alpha1.DataSyncPhaseSucceeded, 10*24*time.Hour),
+			version("v5", otv1alpha1.DataSyncPhaseSyncing, time.Hour),
+		}
+	})
+
+	It("should keep the newest ready versions", func() {
+		setPolicy(2, 0, false)
+		Expect(run()).To(ConsistOf("v3", "v4", "v5"))
+		Expect(recorder.Events).To(HaveLen(2))
+		Expect(recorder.Events).To(Receive(Equal(
+			"Normal Pruned Pruned: version v2 of workspace 035 is not among the 2 newest ready versions of workspace 035")))
+	})
+
+	It("should keep failed versions newer than the ready versions to keep", func() {
+		setPolicy(2, 0, false)
+		objects = append(objects, version("v6", otv1alpha1.DataSyncPhaseFailed, time.Minute))
+		Expect(run()).To(ConsistOf("v3", "v4", "v5", "v6"))
+	})
+
+	It("should only prune versions that break every rule", func() {
+		setPolicy(1, 25*24*time.Hour, false)
+		Expect(run()).To(ConsistOf("v3", "v4", "v5"))
+	})
+
+	It("should never prune a version in use", func() {
+		setPolicy(1, 0, false)
+		objects = append(objects,
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "launcher", Namespace: "default"},
+				Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+					Name: "disk",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "sync-035-v1-disk"},
+					},
+				}}},
+			},
+			virtualMachine("sync-035-v3-disk"),
+		)
+		Expect(run()).To(ConsistOf("v1", "v3", "v4", "v5"))
+	})
+
+	It("should not prune a version that comes into use during the run", func() {
+		setPolicy(1, 0, false)
+		c := fake.NewClientBuilder().
+			WithScheme(testScheme).
+			WithStatusSubresource(&otv1alpha1.DataSync{}).
+			WithObjects(objects...).
+			Build()
+		// A VirtualMachine starts using v1 as soon as the run listed what is in use.
+		started := false
+		reader := interceptor.NewClient(c, interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if err := c.List(ctx, list, opts...); err != nil {
+					return err
+				}
+				if u, ok := list.(*unstructured.UnstructuredList); ok && !started &&
+					u.GroupVersionKind().Kind == kubevirt.VirtualMachineInstanceGVK.Kind+"List" {
+					started = true
+					return c.Create(ctx, virtualMachine("sync-035-v1-disk"))
+				}
+				return nil
+			},
+		})
+		p := &Pruner{Client: c, Reader: reader, Recorder: recorder, Policy: store}
+		Expect(p.Prune(ctx, now)).To(Succeed())
+
+		ds := &otv1alpha1.DataSync{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sync-035-v1"}, ds)).To(Succeed())
+		Expect(ds.Status.LastUsedTime).NotTo(BeNil())
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sync-035-v2"}, ds)).NotTo(Succeed())
+	})
+
+	It("should remember when a version was last used", func() {
+		setPolicy(0, 7*24*time.Hour, false)
+		objects = append(objects, virtualMachine("sync-035-v1-disk"))
+		Expect(run()).To(ConsistOf("v1", "v5"))
+
+		// Once the VM is gone the version is kept until it was unused for long enough.
+		ds := objects[0].(*otv1alpha1.DataSync)
+		ds.Status.LastUsedTime = &metav1.Time{Time: now.Add(-time.Hour)}
+		objects = objects[:1]
+		Expect(run()).To(ConsistOf("v1"))
+	})
+
+	It("should apply a new prune interval right away", func() {
+		pol := policy.Defaults()
+		pol.PruneUnusedAfter = 365 * 24 * time.Hour
+		store.Set(pol)
+		c := fake.NewClientBuilder().
+			WithScheme(testScheme).
+			WithStatusSubresource(&otv1alpha1.DataSync{}).
+			WithObjects(objects...).
+			Build()
+		ran := make(chan struct{}, 1)
+		reader := interceptor.NewClient(c, interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if _, ok := list.(*otv1alpha1.DataSyncList); ok {
+					select {
+					case ran <- struct{}{}:
+					default:
+					}
+				}
+				return c.List(ctx, list, opts...)
+			},
+		})
+		p := &Pruner{Client: c, Reader: reader, Recorder: recorder, Policy: store}
+		runCtx, cancel := context.WithCancel(ctx)
+		DeferCleanup(cancel)
+		go func() {
+			defer GinkgoRecover()
+			Expect(p.Start(runCtx)).To(Succeed())
+		}()
+		Eventually(ran).Should(Receive())
+
+		// Under the first policy the next run is an hour away.
+		pol.PruneKeepVersions = 2
+		pol.PruneUnusedAfter = 0
+		pol.PruneInterval = 10 * time.Millisecond
+		store.Set(pol)
+		Eventually(func() error {
+			return c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sync-035-v1"}, &otv1alpha1.DataSync{})
+		}).Should(Satisfy(apierrors.IsNotFound))
+	})
+
+	It("should only report candidates in dry-run mode", func() {
+		setPolicy(2, 0, true)
+		Expect(run()).To(HaveLen(5))
+		Expect(recorder.Events).To(Receive(ContainSubstring("PruneCandidate Would prune: version v2")))
+		Expect(recorder.Events).To(Receive(ContainSubstring("PruneCandidate Would prune: version v1")))
+	})
+})
+
+// virtualMachine returns a VirtualMachine booting from the given claim.
+func virtualMachine(claim string) *unstructured.Unstructured {
+	vm := &unstructured.Unstructured{}
+	vm.SetGroupVersionKind(kubevirt.VirtualMachineGVK)
+	vm.SetName("workspace-035")
+	vm.SetNamespace("default")
+	Expect(unstructured.SetNestedSlice(vm.Object, []any{
+		map[string]any{"name": "disk", "dataVolume": map[string]any{"name": claim}},
+	}, "spec", "template", "spec", "volumes")).To(Succeed())
+	return vm
+}
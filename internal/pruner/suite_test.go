@@ -0,0 +1,52 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pruner
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/kubevirt"
+)
+
+var testScheme *runtime.Scheme
+
+func TestPruner(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Pruner Suite")
+}
+
+var _ = BeforeSuite(func() {
+	testScheme = runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+	Expect(otv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+	// KubeVirt objects are only ever handled as unstructured objects.
+	for _, gvk := range []schema.GroupVersionKind{kubevirt.VirtualMachineGVK, kubevirt.VirtualMachineInstanceGVK} {
+		testScheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		testScheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
+})
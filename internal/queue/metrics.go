@@ -0,0 +1,46 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// activeSyncs is the number of DataSyncs holding a slot in the admission queue.
+	activeSyncs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ot_sync_queue_active",
+		Help: "Number of DataSyncs currently admitted by the global queue.",
+	})
+
+	// waitingSyncs is the number of DataSyncs waiting for a slot.
+	waitingSyncs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ot_sync_queue_waiting",
+		Help: "Number of DataSyncs waiting in the global queue.",
+	})
+
+	// bytesInFlight is the estimated number of bytes the admitted DataSyncs download.
+	bytesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ot_sync_queue_bytes_in_flight",
+		Help: "Estimated number of bytes downloaded by the DataSyncs currently admitted by the global queue.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(activeSyncs, waitingSyncs, bytesInFlight)
+}
@@ -0,0 +1,586 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package queue implements the single global admission queue that decides
+// which DataSyncs may sync, so the number of active syncs never exceeds the
+// concurrency limit of the sync policy.
+package queue
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/policy"
+)
+
+// eventBuffer bounds the number of wake-ups waiting to be picked up by the
+// controller. Wake-ups that do not fit are dropped; queued DataSyncs are
+// periodically requeued so nothing is lost.
+const eventBuffer = 1024
+
+// Decision is the outcome of asking the queue to admit a DataSync.
+type Decision struct {
+	// Admitted is true when the DataSync holds a slot and may sync.
+	Admitted bool
+	// Position is the zero based position of a waiting DataSync in the queue.
+	Position int
+	// Reason explains why a DataSync is still waiting.
+	Reason string
+}
+
+// waiter is a DataSync waiting for a slot.
+type waiter struct {
+	key      types.NamespacedName
+	enqueued time.Time
+	// bytes is the estimated number of bytes the DataSync downloads.
+	bytes int64
+	// onDemand puts the waiter in the priority lane, ahead of every waiter
+	// that is only being preloaded.
+	onDemand bool
+	// priority orders waiters within a lane; higher priorities go first.
+	priority int
+	// tenant is the namespace, or the value of the tenant label of the
+	// policy, the DataSync is accounted to for quotas and fair sharing.
+	tenant string
+}
+
+// before reports whether w is more urgent than o: the on-demand lane first,
+// then higher priorities.
+func (w waiter) before(o waiter) bool {
+	if w.onDemand != o.onDemand {
+		return w.onDemand
+	}
+	return w.priority > o.priority
+}
+
+// Queue is the global admission queue. DataSyncs a launched workspace is
+// waiting on go first, then DataSyncs are admitted by priority. Within a
+// priority, tenants share the slots by weight and the DataSyncs of a tenant
+// are admitted in FIFO order. Every reconcile of a queued
+// DataSync asks the queue for a slot; all bookkeeping happens under a single
+// lock so parallel reconciles can never admit more DataSyncs than the policy
+// allows.
+//
+// The queue is rebuilt from DataSync status the first time it is used after
+// the operator becomes leader, so a new leader picks up exactly the syncs the
+// previous one had admitted.
+type Queue struct {
+	reader client.Reader
+	policy *policy.Store
+	events chan event.GenericEvent
+
+	mu     sync.Mutex
+	synced bool
+	// tenantLabel is the tenant label the state was built with. The tenants
+	// are looked up again on the next use of the queue once it changed.
+	tenantLabel string
+	// active holds the DataSyncs holding a slot.
+	active  map[types.NamespacedName]waiter
+	waiting []waiter
+	// victims maps active DataSyncs that must make way to the DataSync that
+	// preempts them.
+	victims map[types.NamespacedName]types.NamespacedName
+}
+
+// New returns a Queue that rebuilds its state through reader and enforces the
+// concurrency of the policy in store. The reader should not be cached so the
+// rebuild sees the latest status written by a previous leader.
+func New(reader client.Reader, store *policy.Store) *Queue {
+	q := &Queue{
+		reader:  reader,
+		policy:  store,
+		events:  make(chan event.GenericEvent, eventBuffer),
+		active:  map[types.NamespacedName]waiter{},
+		victims: map[types.NamespacedName]types.NamespacedName{},
+	}
+	store.Subscribe(q.policyChanged)
+	return q
+}
+
+// policyChanged wakes the waiters a new policy may admit. When the tenant
+// label changed, the tenants of the queued DataSyncs are stale; they are
+// looked up again on the next use of the queue.
+func (q *Queue) policyChanged(_ policy.Policy) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.wakeLocked()
+}
+
+// Source returns a source that triggers a reconcile of every DataSync the
+// queue wants to revisit, e.g. the next waiter once a slot is released.
+func (q *Queue) Source() source.Source {
+	return source.Channel(q.events, &handler.EnqueueRequestForObject{})
+}
+
+// Start rebuilds the queue when the operator becomes leader, unless a
+// reconcile already did so, and drops its state when leadership is lost.
+func (q *Queue) Start(ctx context.Context) error {
+	q.mu.Lock()
+	var err error
+	if !q.synced {
+		err = q.rebuild(ctx)
+	}
+	q.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+
+	q.mu.Lock()
+	q.synced = false
+	q.mu.Unlock()
+	return nil
+}
+
+// NeedLeaderElection ensures only the leader owns the queue.
+func (q *Queue) NeedLeaderElection() bool {
+	return true
+}
+
+// Admit asks for a slot for ds. A DataSync that already holds a slot is
+// always admitted again, so callers may retry freely after a failed status
+// update.
+//
+// Besides the concurrency limit, the policy may cap the bytes in flight. A
+// DataSync is then only admitted when its estimated bytes, added to those of
+// the active DataSyncs and of every waiter ahead of it, fit the budget. A
+// DataSync larger than the whole budget is admitted once nothing else syncs.
+//
+// The policy may also cap the number of DataSyncs each tenant has syncing. A
+// DataSync whose tenant is at its quota lets DataSyncs of other tenants
+// overtake it.
+//
+// When the policy enables preemption, the DataSync at the head of the queue
+// marks the least urgent active DataSync that is less urgent than itself as
+// a victim and waits for it to make way; see PreemptedBy.
+func (q *Queue) Admit(ctx context.Context, ds *otv1alpha1.DataSync) (Decision, error) {
+	key := client.ObjectKeyFromObject(ds)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.synced {
+		if err := q.rebuild(ctx); err != nil {
+			return Decision{}, err
+		}
+	} else if q.tenantLabel != q.policy.Get().TenantLabel {
+		if err := q.retenant(ctx); err != nil {
+			return Decision{}, err
+		}
+	}
+
+	if _, ok := q.active[key]; ok {
+		return Decision{Admitted: true}, nil
+	}
+
+	q.enqueue(q.waiterFor(ds))
+	if !q.policy.Loaded() {
+		return Decision{Position: q.position(key), Reason: "Waiting for the sync policy to load."}, nil
+	}
+
+	order, capped := q.plan()
+	if reason, ok := capped[key]; ok {
+		return Decision{Position: q.position(key), Reason: reason}, nil
+	}
+	position := slices.IndexFunc(order, func(w waiter) bool { return w.key == key })
+	if reason := q.blocked(order, position); reason != "" {
+		if victim, ok := q.preemptFor(order, position); ok {
+			reason = fmt.Sprintf("Request is preempting %s.", victim)
+		}
+		return Decision{Position: position, Reason: reason}, nil
+	}
+
+	w := order[position]
+	q.remove(key)
+	q.active[key] = w
+	q.observe()
+	return Decision{Admitted: true}, nil
+}
+
+// plan returns the waiters in the order they are admitted: by urgency and,
+// among waiters of the same urgency, from the tenant with the smallest share
+// of the slots relative to its weight, oldest first within a tenant.
+//
+// Waiters whose tenant has used up its quota with the active DataSyncs and
+// those about to be admitted to the free slots are left out of the order and
+// returned with the reason they wait instead. The caller must hold the lock.
+func (q *Queue) plan() ([]waiter, map[types.NamespacedName]string) {
+	p := q.policy.Get()
+	free := p.Concurrency - len(q.active)
+	// used counts the slots each tenant holds for its quota; share counts
+	// them for fair sharing, including waiters that will only be admitted
+	// once more slots free up.
+	used, share := map[string]int{}, map[string]int{}
+	for _, w := range q.active {
+		used[w.tenant]++
+		share[w.tenant]++
+	}
+
+	order := make([]waiter, 0, len(q.waiting))
+	capped := map[types.NamespacedName]string{}
+	rest := slices.Clone(q.waiting)
+	for len(rest) > 0 {
+		rest = slices.DeleteFunc(rest, func(w waiter) bool {
+			quota := p.Quota(w.tenant)
+			if quota == 0 || used[w.tenant] < quota {
+				return false
+			}
+			capped[w.key] = fmt.Sprintf("Request is waiting: %s quota %d/%d in use.",
+				tenantScope(p, w.tenant), used[w.tenant], quota)
+			return true
+		})
+		if len(rest) == 0 {
+			break
+		}
+
+		// rest is ordered by urgency, so the waiters as urgent as the head
+		// form a prefix; pick the one of the least served tenant.
+		best := 0
+		for i := 1; i < len(rest) && !rest[0].before(rest[i]); i++ {
+			a, b := rest[i].tenant, rest[best].tenant
+			if share[a]*p.Weight(b) < share[b]*p.Weight(a) {
+				best = i
+			}
+		}
+		w := rest[best]
+		rest = slices.Delete(rest, best, best+1)
+		if len(order) < free {
+			used[w.tenant]++
+		}
+		share[w.tenant]++
+		order = append(order, w)
+	}
+	return order, capped
+}
+
+// tenantScope describes the quota of tenant in status messages.
+func tenantScope(p policy.Policy, tenant string) string {
+	if p.TenantLabel == "" {
+		return "namespace"
+	}
+	return fmt.Sprintf("%s %q", p.TenantLabel, tenant)
+}
+
+// blocked returns why the waiter at position in order cannot be admitted, or
+// "" if it can. The caller must hold the lock.
+func (q *Queue) blocked(order []waiter, position int) string {
+	p := q.policy.Get()
+	free := p.Concurrency - len(q.active)
+	if position >= free {
+		return fmt.Sprintf("Request is waiting for an available worker (%d active, position %d in queue).",
+			len(q.active), position+1)
+	}
+
+	if p.MaxBytesInFlight > 0 {
+		inFlight := q.bytesInFlight()
+		needed := int64(0)
+		for _, w := range order[:position+1] {
+			needed += w.bytes
+		}
+		if inFlight+needed > p.MaxBytesInFlight && (len(q.active) > 0 || position > 0) {
+			return fmt.Sprintf("Request is waiting for bandwidth (%s of %s in flight, %s needed, position %d in queue).",
+				formatBytes(inFlight), formatBytes(p.MaxBytesInFlight), formatBytes(order[position].bytes), position+1)
+		}
+	}
+	return ""
+}
+
+// preemptFor marks an active DataSync as victim of the waiter at the head of
+// order, if the policy enables preemption and a less urgent DataSync is
+// active. Only one victim is marked per preemptor at a time; once it made way
+// the preemptor asks again. The caller must hold the lock.
+func (q *Queue) preemptFor(order []waiter, position int) (types.NamespacedName, bool) {
+	if position != 0 || q.policy.Get().Preemption == policy.PreemptionNone {
+		return types.NamespacedName{}, false
+	}
+	preemptor := order[0]
+	for victim, by := range q.victims {
+		if by == preemptor.key {
+			return victim, true
+		}
+	}
+
+	var victim *waiter
+	for key, w := range q.active {
+		if _, ok := q.victims[key]; ok || !preemptor.before(w) {
+			continue
+		}
+		if victim == nil || victim.before(w) || (!w.before(*victim) && w.enqueued.After(victim.enqueued)) {
+			victim = &w
+		}
+	}
+	if victim == nil {
+		return types.NamespacedName{}, false
+	}
+
+	q.victims[victim.key] = preemptor.key
+	q.send(victim.key)
+	return victim.key, true
+}
+
+// PreemptedBy returns the DataSync key must make way for, if it was chosen as
+// a victim. The victim is expected to stop syncing and Release its slot.
+func (q *Queue) PreemptedBy(key types.NamespacedName) (types.NamespacedName, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	by, ok := q.victims[key]
+	return by, ok
+}
+
+// Release frees the slot held by key, if any, and wakes the next waiters.
+func (q *Queue) Release(key types.NamespacedName) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.active[key]; !ok {
+		return
+	}
+	delete(q.active, key)
+	delete(q.victims, key)
+	q.observe()
+	q.wakeLocked()
+}
+
+// Withdraw takes key out of the waiting list while it may not sync for a
+// reason outside the queue, so it does not hold up the waiters behind it. It
+// joins the queue again on its next call to Admit.
+func (q *Queue) Withdraw(key types.NamespacedName) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.position(key) < 0 {
+		return
+	}
+	q.remove(key)
+	q.observe()
+	q.wakeLocked()
+}
+
+// Forget removes every trace of key from the queue, e.g. once its DataSync is deleted.
+func (q *Queue) Forget(key types.NamespacedName) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.remove(key)
+	delete(q.victims, key)
+	for victim, by := range q.victims {
+		if by == key {
+			delete(q.victims, victim)
+		}
+	}
+	if _, ok := q.active[key]; ok {
+		delete(q.active, key)
+		q.wakeLocked()
+	}
+	q.observe()
+}
+
+// bytesInFlight returns the estimated bytes of the active DataSyncs. The
+// caller must hold the lock.
+func (q *Queue) bytesInFlight() int64 {
+	var total int64
+	for _, w := range q.active {
+		total += w.bytes
+	}
+	return total
+}
+
+// Active returns the number of DataSyncs currently holding a slot.
+func (q *Queue) Active() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.active)
+}
+
+// rebuild replaces the in-memory state with the one recorded in DataSync
+// status: Syncing DataSyncs hold a slot and Queued ones that are not backing
+// off wait in creation order. The caller must hold the lock.
+func (q *Queue) rebuild(ctx context.Context) error {
+	list := &otv1alpha1.DataSyncList{}
+	if err := q.reader.List(ctx, list); err != nil {
+		return fmt.Errorf("rebuilding admission queue: %w", err)
+	}
+
+	now := time.Now()
+	q.active = map[types.NamespacedName]waiter{}
+	q.victims = map[types.NamespacedName]types.NamespacedName{}
+	q.waiting = nil
+	for i := range list.Items {
+		ds := &list.Items[i]
+		if !ds.DeletionTimestamp.IsZero() {
+			continue
+		}
+		// DataSyncs backing off after a failure join the queue once their retry is due.
+		if ds.Status.NextRetryTime != nil && now.Before(ds.Status.NextRetryTime.Time) {
+			continue
+		}
+		w := q.waiterFor(ds)
+		switch ds.Status.Phase {
+		case otv1alpha1.DataSyncPhaseSyncing:
+			q.active[w.key] = w
+		case "", otv1alpha1.DataSyncPhaseQueued:
+			q.enqueue(w)
+		}
+	}
+	q.synced = true
+	q.tenantLabel = q.policy.Get().TenantLabel
+	q.observe()
+
+	logf.FromContext(ctx).Info("rebuilt admission queue", "active", len(q.active), "waiting", len(q.waiting))
+	return nil
+}
+
+// retenant looks up the tenants of the queued DataSyncs again after the
+// tenant label of the policy changed. The slots are kept as they are: a
+// DataSync admitted in memory may not have recorded that it syncs yet, so
+// rebuilding them from status could hand its slot to another DataSync. The
+// caller must hold the lock.
+func (q *Queue) retenant(ctx context.Context) error {
+	list := &otv1alpha1.DataSyncList{}
+	if err := q.reader.List(ctx, list); err != nil {
+		return fmt.Errorf("looking up the tenants of the admission queue: %w", err)
+	}
+
+	p := q.policy.Get()
+	for i := range list.Items {
+		ds := &list.Items[i]
+		key := client.ObjectKeyFromObject(ds)
+		if w, ok := q.active[key]; ok {
+			w.tenant = tenantOf(p, ds)
+			q.active[key] = w
+		}
+		if j := q.position(key); j >= 0 {
+			q.waiting[j].tenant = tenantOf(p, ds)
+		}
+	}
+	q.tenantLabel = p.TenantLabel
+
+	logf.FromContext(ctx).Info("looked up the tenants of the admission queue", "tenantLabel", p.TenantLabel)
+	return nil
+}
+
+// tenantOf returns the tenant ds is accounted to: its namespace, or the value
+// of the tenant label of p.
+func tenantOf(p policy.Policy, ds *otv1alpha1.DataSync) string {
+	if p.TenantLabel != "" {
+		return ds.Labels[p.TenantLabel]
+	}
+	return ds.Namespace
+}
+
+// waiterFor returns the waiter for ds. DataSyncs annotated as on-demand wait
+// in the priority lane; the priority and tenant come from the policy.
+func (q *Queue) waiterFor(ds *otv1alpha1.DataSync) waiter {
+	p := q.policy.Get()
+	priority, _ := p.Priority(ds.Spec.PriorityClassName)
+	return waiter{
+		key:      client.ObjectKeyFromObject(ds),
+		enqueued: ds.CreationTimestamp.Time,
+		bytes:    ds.Status.EstimatedBytes,
+		onDemand: ds.Annotations[otv1alpha1.AnnotationOnDemand] == "true",
+		priority: priority,
+		tenant:   tenantOf(p, ds),
+	}
+}
+
+// enqueue adds w to the waiting list, or updates it if it is already
+// waiting, keeping the list ordered by urgency and then creation time. The
+// caller must hold the lock.
+func (q *Queue) enqueue(w waiter) {
+	if i := q.position(w.key); i >= 0 {
+		if q.waiting[i] == w {
+			return
+		}
+		q.waiting[i] = w
+	} else {
+		q.waiting = append(q.waiting, w)
+	}
+	sort.SliceStable(q.waiting, func(i, j int) bool {
+		a, b := q.waiting[i], q.waiting[j]
+		if a.before(b) || b.before(a) {
+			return a.before(b)
+		}
+		if !a.enqueued.Equal(b.enqueued) {
+			return a.enqueued.Before(b.enqueued)
+		}
+		return a.key.String() < b.key.String()
+	})
+	q.observe()
+}
+
+// position returns the index of key in the waiting list or -1. The caller must hold the lock.
+func (q *Queue) position(key types.NamespacedName) int {
+	for i, w := range q.waiting {
+		if w.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// remove drops key from the waiting list. The caller must hold the lock.
+func (q *Queue) remove(key types.NamespacedName) {
+	if i := q.position(key); i >= 0 {
+		q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+	}
+}
+
+// wakeLocked triggers a reconcile of the waiters that could be admitted now.
+// The caller must hold the lock.
+func (q *Queue) wakeLocked() {
+	free := q.policy.Get().Concurrency - len(q.active)
+	order, _ := q.plan()
+	for i := 0; i < free && i < len(order); i++ {
+		q.send(order[i].key)
+	}
+}
+
+// send triggers a reconcile of key, dropping the wake-up if the buffer is full.
+func (q *Queue) send(key types.NamespacedName) {
+	ds := &otv1alpha1.DataSync{}
+	ds.SetName(key.Name)
+	ds.SetNamespace(key.Namespace)
+	select {
+	case q.events <- event.GenericEvent{Object: ds}:
+	default:
+	}
+}
+
+// observe publishes the size of the queue. The caller must hold the lock.
+func (q *Queue) observe() {
+	activeSyncs.Set(float64(len(q.active)))
+	waitingSyncs.Set(float64(len(q.waiting)))
+	bytesInFlight.Set(float64(q.bytesInFlight()))
+}
+
+// formatBytes renders a number of bytes for status messages, e.g. "120Gi".
+func formatBytes(bytes int64) string {
+	return resource.NewQuantity(bytes, resource.BinarySI).String()
+}
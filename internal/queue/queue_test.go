@@ -0,0 +1,368 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/policy"
+)
+
+var _ = Describe("Queue", func() {
+	var (
+		ctx   context.Context
+		store *policy.Store
+		epoch = time.Date(2025, 7, 11, 20, 0, 0, 0, time.UTC)
+	)
+
+	newDataSync := func(name string, age int, phase otv1alpha1.DataSyncPhase) *otv1alpha1.DataSync {
+		return &otv1alpha1.DataSync{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(epoch.Add(time.Duration(age) * time.Minute)),
+			},
+			Status: otv1alpha1.DataSyncStatus{Phase: phase},
+		}
+	}
+
+	newQueue := func(objs ...client.Object) *Queue {
+		s := runtime.NewScheme()
+		Expect(otv1alpha1.AddToScheme(s)).To(Succeed())
+		reader := fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+		return New(reader, store)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		store = policy.NewStore()
+		p := policy.Defaults()
+		p.Concurrency = 2
+		store.Set(p)
+	})
+
+	It("should admit in FIFO order up to the concurrency limit", func() {
+		first := newDataSync("first", 0, otv1alpha1.DataSyncPhaseQueued)
+		second := newDataSync("second", 1, otv1alpha1.DataSyncPhaseQueued)
+		third := newDataSync("third", 2, otv1alpha1.DataSyncPhaseQueued)
+		q := newQueue(first, second, third)
+
+		// The newest request asks first but must wait behind the older ones.
+		d, err := q.Admit(ctx, third)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Admitted).To(BeFalse())
+		Expect(d.Position).To(Equal(2))
+
+		for _, ds := range []*otv1alpha1.DataSync{first, second} {
+			d, err = q.Admit(ctx, ds)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(d.Admitted).To(BeTrue())
+		}
+		d, _ = q.Admit(ctx, third)
+		Expect(d.Admitted).To(BeFalse())
+
+		q.Release(client.ObjectKeyFromObject(first))
+		d, _ = q.Admit(ctx, third)
+		Expect(d.Admitted).To(BeTrue())
+	})
+
+	It("should admit on-demand DataSyncs ahead of preloads", func() {
+		first := newDataSync("first", 0, otv1alpha1.DataSyncPhaseQueued)
+		second := newDataSync("second", 1, otv1alpha1.DataSyncPhaseQueued)
+		third := newDataSync("third", 2, otv1alpha1.DataSyncPhaseQueued)
+		fourth := newDataSync("fourth", 3, otv1alpha1.DataSyncPhaseQueued)
+		fourth.Annotations = map[string]string{otv1alpha1.AnnotationOnDemand: "true"}
+		q := newQueue(first, second, third, fourth)
+
+		d, err := q.Admit(ctx, third)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Position).To(Equal(3))
+
+		// A launch promotes a DataSync that was already waiting.
+		third.Annotations = map[string]string{otv1alpha1.AnnotationOnDemand: "true"}
+		d, _ = q.Admit(ctx, third)
+		Expect(d.Admitted).To(BeTrue())
+		d, _ = q.Admit(ctx, fourth)
+		Expect(d.Admitted).To(BeTrue())
+		d, _ = q.Admit(ctx, first)
+		Expect(d.Admitted).To(BeFalse())
+		Expect(d.Position).To(BeZero())
+	})
+
+	It("should admit by priority, then age", func() {
+		p := policy.Defaults()
+		p.Concurrency = 1
+		p.PriorityClasses = map[string]int{"release-day": 100, "nightly": -10}
+		store.Set(p)
+		nightly := newDataSync("nightly", 0, otv1alpha1.DataSyncPhaseQueued)
+		nightly.Spec.PriorityClassName = "nightly"
+		plain := newDataSync("plain", 1, otv1alpha1.DataSyncPhaseQueued)
+		release := newDataSync("release", 2, otv1alpha1.DataSyncPhaseQueued)
+		release.Spec.PriorityClassName = "release-day"
+		q := newQueue(nightly, plain, release)
+
+		d, err := q.Admit(ctx, nightly)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Position).To(Equal(2))
+		d, _ = q.Admit(ctx, plain)
+		Expect(d.Position).To(Equal(1))
+		d, _ = q.Admit(ctx, release)
+		Expect(d.Admitted).To(BeTrue())
+	})
+
+	It("should preempt the least urgent active DataSync when enabled", func() {
+		p := policy.Defaults()
+		p.Concurrency = 2
+		p.PriorityClasses = map[string]int{"release-day": 100, "nightly": -10}
+		p.Preemption = policy.PreemptionPause
+		store.Set(p)
+		nightly := newDataSync("nightly", 0, otv1alpha1.DataSyncPhaseSyncing)
+		nightly.Spec.PriorityClassName = "nightly"
+		plain := newDataSync("plain", 1, otv1alpha1.DataSyncPhaseSyncing)
+		release := newDataSync("release", 2, otv1alpha1.DataSyncPhaseQueued)
+		release.Spec.PriorityClassName = "release-day"
+		q := newQueue(nightly, plain, release)
+
+		d, err := q.Admit(ctx, release)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Admitted).To(BeFalse())
+		Expect(d.Reason).To(Equal("Request is preempting default/nightly."))
+		by, ok := q.PreemptedBy(client.ObjectKeyFromObject(nightly))
+		Expect(ok).To(BeTrue())
+		Expect(by).To(Equal(client.ObjectKeyFromObject(release)))
+		_, ok = q.PreemptedBy(client.ObjectKeyFromObject(plain))
+		Expect(ok).To(BeFalse())
+
+		// Asking again does not pick a second victim.
+		d, _ = q.Admit(ctx, release)
+		Expect(d.Reason).To(Equal("Request is preempting default/nightly."))
+
+		q.Release(client.ObjectKeyFromObject(nightly))
+		d, _ = q.Admit(ctx, release)
+		Expect(d.Admitted).To(BeTrue())
+		_, ok = q.PreemptedBy(client.ObjectKeyFromObject(nightly))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should cap the bytes in flight", func() {
+		p := policy.Defaults()
+		p.Concurrency = 10
+		p.MaxBytesInFlight = 100
+		store.Set(p)
+		large := newDataSync("large", 0, otv1alpha1.DataSyncPhaseQueued)
+		large.Status.EstimatedBytes = 150
+		small := newDataSync("small", 1, otv1alpha1.DataSyncPhaseQueued)
+		small.Status.EstimatedBytes = 10
+		q := newQueue(large, small)
+
+		// A DataSync larger than the budget runs alone, and nothing overtakes it.
+		d, err := q.Admit(ctx, small)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Admitted).To(BeFalse())
+		d, _ = q.Admit(ctx, large)
+		Expect(d.Admitted).To(BeTrue())
+		d, _ = q.Admit(ctx, small)
+		Expect(d.Admitted).To(BeFalse())
+		Expect(d.Reason).To(Equal("Request is waiting for bandwidth (150 of 100 in flight, 10 needed, position 1 in queue)."))
+
+		q.Release(client.ObjectKeyFromObject(large))
+		d, _ = q.Admit(ctx, small)
+		Expect(d.Admitted).To(BeTrue())
+	})
+
+	It("should let other namespaces overtake a namespace at its quota", func() {
+		p := policy.Defaults()
+		p.Concurrency = 4
+		p.DefaultTenantQuota = 2
+		store.Set(p)
+		busy := []*otv1alpha1.DataSync{
+			newDataSync("busy-1", 0, otv1alpha1.DataSyncPhaseSyncing),
+			newDataSync("busy-2", 1, otv1alpha1.DataSyncPhaseSyncing),
+			newDataSync("busy-3", 2, otv1alpha1.DataSyncPhaseQueued),
+		}
+		other := newDataSync("other", 3, otv1alpha1.DataSyncPhaseQueued)
+		other.Namespace = "team-b"
+		q := newQueue(busy[0], busy[1], busy[2], other)
+
+		d, err := q.Admit(ctx, busy[2])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Admitted).To(BeFalse())
+		Expect(d.Reason).To(Equal("Request is waiting: namespace quota 2/2 in use."))
+		d, _ = q.Admit(ctx, other)
+		Expect(d.Admitted).To(BeTrue())
+
+		q.Release(client.ObjectKeyFromObject(busy[0]))
+		d, _ = q.Admit(ctx, busy[2])
+		Expect(d.Admitted).To(BeTrue())
+	})
+
+	It("should share slots between tenants by weight", func() {
+		p := policy.Defaults()
+		p.Concurrency = 3
+		p.TenantLabel = "pelotech.ot/team"
+		p.TenantWeights = map[string]int{"red": 2}
+		store.Set(p)
+		team := func(ds *otv1alpha1.DataSync, name string) *otv1alpha1.DataSync {
+			ds.Labels = map[string]string{"pelotech.ot/team": name}
+			return ds
+		}
+		syncs := []*otv1alpha1.DataSync{
+			team(newDataSync("blue-1", 0, otv1alpha1.DataSyncPhaseQueued), "blue"),
+			team(newDataSync("blue-2", 1, otv1alpha1.DataSyncPhaseQueued), "blue"),
+			team(newDataSync("red-1", 2, otv1alpha1.DataSyncPhaseQueued), "red"),
+			team(newDataSync("red-2", 3, otv1alpha1.DataSyncPhaseQueued), "red"),
+		}
+		q := newQueue(syncs[0], syncs[1], syncs[2], syncs[3])
+
+		// Red has twice the weight of blue, so it gets two of the three slots
+		// although blue asked first.
+		var admitted []string
+		for _, ds := range syncs {
+			d, err := q.Admit(ctx, ds)
+			Expect(err).NotTo(HaveOccurred())
+			if d.Admitted {
+				admitted = append(admitted, ds.Name)
+			}
+		}
+		Expect(admitted).To(ConsistOf("blue-1", "red-1", "red-2"))
+
+		p.TenantQuotas = map[string]int{"blue": 1}
+		store.Set(p)
+		d, _ := q.Admit(ctx, syncs[1])
+		Expect(d.Reason).To(Equal(`Request is waiting: pelotech.ot/team "blue" quota 1/1 in use.`))
+	})
+
+	It("should keep the slots of admitted DataSyncs when the tenant label changes", func() {
+		team := func(ds *otv1alpha1.DataSync, name string) *otv1alpha1.DataSync {
+			ds.Labels = map[string]string{"pelotech.ot/team": name}
+			return ds
+		}
+		first := team(newDataSync("first", 0, otv1alpha1.DataSyncPhaseQueued), "blue")
+		second := team(newDataSync("second", 1, otv1alpha1.DataSyncPhaseQueued), "blue")
+		third := team(newDataSync("third", 2, otv1alpha1.DataSyncPhaseQueued), "red")
+		q := newQueue(first, second, third)
+		for _, ds := range []*otv1alpha1.DataSync{first, second} {
+			d, err := q.Admit(ctx, ds)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(d.Admitted).To(BeTrue())
+		}
+
+		// Neither admitted DataSync has recorded Syncing yet.
+		p := policy.Defaults()
+		p.Concurrency = 3
+		p.TenantLabel = "pelotech.ot/team"
+		p.TenantQuotas = map[string]int{"blue": 2}
+		store.Set(p)
+		Expect(q.Active()).To(Equal(2))
+		d, err := q.Admit(ctx, team(newDataSync("fourth", 3, otv1alpha1.DataSyncPhaseQueued), "blue"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Reason).To(Equal(`Request is waiting: pelotech.ot/team "blue" quota 2/2 in use.`))
+		d, _ = q.Admit(ctx, third)
+		Expect(d.Admitted).To(BeTrue())
+		Expect(q.Active()).To(Equal(3))
+	})
+
+	It("should not let withdrawn DataSyncs hold up the queue", func() {
+		p := policy.Defaults()
+		p.Concurrency = 1
+		store.Set(p)
+		first := newDataSync("first", 0, otv1alpha1.DataSyncPhaseQueued)
+		second := newDataSync("second", 1, otv1alpha1.DataSyncPhaseQueued)
+		q := newQueue(first, second)
+
+		d, err := q.Admit(ctx, second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Position).To(Equal(1))
+		q.Withdraw(client.ObjectKeyFromObject(first))
+		d, _ = q.Admit(ctx, second)
+		Expect(d.Admitted).To(BeTrue())
+	})
+
+	It("should rebuild active slots from DataSync status", func() {
+		q := newQueue(
+			newDataSync("running-a", 0, otv1alpha1.DataSyncPhaseSyncing),
+			newDataSync("running-b", 1, otv1alpha1.DataSyncPhaseSyncing),
+			newDataSync("done", 2, otv1alpha1.DataSyncPhaseSucceeded),
+		)
+		d, err := q.Admit(ctx, newDataSync("new", 3, otv1alpha1.DataSyncPhaseQueued))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Admitted).To(BeFalse())
+		Expect(q.Active()).To(Equal(2))
+	})
+
+	It("should wait until the policy is loaded", func() {
+		store = policy.NewStore()
+		q := newQueue()
+		d, err := q.Admit(ctx, newDataSync("early", 0, otv1alpha1.DataSyncPhaseQueued))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Admitted).To(BeFalse())
+	})
+
+	It("should never over-admit under parallel reconciles", func() {
+		const syncs = 200
+		objs := make([]client.Object, 0, syncs)
+		for i := range syncs {
+			objs = append(objs, newDataSync(fmt.Sprintf("ds-%03d", i), i, otv1alpha1.DataSyncPhaseQueued))
+		}
+		q := newQueue(objs...)
+
+		var peak, current atomic.Int32
+		var wg sync.WaitGroup
+		for _, obj := range objs {
+			wg.Add(1)
+			go func(ds *otv1alpha1.DataSync) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for {
+					d, err := q.Admit(ctx, ds)
+					Expect(err).NotTo(HaveOccurred())
+					if d.Admitted {
+						break
+					}
+					time.Sleep(time.Millisecond)
+				}
+				n := current.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				current.Add(-1)
+				q.Release(client.ObjectKeyFromObject(ds))
+			}(obj.(*otv1alpha1.DataSync))
+		}
+		wg.Wait()
+
+		Expect(peak.Load()).To(BeNumerically("<=", 2))
+		Expect(q.Active()).To(BeZero())
+	})
+})
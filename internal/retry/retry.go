@@ -0,0 +1,111 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package retry decides when a failed DataSync may be retried.
+package retry
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// maxBackoff caps the exponential backoff so a DataSync is retried at least once a day.
+	maxBackoff = 24 * time.Hour
+	// jitterFactor spreads retries so syncs that failed together do not retry together.
+	jitterFactor = 0.2
+)
+
+// Backoff returns how long to wait before the retry that follows the given
+// failed attempt. The wait doubles with every attempt starting at base, is
+// capped at a day and is jittered by up to 20%.
+func Backoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return wait.Jitter(d, jitterFactor)
+}
+
+// Budget is a cluster-wide sliding window that limits how many retries may
+// start in a given period, so a bad upstream cannot turn every DataSync into
+// a retry loop at the same time. The window lives in memory and starts empty
+// whenever the operator restarts.
+type Budget struct {
+	mu      sync.Mutex
+	retries []charge
+}
+
+// charge is a retry recorded in the window of a Budget.
+type charge struct {
+	key string
+	at  time.Time
+}
+
+// NewBudget returns an empty Budget.
+func NewBudget() *Budget {
+	return &Budget{}
+}
+
+// TryAcquire records the retry identified by key at now if fewer than limit
+// retries started in the preceding window. A retry already recorded in the
+// window is not charged again, so starting it may be attempted until it
+// succeeds. A limit of zero disables the budget. When the budget is exhausted
+// it returns false and the time at which a retry frees up.
+func (b *Budget) TryAcquire(key string, now time.Time, limit int, window time.Duration) (bool, time.Time) {
+	if limit <= 0 {
+		return true, time.Time{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire(now, window)
+	for _, c := range b.retries {
+		if c.key == key {
+			return true, time.Time{}
+		}
+	}
+	if len(b.retries) >= limit {
+		return false, b.retries[0].at.Add(window)
+	}
+	b.retries = append(b.retries, charge{key: key, at: now})
+	return true, time.Time{}
+}
+
+// Used returns the number of retries started in the window ending at now.
+func (b *Budget) Used(now time.Time, window time.Duration) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire(now, window)
+	return len(b.retries)
+}
+
+// expire drops retries that fell out of the window. The caller must hold the lock.
+func (b *Budget) expire(now time.Time, window time.Duration) {
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(b.retries) && !b.retries[i].at.After(cutoff) {
+		i++
+	}
+	b.retries = b.retries[i:]
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backoff", func() {
+	It("should double with every attempt and stay within the jitter", func() {
+		for attempt, want := range map[int]time.Duration{
+			1: 5 * time.Minute,
+			2: 10 * time.Minute,
+			4: 40 * time.Minute,
+		} {
+			d := Backoff(5*time.Minute, attempt)
+			Expect(d).To(BeNumerically(">=", want))
+			Expect(d).To(BeNumerically("<=", want+want/5))
+		}
+	})
+
+	It("should be capped at a day", func() {
+		Expect(Backoff(time.Hour, 40)).To(BeNumerically("<=", maxBackoff+maxBackoff/5))
+	})
+})
+
+var _ = Describe("Budget", func() {
+	It("should allow at most limit retries per window", func() {
+		b := NewBudget()
+		now := time.Date(2025, 7, 11, 20, 0, 0, 0, time.UTC)
+
+		for i := range 3 {
+			ok, _ := b.TryAcquire(fmt.Sprint(i), now, 3, time.Hour)
+			Expect(ok).To(BeTrue())
+		}
+		ok, freeAt := b.TryAcquire("3", now.Add(time.Minute), 3, time.Hour)
+		Expect(ok).To(BeFalse())
+		Expect(freeAt).To(Equal(now.Add(time.Hour)))
+
+		ok, _ = b.TryAcquire("3", now.Add(time.Hour+time.Second), 3, time.Hour)
+		Expect(ok).To(BeTrue())
+		Expect(b.Used(now.Add(time.Hour+time.Second), time.Hour)).To(Equal(1))
+	})
+
+	It("should charge a retry once however often it is acquired", func() {
+		b := NewBudget()
+		now := time.Date(2025, 7, 11, 20, 0, 0, 0, time.UTC)
+
+		for range 3 {
+			ok, _ := b.TryAcquire("default/sync-workspace-035#2", now, 1, time.Hour)
+			Expect(ok).To(BeTrue())
+		}
+		Expect(b.Used(now, time.Hour)).To(Equal(1))
+		ok, _ := b.TryAcquire("default/sync-workspace-036#2", now, 1, time.Hour)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should not limit retries when the budget is disabled", func() {
+		b := NewBudget()
+		for i := range 100 {
+			ok, _ := b.TryAcquire(fmt.Sprint(i), time.Now(), 0, time.Hour)
+			Expect(ok).To(BeTrue())
+		}
+	})
+})
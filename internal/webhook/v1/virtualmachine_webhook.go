@@ -0,0 +1,293 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1 contains the webhooks for KubeVirt v1 objects.
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/kubevirt"
+	"pelotech/ot-sync-operator/internal/naming"
+)
+
+// nolint:unused
+// log is for logging in this package.
+var virtualmachinelog = logf.Log.WithName("virtualmachine-resource")
+
+// mutateVirtualMachinePath is the path the VirtualMachine launch gate is served on.
+const mutateVirtualMachinePath = "/mutate-kubevirt-io-v1-virtualmachine"
+
+// SetupVirtualMachineWebhookWithManager registers the VirtualMachine launch gate in the manager.
+// VirtualMachines are handled as unstructured objects, so the gate is
+// registered as a raw admission handler instead of through the webhook builder.
+func SetupVirtualMachineWebhookWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(mutateVirtualMachinePath, &webhook.Admission{
+		Handler: &VirtualMachineLaunchGate{
+			Client:   mgr.GetClient(),
+			Recorder: mgr.GetEventRecorderFor("launch-gate"),
+			decoder:  admission.NewDecoder(mgr.GetScheme()),
+		},
+	})
+	return nil
+}
+
+// +kubebuilder:webhook:path=/mutate-kubevirt-io-v1-virtualmachine,mutating=true,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=kubevirt.io,resources=virtualmachines,verbs=create,versions=v1,name=mvirtualmachine-v1.pelotech.ot,admissionReviewVersions=v1
+
+// VirtualMachineLaunchGate holds workspace VirtualMachines whose data is not
+// synced yet, so a workspace launched too early waits for its volumes instead
+// of failing for good. A VirtualMachine belongs to a workspace through the
+// pelotech.ot/workspace-id label and, optionally, the
+// pelotech.ot/workspace-version label.
+//
+// A held VirtualMachine is created with runStrategy Halted and is released
+// with its original run strategy by the DataSync controller once the
+// DataSync succeeds. It stays halted while the DataSync is failed or
+// cancelled, and is unheld but left halted if the DataSync is deleted
+// before it synced.
+//
+// Since someone is waiting on a launched workspace, its DataSync is moved to
+// the priority lane of the admission queue. When the pipeline has not created
+// the DataSync yet, it is created from the pelotech.ot/sync-vms annotation of
+// the VirtualMachine. Both are done on behalf of the user launching the
+// workspace, who needs to be allowed to create or update the DataSync; users
+// who may not update it have their VirtualMachines held without promoting it.
+// Launches of a workspace whose DataSync failed or was cancelled are denied.
+type VirtualMachineLaunchGate struct {
+	Client   client.Client
+	Recorder record.EventRecorder
+	decoder  admission.Decoder
+}
+
+var _ admission.Handler = &VirtualMachineLaunchGate{}
+
+// Handle implements admission.Handler.
+func (g *VirtualMachineLaunchGate) Handle(ctx context.Context, req admission.Request) admission.Response {
+	vm := &unstructured.Unstructured{}
+	if err := g.decoder.DecodeRaw(req.Object, vm); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	workspaceID := vm.GetLabels()[otv1alpha1.LabelWorkspaceID]
+	if workspaceID == "" {
+		return admission.Allowed("not a workspace VirtualMachine")
+	}
+	version := vm.GetLabels()[otv1alpha1.LabelWorkspaceVersion]
+
+	ds, err := findDataSync(ctx, g.Client, req.Namespace, workspaceID, version)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	dryRun := req.DryRun != nil && *req.DryRun
+	if ds == nil {
+		if dryRun {
+			return admission.Allowed("dry run")
+		}
+		ds, err = g.createOnDemand(ctx, req, vm, workspaceID, version)
+		if apierrors.IsForbidden(err) {
+			return admission.Denied(err.Error())
+		}
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if ds == nil {
+			return admission.Allowed(fmt.Sprintf("no DataSync for workspace %s", workspaceID))
+		}
+	}
+	switch ds.Status.Phase {
+	case otv1alpha1.DataSyncPhaseSucceeded:
+		return admission.Allowed(fmt.Sprintf("DataSync %s has synced", ds.Name))
+	case otv1alpha1.DataSyncPhaseFailed, otv1alpha1.DataSyncPhaseCancelled:
+		return admission.Denied(fmt.Sprintf("the data of workspace %s will not be synced: DataSync %s is %s (%s)",
+			workspaceID, ds.Name, ds.Status.Phase, ds.Status.Message))
+	}
+
+	if !kubevirt.Hold(vm, ds.Name) {
+		return admission.Allowed("VirtualMachine is halted")
+	}
+	if !dryRun {
+		if err := g.promote(ctx, req, ds); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	}
+	virtualmachinelog.Info("Holding VirtualMachine until its data is synced",
+		"namespace", req.Namespace, "name", vm.GetName(), "datasync", ds.Name)
+
+	held, err := json.Marshal(vm.Object)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	resp := admission.PatchResponseFromRaw(req.Object.Raw, held)
+	resp.Warnings = append(resp.Warnings, fmt.Sprintf(
+		"VirtualMachine is held until DataSync %s has synced (currently %s)", ds.Name, phaseOf(ds)))
+	return resp
+}
+
+// createOnDemand creates the DataSync of a launched workspace from the VM
+// entries annotated on its VirtualMachine. It returns nil if the
+// VirtualMachine carries no VM entries.
+//
+// A DataSync created concurrently for another VirtualMachine of the same
+// workspace may not be in the cache yet, so on a name conflict the new
+// VirtualMachine is simply held for that DataSync. Should it have synced
+// already, the DataSync controller releases the VirtualMachine right away.
+//
+// It fails with a Forbidden error if the user launching the workspace may
+// not create the DataSync.
+func (g *VirtualMachineLaunchGate) createOnDemand(ctx context.Context, req admission.Request, vm *unstructured.Unstructured, workspaceID, version string) (*otv1alpha1.DataSync, error) {
+	raw := vm.GetAnnotations()[otv1alpha1.AnnotationSyncVMs]
+	if raw == "" {
+		return nil, nil
+	}
+	var vms []otv1alpha1.DataSyncVM
+	if err := json.Unmarshal([]byte(raw), &vms); err != nil {
+		return nil, fmt.Errorf("decoding %s annotation: %w", otv1alpha1.AnnotationSyncVMs, err)
+	}
+
+	name := naming.DataSyncName(workspaceID, version)
+	ok, err := g.allowed(ctx, req, "create", name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, apierrors.NewForbidden(otv1alpha1.GroupVersion.WithResource("datasyncs").GroupResource(), name,
+			fmt.Errorf("%s may not create the DataSync that syncs workspace %s", req.UserInfo.Username, workspaceID))
+	}
+	ds := &otv1alpha1.DataSync{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   req.Namespace,
+			Annotations: map[string]string{otv1alpha1.AnnotationOnDemand: "true"},
+		},
+		Spec: otv1alpha1.DataSyncSpec{
+			WorkspaceID: workspaceID,
+			Version:     version,
+			VMs:         vms,
+		},
+	}
+	if err := g.Client.Create(ctx, ds); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return ds, nil
+		}
+		return nil, fmt.Errorf("creating DataSync for workspace %s: %w", workspaceID, err)
+	}
+	virtualmachinelog.Info("Created DataSync for launched workspace", "namespace", req.Namespace, "name", ds.Name)
+	return ds, nil
+}
+
+// promote moves a DataSync that has not started syncing to the priority lane
+// of the admission queue, if the user launching the workspace may update it.
+func (g *VirtualMachineLaunchGate) promote(ctx context.Context, req admission.Request, ds *otv1alpha1.DataSync) error {
+	if ds.Annotations[otv1alpha1.AnnotationOnDemand] == "true" {
+		return nil
+	}
+	if phase := ds.Status.Phase; phase != "" && phase != otv1alpha1.DataSyncPhaseQueued {
+		return nil
+	}
+	ok, err := g.allowed(ctx, req, "update", ds.Name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		virtualmachinelog.Info("Not promoting DataSync the user may not update",
+			"namespace", ds.Namespace, "name", ds.Name, "user", req.UserInfo.Username)
+		return nil
+	}
+	patch := client.MergeFrom(ds.DeepCopy())
+	if ds.Annotations == nil {
+		ds.Annotations = map[string]string{}
+	}
+	ds.Annotations[otv1alpha1.AnnotationOnDemand] = "true"
+	if err := g.Client.Patch(ctx, ds, patch); err != nil {
+		return fmt.Errorf("promoting DataSync %s: %w", ds.Name, err)
+	}
+	g.Recorder.Event(ds, corev1.EventTypeNormal, "Promoted", "A workspace launch is waiting on this DataSync")
+	return nil
+}
+
+// allowed reports whether the user making req may verb the DataSync name in
+// the namespace of req.
+func (g *VirtualMachineLaunchGate) allowed(ctx context.Context, req admission.Request, verb, name string) (bool, error) {
+	extra := make(map[string]authorizationv1.ExtraValue, len(req.UserInfo.Extra))
+	for k, v := range req.UserInfo.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	access := &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+		User:   req.UserInfo.Username,
+		UID:    req.UserInfo.UID,
+		Groups: req.UserInfo.Groups,
+		Extra:  extra,
+		ResourceAttributes: &authorizationv1.ResourceAttributes{
+			Namespace: req.Namespace,
+			Verb:      verb,
+			Group:     otv1alpha1.GroupVersion.Group,
+			Resource:  "datasyncs",
+			Name:      name,
+		},
+	}}
+	if err := g.Client.Create(ctx, access); err != nil {
+		return false, fmt.Errorf("authorizing %s to %s DataSync %s: %w", req.UserInfo.Username, verb, name, err)
+	}
+	return access.Status.Allowed, nil
+}
+
+// findDataSync returns the DataSync of a workspace version, or nil if there
+// is none. Without a version the newest DataSync of the workspace is used.
+func findDataSync(ctx context.Context, c client.Reader, namespace, workspaceID, version string) (*otv1alpha1.DataSync, error) {
+	list := &otv1alpha1.DataSyncList{}
+	if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("listing DataSyncs: %w", err)
+	}
+
+	var found *otv1alpha1.DataSync
+	for i := range list.Items {
+		ds := &list.Items[i]
+		if ds.Spec.WorkspaceID != workspaceID || !ds.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if version != "" && ds.Spec.Version != version {
+			continue
+		}
+		if found == nil || found.CreationTimestamp.Before(&ds.CreationTimestamp) {
+			found = ds
+		}
+	}
+	return found, nil
+}
+
+// phaseOf returns the phase of a DataSync for messages.
+func phaseOf(ds *otv1alpha1.DataSync) otv1alpha1.DataSyncPhase {
+	if ds.Status.Phase == "" {
+		return otv1alpha1.DataSyncPhaseQueued
+	}
+	return ds.Status.Phase
+}
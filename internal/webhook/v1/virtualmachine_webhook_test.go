@@ -0,0 +1,195 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	jsonpatch "gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/kubevirt"
+)
+
+var _ = Describe("VirtualMachine Launch Gate", func() {
+	var (
+		ctx       context.Context
+		ds        *otv1alpha1.DataSync
+		vm        *unstructured.Unstructured
+		k8sClient client.Client
+		// allowed are the verbs the user launching the VirtualMachine may
+		// use on DataSyncs.
+		allowed []string
+	)
+
+	handle := func() admission.Response {
+		scheme := runtime.NewScheme()
+		Expect(otv1alpha1.AddToScheme(scheme)).To(Succeed())
+		k8sClient = interceptor.NewClient(fake.NewClientBuilder().WithScheme(scheme).WithObjects(ds).Build(), interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if review, ok := obj.(*authorizationv1.SubjectAccessReview); ok {
+					attrs := review.Spec.ResourceAttributes
+					Expect(review.Spec.User).To(Equal("jane"))
+					Expect(attrs.Resource).To(Equal("datasyncs"))
+					review.Status.Allowed = slices.Contains(allowed, attrs.Verb)
+					return nil
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		})
+		gate := &VirtualMachineLaunchGate{
+			Client:   k8sClient,
+			Recorder: record.NewFakeRecorder(10),
+			decoder:  admission.NewDecoder(scheme),
+		}
+		raw, err := json.Marshal(vm.Object)
+		Expect(err).NotTo(HaveOccurred())
+		return gate.Handle(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Namespace: "default",
+			UserInfo:  authenticationv1.UserInfo{Username: "jane"},
+			Object:    runtime.RawExtension{Raw: raw},
+		}})
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		allowed = []string{"create", "update"}
+		ds = &otv1alpha1.DataSync{
+			ObjectMeta: metav1.ObjectMeta{Name: "sync-workspace-035", Namespace: "default"},
+			Spec: otv1alpha1.DataSyncSpec{
+				WorkspaceID: "035",
+				Version:     "1.4.0",
+				VMs:         []otv1alpha1.DataSyncVM{{Name: "controller", URL: "https://mirror.example.com/controller.qcow2", SourceType: otv1alpha1.SourceTypeHTTP}},
+			},
+			Status: otv1alpha1.DataSyncStatus{Phase: otv1alpha1.DataSyncPhaseSyncing},
+		}
+		vm = &unstructured.Unstructured{}
+		vm.SetGroupVersionKind(kubevirt.VirtualMachineGVK)
+		vm.SetName("workspace-035-controller")
+		vm.SetNamespace("default")
+		vm.SetLabels(map[string]string{
+			otv1alpha1.LabelWorkspaceID:      "035",
+			otv1alpha1.LabelWorkspaceVersion: "1.4.0",
+		})
+		Expect(unstructured.SetNestedField(vm.Object, true, "spec", "running")).To(Succeed())
+	})
+
+	It("Should hold a VirtualMachine whose data is still syncing", func() {
+		resp := handle()
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Warnings).To(ContainElement(ContainSubstring("held until DataSync sync-workspace-035 has synced")))
+		Expect(resp.Patches).To(ContainElements(
+			jsonpatch.NewOperation("remove", "/spec/running", nil),
+			jsonpatch.NewOperation("add", "/spec/runStrategy", kubevirt.RunStrategyHalted),
+		))
+
+		held := vm.DeepCopy()
+		Expect(kubevirt.Hold(held, ds.Name)).To(BeTrue())
+		Expect(kubevirt.HeldFor(held)).To(Equal(ds.Name))
+		kubevirt.Release(held)
+		Expect(kubevirt.RunStrategy(held)).To(Equal(kubevirt.RunStrategyAlways))
+		Expect(held.GetLabels()).NotTo(HaveKey(otv1alpha1.LabelHeld))
+	})
+
+	It("Should admit a VirtualMachine whose data has synced", func() {
+		ds.Status.Phase = otv1alpha1.DataSyncPhaseSucceeded
+		resp := handle()
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Patches).To(BeEmpty())
+	})
+
+	It("Should deny launching a workspace whose DataSync failed", func() {
+		ds.Status.Phase = otv1alpha1.DataSyncPhaseFailed
+		ds.Status.Message = "Attempt 4 failed"
+		resp := handle()
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("DataSync sync-workspace-035 is Failed (Attempt 4 failed)"))
+	})
+
+	It("Should promote a queued DataSync to the priority lane", func() {
+		ds.Status.Phase = otv1alpha1.DataSyncPhaseQueued
+		Expect(handle().Patches).NotTo(BeEmpty())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(ds), ds)).To(Succeed())
+		Expect(ds.Annotations).To(HaveKeyWithValue(otv1alpha1.AnnotationOnDemand, "true"))
+	})
+
+	It("Should only promote DataSyncs the user may update", func() {
+		allowed = nil
+		ds.Status.Phase = otv1alpha1.DataSyncPhaseQueued
+		Expect(handle().Patches).NotTo(BeEmpty(), "the VirtualMachine is still held")
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(ds), ds)).To(Succeed())
+		Expect(ds.Annotations).NotTo(HaveKey(otv1alpha1.AnnotationOnDemand))
+	})
+
+	It("Should create a missing DataSync from the VirtualMachine", func() {
+		vm.SetLabels(map[string]string{otv1alpha1.LabelWorkspaceID: "035", otv1alpha1.LabelWorkspaceVersion: "2.0.0"})
+		vm.SetAnnotations(map[string]string{otv1alpha1.AnnotationSyncVMs: `[{"name":"controller",` +
+			`"url":"https://mirror.example.com/controller-2.qcow2","sourceType":"http"}]`})
+		resp := handle()
+		Expect(resp.Warnings).To(ContainElement(ContainSubstring("held until DataSync sync-workspace-035-2.0.0 has synced")))
+
+		created := &otv1alpha1.DataSync{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "sync-workspace-035-2.0.0", Namespace: "default"}, created)).
+			To(Succeed())
+		Expect(created.Annotations).To(HaveKeyWithValue(otv1alpha1.AnnotationOnDemand, "true"))
+		Expect(created.Spec.Version).To(Equal("2.0.0"))
+		Expect(created.Spec.VMs).To(HaveLen(1))
+	})
+
+	It("Should deny creating a DataSync the user may not create", func() {
+		allowed = []string{"update"}
+		vm.SetLabels(map[string]string{otv1alpha1.LabelWorkspaceID: "035", otv1alpha1.LabelWorkspaceVersion: "2.0.0"})
+		vm.SetAnnotations(map[string]string{otv1alpha1.AnnotationSyncVMs: `[{"name":"controller",` +
+			`"url":"https://mirror.example.com/controller-2.qcow2","sourceType":"http"}]`})
+		resp := handle()
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("jane may not create the DataSync"))
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "sync-workspace-035-2.0.0", Namespace: "default"},
+			&otv1alpha1.DataSync{})).NotTo(Succeed())
+	})
+
+	It("Should admit VirtualMachines without a matching DataSync", func() {
+		vm.SetLabels(map[string]string{otv1alpha1.LabelWorkspaceID: "035", otv1alpha1.LabelWorkspaceVersion: "2.0.0"})
+		Expect(handle().Patches).To(BeEmpty())
+
+		vm.SetLabels(nil)
+		Expect(handle().Patches).To(BeEmpty())
+	})
+
+	It("Should leave halted VirtualMachines alone", func() {
+		Expect(unstructured.SetNestedField(vm.Object, false, "spec", "running")).To(Succeed())
+		Expect(handle().Patches).To(BeEmpty())
+	})
+})
@@ -0,0 +1,482 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/policy"
+	"pelotech/ot-sync-operator/internal/preflight"
+)
+
+// nolint:unused
+// log is for logging in this package.
+var datasynclog = logf.Log.WithName("datasync-resource")
+
+// gibibyte is the unit looked up source sizes are rounded up to.
+const gibibyte = 1 << 30
+
+// supportedSchemes lists the URL schemes CDI accepts for each source type.
+var supportedSchemes = map[otv1alpha1.SourceType][]string{
+	otv1alpha1.SourceTypeHTTP:     {"http", "https"},
+	otv1alpha1.SourceTypeRegistry: {"docker", "oci-archive"},
+	otv1alpha1.SourceTypeS3:       {"s3", "http", "https"},
+}
+
+// checksumPattern matches the checksums a VM entry may be verified against.
+var checksumPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// preflightTimeout bounds the time spent looking up source sizes for a single
+// DataSync, well within the timeout the API server gives the webhook.
+const preflightTimeout = 5 * time.Second
+
+// SetupDataSyncWebhookWithManager registers the webhook for DataSync in the manager.
+func SetupDataSyncWebhookWithManager(mgr ctrl.Manager, store *policy.Store) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&otv1alpha1.DataSync{}).
+		WithValidator(&DataSyncCustomValidator{Policy: store}).
+		WithDefaulter(&DataSyncCustomDefaulter{
+			Policy: store,
+			Sizer:  preflight.NewHTTPSizer(preflightTimeout),
+			Reader: mgr.GetAPIReader(),
+		}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-pelotech-ot-v1alpha1-datasync,mutating=true,failurePolicy=fail,sideEffects=None,groups=pelotech.ot,resources=datasyncs,verbs=create;update,versions=v1alpha1,name=mdatasync-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// DataSyncCustomDefaulter fills in the storage settings and labels a pipeline
+// leaves out, so consumers do not have to hardcode them per environment.
+type DataSyncCustomDefaulter struct {
+	// Policy provides the default storage class, volume size and access mode.
+	Policy *policy.Store
+	// Sizer looks up the size of http sources that do not set one.
+	Sizer preflight.Sizer
+	// Reader reads the Secrets and CA bundles sources are looked up with,
+	// which the operator does not cache.
+	Reader client.Reader
+}
+
+var _ webhook.CustomDefaulter = &DataSyncCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type DataSync.
+func (d *DataSyncCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	datasync, ok := obj.(*otv1alpha1.DataSync)
+	if !ok {
+		return fmt.Errorf("expected a DataSync object but got %T", obj)
+	}
+	datasynclog.Info("Defaulting for DataSync", "name", datasync.GetName())
+
+	// The VM list is frozen once syncing starts; leave it alone so defaulting
+	// never turns an otherwise valid update into a forbidden one.
+	if phase := datasync.Status.Phase; phase != "" && phase != otv1alpha1.DataSyncPhaseQueued {
+		d.defaultLabels(datasync)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+
+	p := d.Policy.Get()
+	var allErrs field.ErrorList
+	for i := range datasync.Spec.VMs {
+		vm := &datasync.Spec.VMs[i]
+		path := field.NewPath("spec", "vms").Index(i)
+		bytes, err := d.diskSize(ctx, datasync.Namespace, vm)
+		unknown := errors.Is(err, preflight.ErrNoDiskSize)
+		if unknown && vm.Checksum != "" {
+			// The volume would be hashed with the space CDI grew the disk by.
+			allErrs = append(allErrs, field.Forbidden(path.Child("checksum"),
+				fmt.Sprintf("cannot be verified for this source: %v", err)))
+		}
+		// CDI sizes clones and restores after what they copy.
+		if vm.Size == nil && vm.SourceType.Remote() {
+			switch {
+			case unknown:
+				// The policy default could be too small for the disk.
+				allErrs = append(allErrs, field.Required(path.Child("size"),
+					fmt.Sprintf("must be set for this source: %v", err)))
+				continue
+			case bytes > 0:
+				gib := (bytes + gibibyte - 1) / gibibyte
+				vm.Size = resource.NewQuantity(gib*gibibyte, resource.BinarySI)
+			default:
+				if err != nil {
+					datasynclog.Info("Could not look up the source size, using the policy default",
+						"vm", vm.Name, "url", vm.URL, "error", err.Error())
+				}
+				vm.Size = ptr.To(p.DefaultVolumeSize.DeepCopy())
+			}
+		}
+		if vm.StorageClassName == nil && p.DefaultStorageClass != "" {
+			vm.StorageClassName = ptr.To(p.DefaultStorageClass)
+		}
+		if vm.AccessMode == "" {
+			vm.AccessMode = p.DefaultAccessMode
+		}
+	}
+	if len(allErrs) > 0 {
+		return toInvalid(datasync, allErrs)
+	}
+	d.defaultLabels(datasync)
+	return nil
+}
+
+// defaultLabels labels a DataSync with its workspace and version so it can be selected by them.
+// Values that are not valid labels are left for the validator to reject.
+func (d *DataSyncCustomDefaulter) defaultLabels(datasync *otv1alpha1.DataSync) {
+	for key, value := range map[string]string{
+		otv1alpha1.LabelWorkspaceID:      datasync.Spec.WorkspaceID,
+		otv1alpha1.LabelWorkspaceVersion: datasync.Spec.Version,
+	} {
+		if value == "" || len(validation.IsValidLabelValue(value)) > 0 {
+			continue
+		}
+		labels := datasync.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		if _, ok := labels[key]; !ok {
+			labels[key] = value
+			datasync.SetLabels(labels)
+		}
+	}
+}
+
+// diskSize looks up the size of the disk an http source will produce, with
+// its headers, credentials and CA bundle. It is only looked up when it is
+// needed to default the size of the volume or to verify the checksum of the
+// disk, and is 0 otherwise. Images such as compressed ones, whose length is
+// not the size of their disk, fail with preflight.ErrNoDiskSize.
+func (d *DataSyncCustomDefaulter) diskSize(ctx context.Context, namespace string, vm *otv1alpha1.DataSyncVM) (int64, error) {
+	if d.Sizer == nil || vm.SourceType != otv1alpha1.SourceTypeHTTP || (vm.Size != nil && vm.Checksum == "") {
+		return 0, nil
+	}
+	src, err := preflight.SourceFor(ctx, d.Reader, namespace, vm)
+	if err != nil {
+		return 0, err
+	}
+	return d.Sizer.DiskSize(ctx, src)
+}
+
+// +kubebuilder:webhook:path=/validate-pelotech-ot-v1alpha1-datasync,mutating=false,failurePolicy=fail,sideEffects=None,groups=pelotech.ot,resources=datasyncs,verbs=create;update,versions=v1alpha1,name=vdatasync-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// DataSyncCustomValidator rejects DataSyncs that could only fail once the
+// import is underway, so bad manifests fail at apply time instead.
+type DataSyncCustomValidator struct {
+	// Policy is used to warn about priority classes it does not define.
+	Policy *policy.Store
+}
+
+var _ webhook.CustomValidator = &DataSyncCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type DataSync.
+func (v *DataSyncCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	datasync, ok := obj.(*otv1alpha1.DataSync)
+	if !ok {
+		return nil, fmt.Errorf("expected a DataSync object but got %T", obj)
+	}
+	datasynclog.Info("Validation for DataSync upon creation", "name", datasync.GetName())
+
+	allErrs := validateName(datasync.Name, field.NewPath("metadata", "name"))
+	allErrs = append(allErrs, validateSpec(&datasync.Spec, datasync.Namespace, field.NewPath("spec"))...)
+	return v.warnings(datasync), toInvalid(datasync, allErrs)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type DataSync.
+func (v *DataSyncCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	datasync, ok := newObj.(*otv1alpha1.DataSync)
+	if !ok {
+		return nil, fmt.Errorf("expected a DataSync object for the newObj but got %T", newObj)
+	}
+	old, ok := oldObj.(*otv1alpha1.DataSync)
+	if !ok {
+		return nil, fmt.Errorf("expected a DataSync object for the oldObj but got %T", oldObj)
+	}
+	datasynclog.Info("Validation for DataSync upon update", "name", datasync.GetName())
+
+	specPath := field.NewPath("spec")
+	allErrs := validateSpec(&datasync.Spec, datasync.Namespace, specPath)
+
+	// Once storage objects exist, changing the VM list would leave them out of
+	// step with the spec, so the list is frozen after the DataSync leaves Queued.
+	phase := old.Status.Phase
+	if phase != "" && phase != otv1alpha1.DataSyncPhaseQueued &&
+		!equality.Semantic.DeepEqual(old.Spec.VMs, datasync.Spec.VMs) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("vms"),
+			fmt.Sprintf("may not be changed once the DataSync is %s", phase)))
+	}
+
+	return v.warnings(datasync), toInvalid(datasync, allErrs)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type DataSync.
+func (v *DataSyncCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// warnings points out settings that are valid but probably not what was meant.
+// Priority classes are not rejected since the policy may define them later.
+func (v *DataSyncCustomValidator) warnings(datasync *otv1alpha1.DataSync) admission.Warnings {
+	class := datasync.Spec.PriorityClassName
+	if v.Policy == nil || class == "" {
+		return nil
+	}
+	if _, ok := v.Policy.Get().Priority(class); ok {
+		return nil
+	}
+	return admission.Warnings{fmt.Sprintf(
+		"priority class %q is not defined in the sync policy; the DataSync is scheduled with priority 0", class)}
+}
+
+// validateName checks the name of a DataSync, which is copied into the
+// labels of the objects created for it and so has to be a valid label value.
+func validateName(name string, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, msg := range validation.IsValidLabelValue(name) {
+		allErrs = append(allErrs, field.Invalid(path, name, msg))
+	}
+	return allErrs
+}
+
+// validateSpec checks the fields of the spec of a DataSync in namespace.
+func validateSpec(spec *otv1alpha1.DataSyncSpec, namespace string, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	// The workspace and version are copied into labels of the objects
+	// created for the DataSync.
+	if spec.WorkspaceID == "" {
+		allErrs = append(allErrs, field.Required(path.Child("workspaceId"), "must identify the workspace"))
+	}
+	for _, msg := range validation.IsValidLabelValue(spec.WorkspaceID) {
+		allErrs = append(allErrs, field.Invalid(path.Child("workspaceId"), spec.WorkspaceID, msg))
+	}
+	for _, msg := range validation.IsValidLabelValue(spec.Version) {
+		allErrs = append(allErrs, field.Invalid(path.Child("version"), spec.Version, msg))
+	}
+
+	vmsPath := path.Child("vms")
+	if len(spec.VMs) == 0 {
+		allErrs = append(allErrs, field.Required(vmsPath, "at least one vm is required"))
+	}
+	seen := make(map[string]bool, len(spec.VMs))
+	for i, vm := range spec.VMs {
+		vmPath := vmsPath.Index(i)
+		if seen[vm.Name] {
+			allErrs = append(allErrs, field.Duplicate(vmPath.Child("name"), vm.Name))
+		}
+		seen[vm.Name] = true
+		allErrs = append(allErrs, validateVM(&vm, namespace, vmPath)...)
+	}
+
+	return allErrs
+}
+
+// validateVM checks that a VM entry names a supported source type and sets
+// the fields that type needs, and no fields of the other types.
+func validateVM(vm *otv1alpha1.DataSyncVM, namespace string, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	switch vm.SourceType {
+	case otv1alpha1.SourceTypeHTTP, otv1alpha1.SourceTypeRegistry, otv1alpha1.SourceTypeS3:
+		allErrs = append(allErrs, validateURL(vm, path.Child("url"))...)
+	case otv1alpha1.SourceTypePVC:
+		allErrs = append(allErrs, validateVolumeSource(vm, vm.PVC, namespace, path, "pvc")...)
+	case otv1alpha1.SourceTypeSnapshot:
+		allErrs = append(allErrs, validateVolumeSource(vm, vm.Snapshot, namespace, path, "snapshot")...)
+	default:
+		return field.ErrorList{field.NotSupported(path.Child("sourceType"), vm.SourceType, []otv1alpha1.SourceType{
+			otv1alpha1.SourceTypeHTTP, otv1alpha1.SourceTypeRegistry, otv1alpha1.SourceTypeS3,
+			otv1alpha1.SourceTypePVC, otv1alpha1.SourceTypeSnapshot,
+		})}
+	}
+
+	for _, settings := range []struct {
+		name       string
+		sourceType otv1alpha1.SourceType
+		set        bool
+	}{
+		{"http", otv1alpha1.SourceTypeHTTP, vm.HTTP != nil},
+		{"registry", otv1alpha1.SourceTypeRegistry, vm.Registry != nil},
+		{"pvc", otv1alpha1.SourceTypePVC, vm.PVC != nil},
+		{"snapshot", otv1alpha1.SourceTypeSnapshot, vm.Snapshot != nil},
+	} {
+		if settings.set && settings.sourceType != vm.SourceType {
+			allErrs = append(allErrs, field.Forbidden(path.Child(settings.name),
+				fmt.Sprintf("may only be set for sourceType %s", settings.sourceType)))
+		}
+	}
+	for _, ref := range []struct{ name, value string }{
+		{"secretRef", vm.SecretRef},
+		{"certConfigMapRef", vm.CertConfigMapRef},
+	} {
+		switch {
+		case ref.value == "":
+		case !vm.SourceType.Remote():
+			allErrs = append(allErrs, field.Forbidden(path.Child(ref.name),
+				"may only be set for sourceType http, registry or s3"))
+		default:
+			for _, msg := range validation.IsDNS1123Subdomain(ref.value) {
+				allErrs = append(allErrs, field.Invalid(path.Child(ref.name), ref.value, msg))
+			}
+		}
+	}
+	if vm.HTTP != nil {
+		allErrs = append(allErrs, validateHeaders(vm.HTTP.Headers, path.Child("http", "headers"))...)
+		if ref := vm.HTTP.HeadersSecretRef; ref != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(ref) {
+				allErrs = append(allErrs, field.Invalid(path.Child("http", "headersSecretRef"), ref, msg))
+			}
+		}
+	}
+	switch {
+	case vm.Checksum == "":
+	case !checksumPattern.MatchString(vm.Checksum):
+		allErrs = append(allErrs, field.Invalid(path.Child("checksum"), vm.Checksum,
+			"must be sha256: followed by 64 lowercase hex digits"))
+	case vm.SourceType != otv1alpha1.SourceTypeHTTP:
+		// Only the disk of http sources can be told apart from the space CDI
+		// grows it by to fill the volume.
+		allErrs = append(allErrs, field.Forbidden(path.Child("checksum"),
+			"may only be set for sourceType http, whose disk size can be looked up"))
+	}
+	if vm.Delta != nil {
+		allErrs = append(allErrs, validateDelta(vm, path.Child("delta"))...)
+	}
+	return allErrs
+}
+
+// validateDelta checks the delta a VM entry applies to an earlier version of
+// its disk.
+func validateDelta(vm *otv1alpha1.DataSyncVM, path *field.Path) field.ErrorList {
+	if !vm.SourceType.Remote() {
+		return field.ErrorList{field.Forbidden(path, "may only be set for sourceType http, registry or s3")}
+	}
+	var allErrs field.ErrorList
+	urlPath := path.Child("url")
+	if u, err := url.Parse(vm.Delta.URL); err != nil {
+		allErrs = append(allErrs, field.Invalid(urlPath, vm.Delta.URL, err.Error()))
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		allErrs = append(allErrs, field.Invalid(urlPath, vm.Delta.URL, "scheme must be one of [http https]"))
+	} else if u.Host == "" {
+		allErrs = append(allErrs, field.Invalid(urlPath, vm.Delta.URL, "must include a host"))
+	}
+	// The base version is matched against the version label of DataVolumes.
+	if vm.Delta.BaseVersion == "" {
+		allErrs = append(allErrs, field.Required(path.Child("baseVersion"),
+			"the overlay only applies to the disk of the version it was built against"))
+	}
+	for _, msg := range validation.IsValidLabelValue(vm.Delta.BaseVersion) {
+		allErrs = append(allErrs, field.Invalid(path.Child("baseVersion"), vm.Delta.BaseVersion, msg))
+	}
+	return allErrs
+}
+
+// validateURL checks that a VM entry has a URL its source type can import.
+func validateURL(vm *otv1alpha1.DataSyncVM, path *field.Path) field.ErrorList {
+	if vm.URL == "" {
+		return field.ErrorList{field.Required(path, fmt.Sprintf("must be set for sourceType %s", vm.SourceType))}
+	}
+	schemes := supportedSchemes[vm.SourceType]
+	u, err := url.Parse(vm.URL)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, vm.URL, err.Error())}
+	}
+	if !slices.Contains(schemes, u.Scheme) {
+		return field.ErrorList{field.Invalid(path, vm.URL,
+			fmt.Sprintf("scheme must be one of %v for sourceType %s", schemes, vm.SourceType))}
+	}
+	if u.Host == "" && u.Scheme != "oci-archive" {
+		return field.ErrorList{field.Invalid(path, vm.URL, "must include a host")}
+	}
+	return nil
+}
+
+// validateVolumeSource checks the PVC or VolumeSnapshot a VM entry of a
+// DataSync in namespace copies. ref is the field called name of the VM entry
+// at vmPath. CDI clones with the permissions of the operator, so the volume
+// must be in the namespace of the DataSync: anyone able to create a DataSync
+// could otherwise copy volumes they cannot read.
+func validateVolumeSource(vm *otv1alpha1.DataSyncVM, ref *otv1alpha1.DataSyncVolumeSource, namespace string, vmPath *field.Path, name string) field.ErrorList {
+	var allErrs field.ErrorList
+	if vm.URL != "" {
+		allErrs = append(allErrs, field.Forbidden(vmPath.Child("url"),
+			fmt.Sprintf("may not be set for sourceType %s", vm.SourceType)))
+	}
+	path := vmPath.Child(name)
+	if ref == nil {
+		return append(allErrs, field.Required(path, fmt.Sprintf("must be set for sourceType %s", vm.SourceType)))
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(ref.Name) {
+		allErrs = append(allErrs, field.Invalid(path.Child("name"), ref.Name, msg))
+	}
+	if ref.Namespace != "" && ref.Namespace != namespace {
+		allErrs = append(allErrs, field.Forbidden(path.Child("namespace"),
+			fmt.Sprintf("must be the namespace of the DataSync (%s)", namespace)))
+	}
+	return allErrs
+}
+
+// credentialHeaders are the headers that carry credentials, which would be
+// stored in plain text in the spec of the DataSync and its DataVolumes.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// validateHeaders checks the extra headers of an http source.
+func validateHeaders(headers []otv1alpha1.DataSyncHTTPHeader, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, h := range headers {
+		for _, msg := range validation.IsHTTPHeaderName(h.Name) {
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("name"), h.Name, msg))
+		}
+		if slices.Contains(credentialHeaders, http.CanonicalHeaderKey(h.Name)) {
+			allErrs = append(allErrs, field.Forbidden(path.Index(i).Child("name"),
+				fmt.Sprintf("%s carries credentials; send it with headersSecretRef", h.Name)))
+		}
+		if strings.ContainsAny(h.Value, "\r\n") {
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("value"), h.Value, "must not contain line breaks"))
+		}
+	}
+	return allErrs
+}
+
+// toInvalid wraps a list of field errors in an Invalid API error, or returns nil if there are none.
+func toInvalid(datasync *otv1alpha1.DataSync, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(otv1alpha1.GroupVersion.WithKind("DataSync").GroupKind(), datasync.Name, allErrs)
+}
@@ -0,0 +1,373 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	otv1alpha1 "pelotech/ot-sync-operator/api/v1alpha1"
+	"pelotech/ot-sync-operator/internal/policy"
+	"pelotech/ot-sync-operator/internal/preflight"
+)
+
+// fakeSizer reports fixed sizes per URL, or no size for compressed images,
+// and fails for any other URL. Sources have to carry the credentials of
+// their Secret.
+type fakeSizer map[string]int64
+
+func (f fakeSizer) DiskSize(_ context.Context, src preflight.Source) (int64, error) {
+	size, ok := f[src.URL]
+	switch {
+	case !ok:
+		return 0, errors.New("not found")
+	case strings.HasSuffix(src.URL, ".gz"):
+		return 0, fmt.Errorf("%w from a gzip image", preflight.ErrNoDiskSize)
+	case strings.Contains(src.URL, "private") && src.Header.Get("Authorization") == "":
+		return 0, errors.New("unauthorized")
+	}
+	return size, nil
+}
+
+var _ = Describe("DataSync Webhook", func() {
+	var (
+		ctx       context.Context
+		obj       *otv1alpha1.DataSync
+		oldObj    *otv1alpha1.DataSync
+		validator DataSyncCustomValidator
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		obj = &otv1alpha1.DataSync{
+			ObjectMeta: metav1.ObjectMeta{Name: "sync-workspace-035", Namespace: "default"},
+			Spec: otv1alpha1.DataSyncSpec{
+				WorkspaceID: "035",
+				VMs: []otv1alpha1.DataSyncVM{
+					{Name: "controller", URL: "https://mirror.example.com/controller.qcow2", SourceType: otv1alpha1.SourceTypeHTTP},
+					{Name: "worker", URL: "docker://registry.example.com/worker:1", SourceType: otv1alpha1.SourceTypeRegistry},
+				},
+			},
+		}
+		oldObj = obj.DeepCopy()
+		validator = DataSyncCustomValidator{}
+	})
+
+	Context("When creating DataSync under Validating Webhook", func() {
+		It("Should admit a valid DataSync", func() {
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny names too long to label volumes with", func() {
+			obj.Name = "sync-workspace-" + strings.Repeat("0", 49)
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("metadata.name")))
+		})
+
+		It("Should deny an empty workspaceId", func() {
+			obj.Spec.WorkspaceID = ""
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("spec.workspaceId")))
+		})
+
+		It("Should deny a workspaceId that is not a valid label value", func() {
+			for _, id := range []string{"team/foo", strings.Repeat("0", 64)} {
+				obj.Spec.WorkspaceID = id
+				Expect(validator.ValidateCreate(ctx, obj)).Error().To(
+					MatchError(ContainSubstring("spec.workspaceId: Invalid value")), id)
+			}
+		})
+
+		It("Should deny duplicate VM names", func() {
+			obj.Spec.VMs[1].Name = "controller"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(
+				MatchError(ContainSubstring(`spec.vms[1].name: Duplicate value: "controller"`)))
+		})
+
+		It("Should deny unknown source types", func() {
+			obj.Spec.VMs[0].SourceType = "ftp"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(
+				MatchError(ContainSubstring(`spec.vms[0].sourceType: Unsupported value: "ftp"`)))
+		})
+
+		It("Should warn about priority classes the policy does not define", func() {
+			store := policy.NewStore()
+			p := policy.Defaults()
+			p.PriorityClasses = map[string]int{"release-day": 100}
+			store.Set(p)
+			validator.Policy = store
+
+			obj.Spec.PriorityClassName = "release-day"
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeEmpty())
+			obj.Spec.PriorityClassName = "release"
+			Expect(validator.ValidateCreate(ctx, obj)).To(ConsistOf(ContainSubstring(`priority class "release" is not defined`)))
+		})
+
+		It("Should deny malformed URLs", func() {
+			obj.Spec.VMs[0].URL = "mirror.example.com/controller.qcow2"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("spec.vms[0].url")))
+
+			obj.Spec.VMs[0].URL = "https://"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("must include a host")))
+
+			obj.Spec.VMs[0].URL = "https://mirror.example.com/controller.qcow2"
+			obj.Spec.VMs[1].URL = "https://registry.example.com/worker:1"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("spec.vms[1].url")))
+		})
+	})
+
+	Context("When validating typed sources", func() {
+		It("Should admit PVC clones, snapshot restores and http headers", func() {
+			obj.Spec.VMs = append(obj.Spec.VMs,
+				otv1alpha1.DataSyncVM{Name: "golden", SourceType: otv1alpha1.SourceTypePVC,
+					PVC: &otv1alpha1.DataSyncVolumeSource{Name: "golden-image", Namespace: "default"}},
+				otv1alpha1.DataSyncVM{Name: "restored", SourceType: otv1alpha1.SourceTypeSnapshot,
+					Snapshot: &otv1alpha1.DataSyncVolumeSource{Name: "nightly"}},
+			)
+			obj.Spec.VMs[0].HTTP = &otv1alpha1.DataSyncHTTPSource{
+				Headers: []otv1alpha1.DataSyncHTTPHeader{{Name: "X-Mirror-Token", Value: "abc"}},
+			}
+			obj.Spec.VMs[1].Registry = &otv1alpha1.DataSyncRegistrySource{PullMethod: otv1alpha1.RegistryPullMethodNode}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should require the fields of the source type", func() {
+			obj.Spec.VMs[0] = otv1alpha1.DataSyncVM{Name: "golden", SourceType: otv1alpha1.SourceTypePVC,
+				URL: "https://mirror.example.com/controller.qcow2"}
+			obj.Spec.VMs[1].URL = ""
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[0].url: Forbidden: may not be set for sourceType pvc")))
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[0].pvc: Required value")))
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[1].url: Required value")))
+		})
+
+		It("Should deny fields of other source types", func() {
+			obj.Spec.VMs[1].HTTP = &otv1alpha1.DataSyncHTTPSource{}
+			obj.Spec.VMs[0].Snapshot = &otv1alpha1.DataSyncVolumeSource{Name: "nightly"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[1].http: Forbidden: may only be set for sourceType http")))
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[0].snapshot: Forbidden: may only be set for sourceType snapshot")))
+		})
+
+		It("Should deny invalid headers and volume names", func() {
+			obj.Spec.VMs[0].HTTP = &otv1alpha1.DataSyncHTTPSource{Headers: []otv1alpha1.DataSyncHTTPHeader{
+				{Name: "Bad Header", Value: "x"},
+				{Name: "X-Token", Value: "a\r\nHost: evil.example.com"},
+			}}
+			obj.Spec.VMs[1] = otv1alpha1.DataSyncVM{Name: "golden", SourceType: otv1alpha1.SourceTypePVC,
+				PVC: &otv1alpha1.DataSyncVolumeSource{Name: "Golden_Image"}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[0].http.headers[0].name")))
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[0].http.headers[1].value")))
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[1].pvc.name")))
+		})
+
+		It("Should steer credential headers to a Secret", func() {
+			obj.Spec.VMs[0].HTTP = &otv1alpha1.DataSyncHTTPSource{
+				Headers:          []otv1alpha1.DataSyncHTTPHeader{{Name: "authorization", Value: "Bearer abc"}},
+				HeadersSecretRef: "Mirror_Token",
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring(
+				"spec.vms[0].http.headers[0].name: Forbidden: authorization carries credentials; send it with headersSecretRef")))
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[0].http.headersSecretRef")))
+
+			obj.Spec.VMs[0].HTTP = &otv1alpha1.DataSyncHTTPSource{HeadersSecretRef: "mirror-token"}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny volumes in other namespaces", func() {
+			obj.Spec.VMs[0] = otv1alpha1.DataSyncVM{Name: "golden", SourceType: otv1alpha1.SourceTypePVC,
+				PVC: &otv1alpha1.DataSyncVolumeSource{Name: "golden-image", Namespace: "images"}}
+			obj.Spec.VMs[1] = otv1alpha1.DataSyncVM{Name: "restored", SourceType: otv1alpha1.SourceTypeSnapshot,
+				Snapshot: &otv1alpha1.DataSyncVolumeSource{Name: "nightly", Namespace: "kube-system"}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring(
+				"spec.vms[0].pvc.namespace: Forbidden: must be the namespace of the DataSync (default)")))
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[1].snapshot.namespace: Forbidden")))
+		})
+
+		It("Should only admit credentials and CA bundles for remote sources", func() {
+			obj.Spec.VMs[0].SecretRef = "mirror-basic-auth"
+			obj.Spec.VMs[0].CertConfigMapRef = "internal-ca"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+
+			obj.Spec.VMs[0].SecretRef = "Mirror_Auth"
+			obj.Spec.VMs[1] = otv1alpha1.DataSyncVM{Name: "golden", SourceType: otv1alpha1.SourceTypePVC,
+				PVC: &otv1alpha1.DataSyncVolumeSource{Name: "golden-image"}, CertConfigMapRef: "internal-ca"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[0].secretRef: Invalid value")))
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[1].certConfigMapRef: Forbidden")))
+		})
+
+		It("Should admit sha256 checksums and deny anything else", func() {
+			obj.Spec.VMs[0].Checksum = "sha256:" + strings.Repeat("ab", 32)
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+
+			obj.Spec.VMs[1].Checksum = "md5:d41d8cd98f00b204e9800998ecf8427e"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(
+				MatchError(ContainSubstring("spec.vms[1].checksum")))
+		})
+
+		It("Should only admit checksums for http sources", func() {
+			obj.Spec.VMs[1].Checksum = "sha256:" + strings.Repeat("ab", 32)
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring(
+				"spec.vms[1].checksum: Forbidden: may only be set for sourceType http")))
+		})
+
+		It("Should only admit http deltas for remote sources", func() {
+			obj.Spec.VMs[0].Delta = &otv1alpha1.DataSyncDeltaSource{
+				URL: "https://mirror.example.com/controller-1.0-1.1.qcow2", BaseVersion: "1.0.0"}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+
+			obj.Spec.VMs[0].Delta.URL = "s3://deltas/controller.qcow2"
+			obj.Spec.VMs[1] = otv1alpha1.DataSyncVM{Name: "golden", SourceType: otv1alpha1.SourceTypePVC,
+				PVC:   &otv1alpha1.DataSyncVolumeSource{Name: "golden-image"},
+				Delta: &otv1alpha1.DataSyncDeltaSource{URL: "https://mirror.example.com/golden.qcow2"}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[0].delta.url: Invalid value")))
+			Expect(err).To(MatchError(ContainSubstring("spec.vms[1].delta: Forbidden")))
+		})
+
+		It("Should require the base version of a delta", func() {
+			obj.Spec.VMs[0].Delta = &otv1alpha1.DataSyncDeltaSource{URL: "https://mirror.example.com/controller-1.0-1.1.qcow2"}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(
+				MatchError(ContainSubstring("spec.vms[0].delta.baseVersion: Required value")))
+		})
+	})
+
+	Context("When updating DataSync under Validating Webhook", func() {
+		It("Should allow VM edits while the DataSync is queued", func() {
+			oldObj.Status.Phase = otv1alpha1.DataSyncPhaseQueued
+			obj.Spec.VMs = obj.Spec.VMs[:1]
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny VM edits once the DataSync left Queued", func() {
+			oldObj.Status.Phase = otv1alpha1.DataSyncPhaseSyncing
+			obj.Spec.VMs[0].URL = "https://mirror.example.com/controller-v2.qcow2"
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().To(
+				MatchError(ContainSubstring("may not be changed once the DataSync is Syncing")))
+		})
+	})
+
+	Context("When creating or updating DataSync under Defaulting Webhook", func() {
+		var defaulter DataSyncCustomDefaulter
+
+		BeforeEach(func() {
+			store := policy.NewStore()
+			p := policy.Defaults()
+			p.DefaultStorageClass = "fast-ssd"
+			p.DefaultVolumeSize = resource.MustParse("20Gi")
+			store.Set(p)
+			defaulter = DataSyncCustomDefaulter{
+				Policy: store,
+				Sizer: fakeSizer{
+					"https://mirror.example.com/controller.qcow2":  5<<30 + 1,
+					"https://mirror.example.com/controller.img.gz": 1 << 30,
+					"https://private.example.com/controller.qcow2": 3 << 30,
+				},
+				Reader: fake.NewClientBuilder().WithObjects(&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "mirror-credentials", Namespace: "default"},
+					Data:       map[string][]byte{"accessKeyId": []byte("ci"), "secretKey": []byte("hunter2")},
+				}).Build(),
+			}
+		})
+
+		It("Should fill in storage settings and labels", func() {
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+
+			Expect(obj.Labels).To(HaveKeyWithValue(otv1alpha1.LabelWorkspaceID, "035"))
+			controller, worker := obj.Spec.VMs[0], obj.Spec.VMs[1]
+			Expect(controller.Size.String()).To(Equal("6Gi"), "looked up sizes are rounded up to whole GiB")
+			Expect(worker.Size.String()).To(Equal("20Gi"), "registry sources fall back to the policy default")
+			for _, vm := range obj.Spec.VMs {
+				Expect(vm.StorageClassName).To(Equal(ptr.To("fast-ssd")))
+				Expect(vm.AccessMode).To(Equal(corev1.ReadWriteOnce))
+			}
+		})
+
+		It("Should leave the size of clones to CDI", func() {
+			obj.Spec.VMs[1] = otv1alpha1.DataSyncVM{Name: "golden", SourceType: otv1alpha1.SourceTypePVC,
+				PVC: &otv1alpha1.DataSyncVolumeSource{Name: "golden-image"}}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.VMs[1].Size).To(BeNil())
+			Expect(obj.Spec.VMs[1].StorageClassName).To(Equal(ptr.To("fast-ssd")))
+		})
+
+		It("Should fall back to the policy default when the lookup fails", func() {
+			obj.Spec.VMs[0].URL = "https://mirror.example.com/missing.qcow2"
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.VMs[0].Size.String()).To(Equal("20Gi"))
+		})
+
+		It("Should look sources up with their credentials", func() {
+			obj.Spec.VMs[0].URL = "https://private.example.com/controller.qcow2"
+			obj.Spec.VMs[0].SecretRef = "mirror-credentials"
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.VMs[0].Size.String()).To(Equal("3Gi"))
+		})
+
+		It("Should require a size for images that do not record theirs", func() {
+			obj.Spec.VMs[0].URL = "https://mirror.example.com/controller.img.gz"
+			Expect(defaulter.Default(ctx, obj)).To(MatchError(ContainSubstring("spec.vms[0].size: Required value")))
+
+			obj.Spec.VMs[0].Size = ptr.To(resource.MustParse("10Gi"))
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+		})
+
+		It("Should deny checksums of images that do not record their size", func() {
+			obj.Spec.VMs[0].URL = "https://mirror.example.com/controller.img.gz"
+			obj.Spec.VMs[0].Size = ptr.To(resource.MustParse("10Gi"))
+			obj.Spec.VMs[0].Checksum = "sha256:" + strings.Repeat("ab", 32)
+			Expect(defaulter.Default(ctx, obj)).To(MatchError(ContainSubstring(
+				"spec.vms[0].checksum: Forbidden: cannot be verified for this source")))
+
+			obj.Spec.VMs[0].URL = "https://mirror.example.com/controller.qcow2"
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+		})
+
+		It("Should keep values that are already set", func() {
+			obj.Labels = map[string]string{otv1alpha1.LabelWorkspaceID: "other"}
+			obj.Spec.VMs[0].Size = ptr.To(resource.MustParse("1Gi"))
+			obj.Spec.VMs[0].StorageClassName = ptr.To("")
+			obj.Spec.VMs[0].AccessMode = corev1.ReadWriteMany
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+
+			Expect(obj.Labels).To(HaveKeyWithValue(otv1alpha1.LabelWorkspaceID, "other"))
+			Expect(obj.Spec.VMs[0].Size.String()).To(Equal("1Gi"))
+			Expect(obj.Spec.VMs[0].StorageClassName).To(Equal(ptr.To("")))
+			Expect(obj.Spec.VMs[0].AccessMode).To(Equal(corev1.ReadWriteMany))
+		})
+
+		It("Should not touch the VMs once the DataSync left Queued", func() {
+			obj.Status.Phase = otv1alpha1.DataSyncPhaseSyncing
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.VMs).To(Equal(oldObj.Spec.VMs))
+			Expect(obj.Labels).To(HaveKeyWithValue(otv1alpha1.LabelWorkspaceID, "035"))
+		})
+	})
+})
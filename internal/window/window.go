@@ -0,0 +1,247 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package window implements cron-style time windows such as
+// "0 22 * * 1-5 8h": opening at 22:00 UTC on weekdays for eight hours.
+package window
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDuration bounds how long a window may stay open.
+const maxDuration = 7 * 24 * time.Hour
+
+// searchLimit bounds how far ahead the next opening of a window is searched.
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+// field is the set of values a cron field matches, one bit per value.
+type field uint64
+
+func (f field) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+// bounds of a cron field.
+type bounds struct {
+	name     string
+	min, max int
+}
+
+var (
+	minutes     = bounds{"minute", 0, 59}
+	hours       = bounds{"hour", 0, 23}
+	daysOfMonth = bounds{"day of month", 1, 31}
+	months      = bounds{"month", 1, 12}
+	// Both 0 and 7 are Sunday.
+	daysOfWeek = bounds{"day of week", 0, 7}
+)
+
+// Window opens whenever its cron schedule matches, in UTC, and stays open
+// for its duration.
+type Window struct {
+	spec     string
+	minute   field
+	hour     field
+	dom      field
+	month    field
+	dow      field
+	anyDOM   bool
+	anyDOW   bool
+	duration time.Duration
+}
+
+// Parse parses a window made of the five fields of a cron schedule (minute,
+// hour, day of month, month and day of week) followed by a duration, e.g.
+// "0 22 * * 1-5 8h". Fields accept *, single values, ranges, steps and
+// comma separated lists of those.
+func Parse(spec string) (Window, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != 6 {
+		return Window{}, fmt.Errorf("%q must be a cron schedule followed by a duration, e.g. \"0 22 * * 1-5 8h\"", spec)
+	}
+
+	w := Window{spec: strings.Join(parts, " ")}
+	var err error
+	for _, f := range []struct {
+		value  string
+		bounds bounds
+		into   *field
+	}{
+		{parts[0], minutes, &w.minute},
+		{parts[1], hours, &w.hour},
+		{parts[2], daysOfMonth, &w.dom},
+		{parts[3], months, &w.month},
+		{parts[4], daysOfWeek, &w.dow},
+	} {
+		if *f.into, err = parseField(f.value, f.bounds); err != nil {
+			return Window{}, fmt.Errorf("%q: %w", spec, err)
+		}
+	}
+	// Sunday may be written as 7.
+	if w.dow.has(7) {
+		w.dow |= 1
+	}
+	w.anyDOM = parts[2] == "*"
+	w.anyDOW = parts[4] == "*"
+
+	w.duration, err = time.ParseDuration(parts[5])
+	if err != nil {
+		return Window{}, fmt.Errorf("%q: %q is not a duration", spec, parts[5])
+	}
+	if w.duration <= 0 || w.duration > maxDuration {
+		return Window{}, fmt.Errorf("%q: the duration must be positive and at most %s", spec, maxDuration)
+	}
+	return w, nil
+}
+
+// parseField parses a single cron field.
+func parseField(value string, b bounds) (field, error) {
+	var f field
+	for _, part := range strings.Split(value, ",") {
+		rng, stepValue, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepValue)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("%s step %q is not a positive integer", b.name, stepValue)
+			}
+			step = n
+		}
+
+		lo, hi := b.min, b.max
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(first, b); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseValue(last, b); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = b.max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s range %q is reversed", b.name, rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			f |= 1 << uint(v)
+		}
+	}
+	return f, nil
+}
+
+// parseValue parses a single value of a cron field.
+func parseValue(value string, b bounds) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q is not an integer", b.name, value)
+	}
+	if n < b.min || n > b.max {
+		return 0, fmt.Errorf("%s %d is not between %d and %d", b.name, n, b.min, b.max)
+	}
+	return n, nil
+}
+
+// String returns the window as it was parsed.
+func (w Window) String() string {
+	return w.spec
+}
+
+// Contains reports whether the window is open at t.
+func (w Window) Contains(t time.Time) bool {
+	start, ok := w.lastStart(t)
+	return ok && t.Before(start.Add(w.duration))
+}
+
+// ClosesAt returns when the window that is open at t closes. Openings that
+// follow each other without a gap count as one.
+func (w Window) ClosesAt(t time.Time) time.Time {
+	start, ok := w.lastStart(t)
+	if !ok {
+		return t
+	}
+	end := start.Add(w.duration)
+	for {
+		next, ok := w.next(start.Add(time.Minute))
+		// A window that never closes is reported to close after the longest duration.
+		if !ok || next.After(end) || end.Sub(t) > maxDuration {
+			return end
+		}
+		start = next
+		if e := start.Add(w.duration); e.After(end) {
+			end = e
+		}
+	}
+}
+
+// NextOpen returns when the window next opens after t, or false if it never does.
+func (w Window) NextOpen(t time.Time) (time.Time, bool) {
+	return w.next(t.UTC().Truncate(time.Minute).Add(time.Minute))
+}
+
+// lastStart returns the latest opening at or before t that may still be open.
+func (w Window) lastStart(t time.Time) (time.Time, bool) {
+	t = t.UTC()
+	from := t.Add(-w.duration).Truncate(time.Minute).Add(time.Minute)
+	var last time.Time
+	found := false
+	for {
+		start, ok := w.next(from)
+		if !ok || start.After(t) {
+			return last, found
+		}
+		last, found = start, true
+		from = start.Add(time.Minute)
+	}
+}
+
+// next returns the first opening at or after t, which must be a whole minute in UTC.
+func (w Window) next(t time.Time) (time.Time, bool) {
+	limit := t.Add(searchLimit)
+	for t.Before(limit) {
+		switch {
+		case !w.month.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !w.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !w.hour.has(t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !w.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// matchesDay applies the cron rule that a day matches either day field when
+// both are restricted, and the restricted one otherwise.
+func (w Window) matchesDay(t time.Time) bool {
+	dom, dow := w.dom.has(t.Day()), w.dow.has(int(t.Weekday()))
+	if !w.anyDOM && !w.anyDOW {
+		return dom || dow
+	}
+	return dom && dow
+}
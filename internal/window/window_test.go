@@ -0,0 +1,95 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package window
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Window", func() {
+	// at returns a time in the week of Monday 2025-07-07.
+	at := func(weekday time.Weekday, hour, minute int) time.Time {
+		return time.Date(2025, 7, 6+int(weekday), hour, minute, 0, 0, time.UTC)
+	}
+
+	It("should be open overnight on weekdays", func() {
+		w, err := Parse("0 22 * * 1-5 8h")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(w.Contains(at(time.Monday, 21, 59))).To(BeFalse())
+		Expect(w.Contains(at(time.Monday, 22, 0))).To(BeTrue())
+		Expect(w.Contains(at(time.Tuesday, 5, 59))).To(BeTrue())
+		Expect(w.Contains(at(time.Tuesday, 6, 0))).To(BeFalse())
+		// The window opening on Friday night runs into Saturday morning.
+		Expect(w.Contains(at(time.Saturday, 3, 0))).To(BeTrue())
+		Expect(w.Contains(at(time.Saturday, 22, 30))).To(BeFalse())
+
+		Expect(w.ClosesAt(at(time.Monday, 23, 0))).To(Equal(at(time.Tuesday, 6, 0)))
+		next, ok := w.NextOpen(at(time.Saturday, 12, 0))
+		Expect(ok).To(BeTrue())
+		Expect(next).To(Equal(time.Date(2025, 7, 14, 22, 0, 0, 0, time.UTC)))
+	})
+
+	It("should follow adjoining openings to the close", func() {
+		w, err := Parse("0 */6 * * * 6h")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Contains(at(time.Monday, 13, 0))).To(BeTrue())
+		// The openings never leave a gap, so the window is reported to
+		// stay open for at least the longest duration.
+		Expect(w.ClosesAt(at(time.Monday, 13, 0))).To(BeTemporally(">=", at(time.Monday, 13, 0).Add(maxDuration)))
+
+		w, err = Parse("0 1,3 * * * 2h")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.ClosesAt(at(time.Monday, 2, 0))).To(Equal(at(time.Monday, 5, 0)))
+	})
+
+	It("should match either day field when both are set", func() {
+		w, err := Parse("0 0 1 * 0 1h")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Contains(time.Date(2025, 7, 1, 0, 30, 0, 0, time.UTC))).To(BeTrue(), "the first of the month")
+		Expect(w.Contains(at(time.Sunday, 0, 30))).To(BeTrue(), "a Sunday")
+		Expect(w.Contains(at(time.Monday, 0, 30))).To(BeFalse())
+
+		w, err = Parse("0 0 * * 7 1h")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Contains(at(time.Sunday, 0, 30))).To(BeTrue(), "7 is Sunday too")
+	})
+
+	It("should reject invalid windows", func() {
+		for spec, message := range map[string]string{
+			"0 22 * * 1-5":       "must be a cron schedule followed by a duration",
+			"0 24 * * * 1h":      "hour 24 is not between 0 and 23",
+			"0 22 * * 5-1 1h":    `day of week range "5-1" is reversed`,
+			"*/0 * * * * 1h":     `minute step "0" is not a positive integer`,
+			"0 22 * * MON 1h":    `day of week "MON" is not an integer`,
+			"0 22 * * * soon":    `"soon" is not a duration`,
+			"0 22 * * * 200h":    "the duration must be positive and at most 168h0m0s",
+			"0 22 * * * -1h":     "the duration must be positive",
+			"0 22 32 * * 1h":     "day of month 32 is not between 1 and 31",
+			"0 22 * 0 * 1h":      "month 0 is not between 1 and 12",
+			"0 22 * * * 1h 1h":   "must be a cron schedule followed by a duration",
+			"0 22,x * * * 1h":    `hour "x" is not an integer`,
+			"0 22-23/x * * * 1h": `hour step "x" is not a positive integer`,
+		} {
+			_, err := Parse(spec)
+			Expect(err).To(MatchError(ContainSubstring(message)), spec)
+		}
+	})
+})